@@ -7,6 +7,8 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/bradtumy/authorization-service/internal/logger"
@@ -15,11 +17,11 @@ import (
 	"github.com/bradtumy/authorization-service/pkg/graph"
 	"github.com/bradtumy/authorization-service/pkg/policy"
 	"github.com/bradtumy/authorization-service/pkg/policycompiler"
+	"github.com/bradtumy/authorization-service/pkg/schedule"
 	"github.com/bradtumy/authorization-service/pkg/store"
 	"github.com/bradtumy/authorization-service/pkg/tenant"
 	"github.com/bradtumy/authorization-service/pkg/user"
 	"github.com/bradtumy/authorization-service/pkg/validator"
-	jwt "github.com/golang-jwt/jwt/v4"
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 	"github.com/prometheus/client_golang/prometheus"
@@ -27,14 +29,16 @@ import (
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
-	"strings"
 )
 
 var (
+	// The tenant maps are read by every request and written by tenant
+	// management and the policy watchers, so they are guarded by tenantMu.
 	policyStores  map[string]*policy.PolicyStore
 	policyEngines map[string]*policy.PolicyEngine
 	policyGraphs  map[string]*graph.Graph
 	policyFiles   map[string]string
+	tenantMu      sync.RWMutex
 	backend       store.Store
 	policyBackend string
 	compiler      policycompiler.Compiler
@@ -46,8 +50,8 @@ var (
 		},
 		[]string{"decision", "reason"},
 	)
-	tracer           trace.Tracer
-	contextProviders contextprovider.Chain
+	tracer        trace.Tracer
+	contextChains contextprovider.Chains
 )
 
 func init() {
@@ -55,7 +59,9 @@ func init() {
 		log.Printf("warning: could not load .env file: %v", err)
 	}
 
-	middleware.LoadOIDCConfig()
+	if err := middleware.LoadOIDCConfig(); err != nil {
+		panic("failed to load OIDC providers: " + err.Error())
+	}
 
 	policyStores = make(map[string]*policy.PolicyStore)
 	policyEngines = make(map[string]*policy.PolicyEngine)
@@ -98,27 +104,39 @@ func init() {
 		panic("failed to save default tenant: " + err.Error())
 	}
 
-	if policyBackend == "db" {
+	lvl := logger.ParseLevel(os.Getenv("LOG_LEVEL"))
+	auditLogger = logger.New(os.Stdout, lvl)
+	tracer = otel.Tracer("authorization-service")
+
+	switch policyBackend {
+	case "db":
 		if err := loadPoliciesFromDB(context.Background(), defaultTenant); err != nil {
 			panic("failed to load policies from db: " + err.Error())
 		}
 		go watchPolicies()
-	} else {
+	case "git":
+		if err := initGitPolicies(); err != nil {
+			panic("failed to load policies from git: " + err.Error())
+		}
+		go watchGit()
+	default:
 		if err := store.LoadPolicies(defaultFile); err != nil {
 			panic("Failed to load policies: " + err.Error())
 		}
 	}
 
 	compiler = policycompiler.NewOpenAICompiler(os.Getenv("OPENAI_API_KEY"))
-	lvl := logger.ParseLevel(os.Getenv("LOG_LEVEL"))
-	auditLogger = logger.New(os.Stdout, lvl)
-	prometheus.MustRegister(policyEval)
-	tracer = otel.Tracer("authorization-service")
-	contextProviders = contextprovider.Chain{
-		contextprovider.TimeProvider{},
-		contextprovider.GeoIPProvider{},
-		contextprovider.RiskProvider{},
+	prometheus.MustRegister(policyEval, shadowEval)
+	if spec := os.Getenv("BUSINESS_HOURS"); spec != "" {
+		s, err := schedule.Parse(spec)
+		if err != nil {
+			panic("invalid BUSINESS_HOURS: " + err.Error())
+		}
+		schedule.BusinessHours = s
 	}
+	initSystemPolicies()
+	contextChains = initContextProviders()
+	initSubjectMode()
 }
 
 type AccessRequest struct {
@@ -176,38 +194,21 @@ type DeleteUserRequest struct {
 	Username string `json:"username"`
 }
 
+// subjectFromRequest returns the caller's identity from the claims stored by
+// JWTMiddleware. Unverified tokens, which JWTMiddleware lets through when no
+// OIDC provider is configured, name any subject and are rejected.
 func subjectFromRequest(r *http.Request) (string, error) {
-	auth := r.Header.Get("Authorization")
-	if auth == "" {
+	claims, ok := middleware.ClaimsFromContext(r.Context())
+	if !ok {
 		return "", errors.New("missing token")
 	}
-	tokenString := strings.TrimPrefix(auth, "Bearer ")
-	claims := jwt.MapClaims{}
-	parser := jwt.Parser{}
-	if _, _, err := parser.ParseUnverified(tokenString, claims); err != nil {
-		return "", err
+	if !claims.Verified {
+		return "", errors.New("token is not verified")
 	}
-	if username, _ := claims["preferred_username"].(string); username != "" {
-		return username, nil
-	}
-	sub, _ := claims["sub"].(string)
-	if sub == "" {
+	if claims.Subject == "" {
 		return "", errors.New("missing subject")
 	}
-	return sub, nil
-}
-
-func requireAdmin(w http.ResponseWriter, r *http.Request, tenantID string) (string, bool) {
-	sub, err := subjectFromRequest(r)
-	if err != nil {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return "", false
-	}
-	if !user.HasRole(tenantID, sub, "TenantAdmin", "PolicyAdmin") {
-		http.Error(w, "forbidden", http.StatusForbidden)
-		return "", false
-	}
-	return sub, true
+	return claims.Subject, nil
 }
 
 func SetupRouter() *mux.Router {
@@ -215,21 +216,40 @@ func SetupRouter() *mux.Router {
 	router.Use(middleware.TracingMiddleware)
 	router.Use(middleware.CorrelationMiddleware)
 	router.Use(middleware.MetricsMiddleware)
-	router.Use(middleware.JWTMiddleware)
-	router.HandleFunc("/check-access", CheckAccess).Methods("POST")
-	router.HandleFunc("/simulate", SimulateAccess).Methods("POST")
-	router.HandleFunc("/reload", ReloadPolicies).Methods("POST")
-	router.HandleFunc("/compile", CompileRule).Methods("POST")
-	router.HandleFunc("/validate-policy", ValidatePolicy).Methods("POST")
-	router.HandleFunc("/tenant/create", CreateTenant).Methods("POST")
-	router.HandleFunc("/tenant/delete", DeleteTenant).Methods("POST")
-	router.HandleFunc("/tenant/list", ListTenants).Methods("GET")
-	router.HandleFunc("/user/create", CreateUser).Methods("POST")
-	router.HandleFunc("/user/assign-role", AssignRole).Methods("POST")
-	router.HandleFunc("/user/delete", DeleteUser).Methods("POST")
-	router.HandleFunc("/user/list", ListUsers).Methods("GET")
-	router.HandleFunc("/user/get", GetUser).Methods("GET")
-	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	// Webhooks authenticate with a shared secret rather than a bearer token.
+	router.HandleFunc("/webhooks/git", GitWebhook).Methods("POST")
+	// The policy file schema is public so editors can fetch it without a token.
+	router.HandleFunc("/schema/policy.json", PolicySchema).Methods("GET")
+	// Key set health is public so probes can reach it without a token.
+	router.HandleFunc("/health/oidc", OIDCHealth).Methods("GET")
+
+	secured := router.PathPrefix("/").Subrouter()
+	secured.Use(middleware.APIKeyMiddleware(lookupAPIKey))
+	secured.HandleFunc("/check-access", CheckAccess).Methods("POST")
+	secured.HandleFunc("/simulate", SimulateAccess).Methods("POST")
+	secured.HandleFunc("/reload", ReloadPolicies).Methods("POST")
+	secured.HandleFunc("/policies/version", PolicyVersion).Methods("GET")
+	secured.HandleFunc("/policies/history", PolicyHistory).Methods("GET")
+	secured.HandleFunc("/policies/rollback", RollbackPolicies).Methods("POST")
+	secured.HandleFunc("/policies/pin", PinPolicies).Methods("POST")
+	secured.HandleFunc("/policies/unpin", UnpinPolicies).Methods("POST")
+	secured.HandleFunc("/policies/shadow", LoadShadowPolicies).Methods("POST")
+	secured.HandleFunc("/policies/shadow/clear", ClearShadowPolicies).Methods("POST")
+	secured.HandleFunc("/policies/replay", ReplayPolicies).Methods("POST")
+	secured.HandleFunc("/compile", CompileRule).Methods("POST")
+	secured.HandleFunc("/validate-policy", ValidatePolicy).Methods("POST")
+	secured.HandleFunc("/tenant/create", CreateTenant).Methods("POST")
+	secured.HandleFunc("/tenant/delete", DeleteTenant).Methods("POST")
+	secured.HandleFunc("/tenant/list", ListTenants).Methods("GET")
+	secured.HandleFunc("/user/create", CreateUser).Methods("POST")
+	secured.HandleFunc("/user/assign-role", AssignRole).Methods("POST")
+	secured.HandleFunc("/user/delete", DeleteUser).Methods("POST")
+	secured.HandleFunc("/user/list", ListUsers).Methods("GET")
+	secured.HandleFunc("/user/get", GetUser).Methods("GET")
+	secured.HandleFunc("/apikey/create", CreateAPIKey).Methods("POST")
+	secured.HandleFunc("/apikey/list", ListAPIKeys).Methods("GET")
+	secured.HandleFunc("/apikey/revoke", RevokeAPIKey).Methods("POST")
+	secured.Handle("/metrics", promhttp.Handler()).Methods("GET")
 	return router
 }
 
@@ -243,17 +263,43 @@ func CheckAccess(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	engine, ok := policyEngines[req.TenantID]
+	tenantID, ok := bindTenant(w, r, req.TenantID)
+	if !ok {
+		return
+	}
+	req.TenantID = tenantID
+	engine, ok := tenantEngine(req.TenantID)
 	if !ok {
 		http.Error(w, "tenant not found", http.StatusNotFound)
 		return
 	}
+	cid := middleware.CorrelationIDFromContext(r.Context())
+	subject, actor, err := resolveSubject(r, req, engine)
+	if err != nil {
+		auditLogger.Log(logger.Entry{
+			Level:         "warn",
+			CorrelationID: cid,
+			TenantID:      req.TenantID,
+			Subject:       req.Subject,
+			APIKey:        apiKeyOf(r),
+			Action:        req.Action,
+			Resource:      req.Resource,
+			Decision:      "deny",
+			Reason:        err.Error(),
+		})
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	req.Subject = subject
 
 	// Gather runtime context and evaluate permissions using the PolicyEngine
-	ctxVals := contextProviders.GetContext(r)
+	access := contextprovider.Access{TenantID: req.TenantID, Subject: req.Subject, Resource: req.Resource, Action: req.Action}
+	chain := contextChains.For(req.TenantID)
+	ctxVals, ctxErrs := chain.GetContext(r.WithContext(contextprovider.WithAccess(ctx, access)))
 	if req.Conditions == nil {
 		req.Conditions = make(map[string]string)
 	}
+	applyClaims(r, req.Conditions, actor, chain)
 	req.Conditions["tenantID"] = req.TenantID
 	for k, v := range ctxVals {
 		req.Conditions[k] = v
@@ -262,7 +308,20 @@ func CheckAccess(w http.ResponseWriter, r *http.Request) {
 	for k, v := range ctxVals {
 		evalSpan.SetAttributes(attribute.String(k, v))
 	}
-	decision := engine.Evaluate(req.Subject, req.Resource, req.Action, req.Conditions)
+	var decision policy.Decision
+	failedClosed := contextprovider.FailedClosed(ctxErrs)
+	if failedClosed {
+		decision = policy.Decision{Allow: false, Reason: "context unavailable", Context: req.Conditions}
+	} else {
+		decision = engine.Evaluate(req.Subject, req.Resource, req.Action, req.Conditions)
+	}
+	if len(ctxErrs) > 0 {
+		decision.ContextErrors = make(map[string]string, len(ctxErrs))
+		for _, e := range ctxErrs {
+			decision.ContextErrors[e.Provider] = e.Message
+			evalSpan.SetAttributes(attribute.String("context_error."+e.Provider, e.Message))
+		}
+	}
 	status := "deny"
 	if decision.Allow {
 		status = "allow"
@@ -274,7 +333,6 @@ func CheckAccess(w http.ResponseWriter, r *http.Request) {
 	evalSpan.End()
 
 	// Audit log
-	cid := middleware.CorrelationIDFromContext(r.Context())
 	reasonLabel := ""
 	if !decision.Allow {
 		switch decision.Reason {
@@ -290,16 +348,47 @@ func CheckAccess(w http.ResponseWriter, r *http.Request) {
 		CorrelationID: cid,
 		TenantID:      req.TenantID,
 		Subject:       req.Subject,
+		Actor:         actor,
+		APIKey:        apiKeyOf(r),
 		Action:        req.Action,
 		Resource:      req.Resource,
 		Decision:      status,
 		PolicyID:      decision.PolicyID,
 		Reason:        decision.Reason,
+		Context:       auditContext(req.TenantID, decision, req.Conditions),
+		Commit:        decision.Commit,
 	})
 
 	// Respond with the authorization decision
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(decision)
+
+	evaluateShadow(r, req, decision, failedClosed)
+}
+
+// auditContext returns the context values recorded with a decision: only the
+// keys the deciding policy read, unless AUDIT_FULL_CONTEXT=true records all of
+// them. The full context holds caller-supplied values, addresses and mapped
+// claims, so it is opt-in.
+func auditContext(tenantID string, dec policy.Decision, ctx map[string]string) map[string]string {
+	if os.Getenv("AUDIT_FULL_CONTEXT") == "true" {
+		return ctx
+	}
+	st, ok := tenantStore(tenantID)
+	if !ok || dec.PolicyID == "" {
+		return nil
+	}
+	p, ok := st.GetPolicy(dec.PolicyID)
+	if !ok {
+		return nil
+	}
+	out := map[string]string{}
+	for _, k := range p.ContextKeys() {
+		if v, ok := ctx[k]; ok {
+			out[k] = v
+		}
+	}
+	return out
 }
 
 // SimulateAccess performs a dry-run policy evaluation without audit logging.
@@ -311,11 +400,26 @@ func SimulateAccess(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	engine, ok := policyEngines[req.TenantID]
+	tenantID, ok := bindTenant(w, r, req.TenantID)
+	if !ok {
+		return
+	}
+	req.TenantID = tenantID
+	engine, ok := tenantEngine(req.TenantID)
 	if !ok {
 		http.Error(w, "tenant not found", http.StatusNotFound)
 		return
 	}
+	// Callers simulate the subjects CheckAccess would evaluate for them; other
+	// subjects require the policy:simulate action.
+	subject, _, err := resolveSubject(r, AccessRequest{TenantID: req.TenantID, Subject: req.Subject}, engine)
+	if err != nil {
+		if _, ok := requireAdmin(w, r, req.TenantID, actionPolicySimulate); !ok {
+			return
+		}
+		subject = req.Subject
+	}
+	req.Subject = subject
 	if req.Context == nil {
 		req.Context = make(map[string]string)
 	}
@@ -334,22 +438,42 @@ func ReloadPolicies(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	if _, ok := policyStores[req.TenantID]; !ok {
+	tenantID, ok := bindTenant(w, r, req.TenantID)
+	if !ok {
+		return
+	}
+	req.TenantID = tenantID
+	sub, ok := requireAdmin(w, r, req.TenantID, actionPolicyReload)
+	if !ok {
+		return
+	}
+	if _, ok := tenantStore(req.TenantID); !ok {
 		http.Error(w, "tenant not found", http.StatusNotFound)
 		return
 	}
-	if policyBackend == "db" {
+	source := policyBackend
+	if req.TenantID == systemTenant {
+		source = "file"
+	}
+	switch source {
+	case "db":
 		if err := loadPoliciesFromDB(r.Context(), req.TenantID); err != nil {
 			http.Error(w, "failed to reload policies", http.StatusInternalServerError)
 			return
 		}
-	} else {
-		file, ok := policyFiles[req.TenantID]
-		if !ok {
+	case "git":
+		if _, err := syncGitPolicies(r.Context()); err != nil {
+			http.Error(w, "failed to reload policies", http.StatusInternalServerError)
+			return
+		}
+	default:
+		file, ok := tenantFile(req.TenantID)
+		st, ok2 := tenantStore(req.TenantID)
+		if !ok || !ok2 {
 			http.Error(w, "tenant not found", http.StatusNotFound)
 			return
 		}
-		if err := policyStores[req.TenantID].LoadPolicies(file); err != nil {
+		if err := st.LoadPolicies(file); err != nil {
 			auditLogger.Log(logger.Entry{
 				Level:         "error",
 				CorrelationID: middleware.CorrelationIDFromContext(r.Context()),
@@ -365,11 +489,13 @@ func ReloadPolicies(w http.ResponseWriter, r *http.Request) {
 			Level:         "info",
 			CorrelationID: middleware.CorrelationIDFromContext(r.Context()),
 			TenantID:      req.TenantID,
+			Subject:       sub,
 			Action:        "reload",
 			Resource:      file,
 			Decision:      "success",
 		})
 	}
+	clearPromotedShadow(req.TenantID)
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("policies reloaded"))
 }
@@ -383,7 +509,16 @@ func CompileRule(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	if _, ok := policyStores[req.TenantID]; !ok {
+	tenantID, ok := bindTenant(w, r, req.TenantID)
+	if !ok {
+		return
+	}
+	req.TenantID = tenantID
+	sub, ok := requireAdmin(w, r, req.TenantID, actionPolicyCompile)
+	if !ok {
+		return
+	}
+	if _, ok := tenantStore(req.TenantID); !ok {
 		http.Error(w, "tenant not found", http.StatusNotFound)
 		return
 	}
@@ -393,6 +528,7 @@ func CompileRule(w http.ResponseWriter, r *http.Request) {
 			Level:         "error",
 			CorrelationID: middleware.CorrelationIDFromContext(r.Context()),
 			TenantID:      req.TenantID,
+			Subject:       sub,
 			Action:        "compile",
 			Reason:        err.Error(),
 		})
@@ -403,6 +539,7 @@ func CompileRule(w http.ResponseWriter, r *http.Request) {
 		Level:         "info",
 		CorrelationID: middleware.CorrelationIDFromContext(r.Context()),
 		TenantID:      req.TenantID,
+		Subject:       sub,
 		Action:        "compile",
 		Decision:      "success",
 	})
@@ -410,7 +547,9 @@ func CompileRule(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(policy))
 }
 
-// ValidatePolicy validates a policy definition provided in the request body.
+// ValidatePolicy validates a policy definition provided in the request body
+// and responds with a JSON array of findings. The status is 400 when any
+// finding is an error; warnings alone still return 200.
 func ValidatePolicy(w http.ResponseWriter, r *http.Request) {
 	_, span := tracer.Start(r.Context(), "ValidatePolicy")
 	defer span.End()
@@ -419,30 +558,101 @@ func ValidatePolicy(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	if _, ok := policyStores[req.TenantID]; !ok {
+	tenantID, ok := bindTenant(w, r, req.TenantID)
+	if !ok {
+		return
+	}
+	req.TenantID = tenantID
+	sub, ok := requireAdmin(w, r, req.TenantID, actionPolicyValidate)
+	if !ok {
+		return
+	}
+	if _, ok := tenantStore(req.TenantID); !ok {
 		http.Error(w, "tenant not found", http.StatusNotFound)
 		return
 	}
-	if err := validator.ValidatePolicyData([]byte(req.Policy)); err != nil {
+	findings := validator.Validate([]byte(req.Policy))
+	if findings == nil {
+		findings = []validator.Finding{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := validator.ErrorsOf(findings); err != nil {
 		auditLogger.Log(logger.Entry{
 			Level:         "warn",
 			CorrelationID: middleware.CorrelationIDFromContext(r.Context()),
 			TenantID:      req.TenantID,
+			Subject:       sub,
 			Action:        "validate",
 			Reason:        err.Error(),
 		})
-		http.Error(w, "invalid policy: "+err.Error(), http.StatusBadRequest)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(findings)
 		return
 	}
 	auditLogger.Log(logger.Entry{
 		Level:         "info",
 		CorrelationID: middleware.CorrelationIDFromContext(r.Context()),
 		TenantID:      req.TenantID,
+		Subject:       sub,
 		Action:        "validate",
 		Decision:      "success",
 	})
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("policy is valid"))
+	json.NewEncoder(w).Encode(findings)
+}
+
+// PolicySchema serves the JSON Schema of the policy file format.
+func PolicySchema(w http.ResponseWriter, r *http.Request) {
+	data, err := policy.SchemaJSON()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Write(data)
+}
+
+// tenantStore returns the policy store of a tenant.
+func tenantStore(tenantID string) (*policy.PolicyStore, bool) {
+	tenantMu.RLock()
+	defer tenantMu.RUnlock()
+	st, ok := policyStores[tenantID]
+	return st, ok
+}
+
+// tenantEngine returns the policy engine of a tenant.
+func tenantEngine(tenantID string) (*policy.PolicyEngine, bool) {
+	tenantMu.RLock()
+	defer tenantMu.RUnlock()
+	engine, ok := policyEngines[tenantID]
+	return engine, ok
+}
+
+// tenantGraph returns the relationship graph of a tenant.
+func tenantGraph(tenantID string) (*graph.Graph, bool) {
+	tenantMu.RLock()
+	defer tenantMu.RUnlock()
+	g, ok := policyGraphs[tenantID]
+	return g, ok
+}
+
+// tenantFile returns the policy file a tenant is reloaded from.
+func tenantFile(tenantID string) (string, bool) {
+	tenantMu.RLock()
+	defer tenantMu.RUnlock()
+	file, ok := policyFiles[tenantID]
+	return file, ok
+}
+
+// addTenant registers a tenant with an empty policy store, reloaded from file
+// when it is set. The caller must hold tenantMu.
+func addTenant(tenantID, file string) *policy.PolicyStore {
+	store := policy.NewPolicyStore()
+	g := graph.New()
+	policyStores[tenantID] = store
+	policyGraphs[tenantID] = g
+	policyEngines[tenantID] = policy.NewPolicyEngine(store, g)
+	policyFiles[tenantID] = file
+	return store
 }
 
 func loadPoliciesFromDB(ctx context.Context, tenantID string) error {
@@ -450,11 +660,12 @@ func loadPoliciesFromDB(ctx context.Context, tenantID string) error {
 	if err != nil {
 		return err
 	}
+	tenantMu.Lock()
 	store, ok := policyStores[tenantID]
 	if !ok {
-		store = policy.NewPolicyStore()
-		policyStores[tenantID] = store
+		store = addTenant(tenantID, "")
 	}
+	tenantMu.Unlock()
 	store.ReplacePolicies(policies)
 	return nil
 }
@@ -467,7 +678,7 @@ func watchPolicies() {
 			continue
 		}
 		for _, t := range tenants {
-			if _, ok := policyStores[t.ID]; ok {
+			if _, ok := tenantStore(t.ID); ok {
 				loadPoliciesFromDB(context.Background(), t.ID)
 			}
 		}
@@ -483,20 +694,26 @@ func CreateTenant(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
 		return
 	}
+	tenantID, ok := bindTenant(w, r, req.TenantID)
+	if !ok {
+		return
+	}
+	req.TenantID = tenantID
 	if req.TenantID == "" {
 		http.Error(w, "tenantID is required", http.StatusBadRequest)
 		return
 	}
-	if _, err := backend.LoadTenant(r.Context(), req.TenantID); err == nil {
+	sub, ok := requireAdmin(w, r, req.TenantID, actionTenantCreate)
+	if !ok {
+		return
+	}
+	if _, err := backend.LoadTenant(r.Context(), req.TenantID); err == nil || req.TenantID == systemTenant {
 		http.Error(w, "tenant already exists", http.StatusConflict)
 		return
 	}
-	store := policy.NewPolicyStore()
-	g := graph.New()
-	policyStores[req.TenantID] = store
-	policyGraphs[req.TenantID] = g
-	policyEngines[req.TenantID] = policy.NewPolicyEngine(store, g)
-	policyFiles[req.TenantID] = ""
+	tenantMu.Lock()
+	addTenant(req.TenantID, "")
+	tenantMu.Unlock()
 	tenant := Tenant{ID: req.TenantID, Name: req.Name, CreatedAt: time.Now()}
 	if err := backend.SaveTenant(r.Context(), tenant); err != nil {
 		http.Error(w, "failed to save tenant", http.StatusInternalServerError)
@@ -509,6 +726,7 @@ func CreateTenant(w http.ResponseWriter, r *http.Request) {
 		Level:         "info",
 		CorrelationID: middleware.CorrelationIDFromContext(r.Context()),
 		TenantID:      req.TenantID,
+		Subject:       sub,
 		Action:        "tenant_create",
 		Decision:      "success",
 	})
@@ -525,20 +743,37 @@ func DeleteTenant(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
 		return
 	}
+	tenantID, ok := bindTenant(w, r, req.TenantID)
+	if !ok {
+		return
+	}
+	req.TenantID = tenantID
+	sub, ok := requireAdmin(w, r, req.TenantID, actionTenantDelete)
+	if !ok {
+		return
+	}
+	if req.TenantID == systemTenant {
+		http.Error(w, "the system tenant cannot be deleted", http.StatusBadRequest)
+		return
+	}
 	tenant, err := backend.LoadTenant(r.Context(), req.TenantID)
 	if err != nil {
 		http.Error(w, "tenant not found", http.StatusNotFound)
 		return
 	}
+	tenantMu.Lock()
 	delete(policyStores, req.TenantID)
 	delete(policyGraphs, req.TenantID)
 	delete(policyEngines, req.TenantID)
 	delete(policyFiles, req.TenantID)
+	tenantMu.Unlock()
+	clearShadow(req.TenantID)
 	backend.DeleteTenant(r.Context(), req.TenantID)
 	auditLogger.Log(logger.Entry{
 		Level:         "info",
 		CorrelationID: middleware.CorrelationIDFromContext(r.Context()),
 		TenantID:      req.TenantID,
+		Subject:       sub,
 		Action:        "tenant_delete",
 		Decision:      "success",
 	})
@@ -546,24 +781,43 @@ func DeleteTenant(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(tenant)
 }
 
-// ListTenants returns all registered tenants.
+// ListTenants returns the registered tenants the caller may list.
 func ListTenants(w http.ResponseWriter, r *http.Request) {
 	ctx, span := tracer.Start(r.Context(), "ListTenants")
 	defer span.End()
+	sub, err := subjectFromRequest(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
 	list, err := backend.ListTenants(ctx)
 	if err != nil {
 		auditLogger.Log(logger.Entry{
 			Level:         "error",
 			CorrelationID: middleware.CorrelationIDFromContext(r.Context()),
+			Subject:       sub,
 			Action:        "tenant_list",
 			Reason:        err.Error(),
 		})
 		http.Error(w, "failed to list tenants", http.StatusInternalServerError)
 		return
 	}
+	// Callers only see the tenants they are bound to and may list.
+	bound := boundTenants(r)
+	visible := list[:0]
+	for _, t := range list {
+		if bound != nil && !slices.Contains(bound, t.ID) {
+			continue
+		}
+		if _, dec, err := authorizeAdmin(r, t.ID, actionTenantList); err == nil && dec.Allow {
+			visible = append(visible, t)
+		}
+	}
+	list = visible
 	auditLogger.Log(logger.Entry{
 		Level:         "info",
 		CorrelationID: middleware.CorrelationIDFromContext(r.Context()),
+		Subject:       sub,
 		Action:        "tenant_list",
 		Decision:      "success",
 	})
@@ -578,7 +832,15 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	if _, ok := requireAdmin(w, r, req.TenantID); !ok {
+	tenantID, ok := bindTenant(w, r, req.TenantID)
+	if !ok {
+		return
+	}
+	req.TenantID = tenantID
+	if _, ok := requireAdmin(w, r, req.TenantID, actionUserCreate); !ok {
+		return
+	}
+	if !requireGrantable(w, r, req.TenantID, req.Roles) {
 		return
 	}
 	u, err := user.Create(req.TenantID, req.Username, req.Roles)
@@ -597,7 +859,15 @@ func AssignRole(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	if _, ok := requireAdmin(w, r, req.TenantID); !ok {
+	tenantID, ok := bindTenant(w, r, req.TenantID)
+	if !ok {
+		return
+	}
+	req.TenantID = tenantID
+	if _, ok := requireAdmin(w, r, req.TenantID, actionUserAssignRole); !ok {
+		return
+	}
+	if !requireGrantable(w, r, req.TenantID, req.Roles) {
 		return
 	}
 	if err := user.AssignRoles(req.TenantID, req.Username, req.Roles); err != nil {
@@ -614,7 +884,12 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	if _, ok := requireAdmin(w, r, req.TenantID); !ok {
+	tenantID, ok := bindTenant(w, r, req.TenantID)
+	if !ok {
+		return
+	}
+	req.TenantID = tenantID
+	if _, ok := requireAdmin(w, r, req.TenantID, actionUserDelete); !ok {
 		return
 	}
 	if err := user.Delete(req.TenantID, req.Username); err != nil {
@@ -626,12 +901,15 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 
 // ListUsers returns all users for a tenant.
 func ListUsers(w http.ResponseWriter, r *http.Request) {
-	tenantID := r.URL.Query().Get("tenantID")
+	tenantID, ok := bindTenant(w, r, r.URL.Query().Get("tenantID"))
+	if !ok {
+		return
+	}
 	if tenantID == "" {
 		http.Error(w, "missing tenantID", http.StatusBadRequest)
 		return
 	}
-	if _, ok := requireAdmin(w, r, tenantID); !ok {
+	if _, ok := requireAdmin(w, r, tenantID, actionUserList); !ok {
 		return
 	}
 	list := user.List(tenantID)
@@ -641,13 +919,16 @@ func ListUsers(w http.ResponseWriter, r *http.Request) {
 
 // GetUser returns information for a specific user.
 func GetUser(w http.ResponseWriter, r *http.Request) {
-	tenantID := r.URL.Query().Get("tenantID")
+	tenantID, ok := bindTenant(w, r, r.URL.Query().Get("tenantID"))
+	if !ok {
+		return
+	}
 	username := r.URL.Query().Get("username")
 	if tenantID == "" || username == "" {
 		http.Error(w, "missing tenantID or username", http.StatusBadRequest)
 		return
 	}
-	if _, ok := requireAdmin(w, r, tenantID); !ok {
+	if _, ok := requireAdmin(w, r, tenantID, actionUserGet); !ok {
 		return
 	}
 	u, err := user.Get(tenantID, username)
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bradtumy/authorization-service/internal/logger"
+	"github.com/bradtumy/authorization-service/internal/middleware"
+	"github.com/bradtumy/authorization-service/pkg/apikey"
+	"github.com/bradtumy/authorization-service/pkg/store"
+)
+
+// defaultRotationGrace is how long a rotated key stays valid when the
+// rotation sets no grace period, giving callers time to switch keys.
+const defaultRotationGrace = time.Hour
+
+// CreateAPIKeyRequest issues an API key for a tenant. With Rotate it replaces
+// that key, which is revoked after Grace, and the new key inherits its name
+// and endpoints unless given.
+type CreateAPIKeyRequest struct {
+	TenantID  string   `json:"tenantID"`
+	Name      string   `json:"name"`
+	Endpoints []string `json:"endpoints"`
+	// TTL is a duration such as "720h"; keys without one do not expire.
+	TTL    string `json:"ttl"`
+	Rotate string `json:"rotate"`
+	Grace  string `json:"grace"`
+}
+
+// CreateAPIKeyResponse carries the new key, which is not retrievable later.
+type CreateAPIKeyResponse struct {
+	Key    string     `json:"key"`
+	APIKey apikey.Key `json:"apiKey"`
+}
+
+// RevokeAPIKeyRequest revokes a key of a tenant.
+type RevokeAPIKeyRequest struct {
+	TenantID string `json:"tenantID"`
+	ID       string `json:"id"`
+}
+
+// lookupAPIKey reads keys from the current backend for APIKeyMiddleware.
+func lookupAPIKey(ctx context.Context, id string) (apikey.Key, error) {
+	return backend.LoadAPIKey(ctx, id)
+}
+
+// apiKeyOf returns the ID of the API key the request was made with, if any.
+func apiKeyOf(r *http.Request) string {
+	claims, _ := middleware.ClaimsFromContext(r.Context())
+	return claims.APIKey
+}
+
+// loadTenantKey returns the key id of tenantID, responding with 404 when the
+// tenant has no such key.
+func loadTenantKey(w http.ResponseWriter, r *http.Request, tenantID, id string) (apikey.Key, bool) {
+	k, err := backend.LoadAPIKey(r.Context(), id)
+	if errors.Is(err, store.ErrAPIKeyNotFound) || (err == nil && k.TenantID != tenantID) {
+		http.Error(w, "api key not found", http.StatusNotFound)
+		return apikey.Key{}, false
+	}
+	if err != nil {
+		http.Error(w, "failed to load api key", http.StatusInternalServerError)
+		return apikey.Key{}, false
+	}
+	return k, true
+}
+
+// CreateAPIKey issues, or rotates, a tenant's API key.
+func CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	tenantID, ok := bindTenant(w, r, req.TenantID)
+	if !ok {
+		return
+	}
+	req.TenantID = tenantID
+	if req.TenantID == "" {
+		http.Error(w, "tenantID is required", http.StatusBadRequest)
+		return
+	}
+	sub, ok := requireAdmin(w, r, req.TenantID, actionAPIKeyCreate)
+	if !ok {
+		return
+	}
+	if _, ok := tenantEngine(req.TenantID); !ok || req.TenantID == systemTenant {
+		http.Error(w, "tenant not found", http.StatusNotFound)
+		return
+	}
+	var ttl, grace time.Duration
+	var err error
+	if req.TTL != "" {
+		if ttl, err = time.ParseDuration(req.TTL); err != nil || ttl <= 0 {
+			http.Error(w, "ttl must be a positive duration", http.StatusBadRequest)
+			return
+		}
+	}
+	grace = defaultRotationGrace
+	if req.Grace != "" {
+		if grace, err = time.ParseDuration(req.Grace); err != nil || grace < 0 {
+			http.Error(w, "grace must be a non-negative duration", http.StatusBadRequest)
+			return
+		}
+	}
+	now := time.Now().UTC()
+	var old apikey.Key
+	if req.Rotate != "" {
+		if old, ok = loadTenantKey(w, r, req.TenantID, req.Rotate); !ok {
+			return
+		}
+		if !old.Active(now) {
+			http.Error(w, "api key is revoked or expired", http.StatusConflict)
+			return
+		}
+		if req.Name == "" {
+			req.Name = old.Name
+		}
+		if len(req.Endpoints) == 0 {
+			req.Endpoints = old.Endpoints
+		}
+	}
+	if req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	raw, k, err := apikey.Generate(req.TenantID, req.Name, req.Endpoints)
+	if err != nil {
+		http.Error(w, "failed to generate api key", http.StatusInternalServerError)
+		return
+	}
+	k.CreatedBy = sub
+	k.RotatedFrom = old.ID
+	if ttl > 0 {
+		k.ExpiresAt = now.Add(ttl)
+	}
+	if err := backend.SaveAPIKey(r.Context(), k); err != nil {
+		http.Error(w, "failed to save api key", http.StatusInternalServerError)
+		return
+	}
+	if old.ID != "" {
+		old.RevokedAt = now.Add(grace)
+		if err := backend.SaveAPIKey(r.Context(), old); err != nil {
+			http.Error(w, "failed to revoke rotated api key", http.StatusInternalServerError)
+			return
+		}
+		middleware.ForgetAPIKey(old.ID)
+	}
+	auditLogger.Log(logger.Entry{
+		Level:         "info",
+		CorrelationID: middleware.CorrelationIDFromContext(r.Context()),
+		TenantID:      req.TenantID,
+		Subject:       sub,
+		APIKey:        apiKeyOf(r),
+		Action:        "apikey_create",
+		Resource:      "apikey:" + k.ID,
+		Decision:      "success",
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreateAPIKeyResponse{Key: raw, APIKey: k})
+}
+
+// ListAPIKeys returns a tenant's API keys, without their secrets.
+func ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	tenantID, ok := bindTenant(w, r, r.URL.Query().Get("tenantID"))
+	if !ok {
+		return
+	}
+	if tenantID == "" {
+		http.Error(w, "tenantID is required", http.StatusBadRequest)
+		return
+	}
+	if _, ok := requireAdmin(w, r, tenantID, actionAPIKeyList); !ok {
+		return
+	}
+	keys, err := backend.ListAPIKeys(r.Context(), tenantID)
+	if err != nil {
+		http.Error(w, "failed to list api keys", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// RevokeAPIKey revokes a tenant's API key with immediate effect.
+func RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req RevokeAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	tenantID, ok := bindTenant(w, r, req.TenantID)
+	if !ok {
+		return
+	}
+	req.TenantID = tenantID
+	sub, ok := requireAdmin(w, r, req.TenantID, actionAPIKeyRevoke)
+	if !ok {
+		return
+	}
+	k, ok := loadTenantKey(w, r, req.TenantID, req.ID)
+	if !ok {
+		return
+	}
+	now := time.Now().UTC()
+	if k.RevokedAt.IsZero() || now.Before(k.RevokedAt) {
+		k.RevokedAt = now
+		if err := backend.SaveAPIKey(r.Context(), k); err != nil {
+			http.Error(w, "failed to revoke api key", http.StatusInternalServerError)
+			return
+		}
+	}
+	middleware.ForgetAPIKey(k.ID)
+	auditLogger.Log(logger.Entry{
+		Level:         "info",
+		CorrelationID: middleware.CorrelationIDFromContext(r.Context()),
+		TenantID:      req.TenantID,
+		Subject:       sub,
+		APIKey:        apiKeyOf(r),
+		Action:        "apikey_revoke",
+		Resource:      "apikey:" + k.ID,
+		Decision:      "success",
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(k)
+}
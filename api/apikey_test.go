@@ -0,0 +1,113 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bradtumy/authorization-service/internal/logger"
+	"github.com/bradtumy/authorization-service/pkg/apikey"
+)
+
+func TestAPIKeys(t *testing.T) {
+	var audit bytes.Buffer
+	defer func(l *logger.Logger) { auditLogger = l }(auditLogger)
+	auditLogger = logger.New(&audit, logger.LevelDebug)
+
+	create := func(body string) CreateAPIKeyResponse {
+		t.Helper()
+		w := httptest.NewRecorder()
+		CreateAPIKey(w, asAdmin(httptest.NewRequest(http.MethodPost, "/apikey/create", strings.NewReader(body))))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create api key: %d %s", w.Code, w.Body.String())
+		}
+		var resp CreateAPIKeyResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		return resp
+	}
+	router := SetupRouter()
+	check := func(header, value, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/check-access", strings.NewReader(body))
+		req.Header.Set(header, value)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	const access = `{"subject":"user1","resource":"file1","action":"read"}`
+
+	first := create(`{"tenantID":"default","name":"orders","ttl":"1h"}`)
+	if !strings.HasPrefix(first.Key, apikey.Prefix) || first.APIKey.ExpiresAt.IsZero() || first.APIKey.CreatedBy != "root" {
+		t.Fatalf("unexpected key %+v", first)
+	}
+
+	audit.Reset()
+	if w := check("X-API-Key", first.Key, access); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"allow":true`) {
+		t.Fatalf("expected check with the key to be allowed, got %d %s", w.Code, w.Body.String())
+	}
+	var entry logger.Entry
+	if err := json.Unmarshal(audit.Bytes(), &entry); err != nil {
+		t.Fatalf("audit entry: %v", err)
+	}
+	if entry.APIKey != first.APIKey.ID || entry.Actor != "apikey:"+first.APIKey.ID || entry.Subject != "user1" || entry.TenantID != "default" {
+		t.Fatalf("expected the audit entry to record the key, got %+v", entry)
+	}
+	if w := check("Authorization", "Bearer "+first.Key, access); w.Code != http.StatusOK {
+		t.Fatalf("expected the key to be accepted as a bearer token, got %d", w.Code)
+	}
+	if w := check("X-API-Key", first.Key, `{"resource":"file1","action":"read"}`); w.Code != http.StatusForbidden {
+		t.Fatalf("expected a check without subject to be rejected, got %d", w.Code)
+	}
+	if w := check("X-API-Key", first.Key, `{"tenantID":"acme","subject":"user1","resource":"file1","action":"read"}`); w.Code != http.StatusForbidden {
+		t.Fatalf("expected a cross-tenant check to be rejected, got %d", w.Code)
+	}
+	if w := check("X-API-Key", first.Key+"x", access); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a wrong secret to be rejected, got %d", w.Code)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/tenant/list", nil)
+	req.Header.Set("X-API-Key", first.Key)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected an endpoint the key does not allow to be rejected, got %d", w.Code)
+	}
+
+	// Rotation without grace replaces the key at once.
+	second := create(`{"tenantID":"default","rotate":"` + first.APIKey.ID + `","grace":"0s"}`)
+	if second.APIKey.Name != "orders" || second.APIKey.RotatedFrom != first.APIKey.ID {
+		t.Fatalf("expected the rotated key to inherit its name, got %+v", second.APIKey)
+	}
+	if w := check("X-API-Key", first.Key, access); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the rotated key to be rejected, got %d", w.Code)
+	}
+	if w := check("X-API-Key", second.Key, access); w.Code != http.StatusOK {
+		t.Fatalf("expected the new key to be accepted, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	ListAPIKeys(w, asAdmin(httptest.NewRequest(http.MethodGet, "/apikey/list?tenantID=default", nil)))
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "hash") || strings.Count(w.Body.String(), "revokedAt") != 1 {
+		t.Fatalf("expected keys to be listed without their hashes, got %d %s", w.Code, w.Body.String())
+	}
+	var keys []apikey.Key
+	json.NewDecoder(w.Body).Decode(&keys)
+	if len(keys) < 2 {
+		t.Fatalf("expected both keys to be listed, got %+v", keys)
+	}
+
+	w = httptest.NewRecorder()
+	RevokeAPIKey(w, asAdmin(httptest.NewRequest(http.MethodPost, "/apikey/revoke", strings.NewReader(`{"tenantID":"acme","id":"`+second.APIKey.ID+`"}`))))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected another tenant's key not to be found, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	RevokeAPIKey(w, asAdmin(httptest.NewRequest(http.MethodPost, "/apikey/revoke", strings.NewReader(`{"tenantID":"default","id":"`+second.APIKey.ID+`"}`))))
+	if w.Code != http.StatusOK {
+		t.Fatalf("revoke api key: %d %s", w.Code, w.Body.String())
+	}
+	if w := check("X-API-Key", second.Key, access); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the revoked key to be rejected, got %d", w.Code)
+	}
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/bradtumy/authorization-service/internal/logger"
+	"github.com/bradtumy/authorization-service/internal/middleware"
+)
+
+// bindTenant resolves the tenant a request acts in. Callers whose token binds
+// them to tenants may only name one of those; when they name none and are
+// bound to exactly one, it is used. A cross-tenant request is audited and
+// rejected with 403, in which case bindTenant returns false.
+func bindTenant(w http.ResponseWriter, r *http.Request, tenantID string) (string, bool) {
+	claims, ok := middleware.ClaimsFromContext(r.Context())
+	if !ok || claims.InTenant(tenantID) {
+		return tenantID, true
+	}
+	if tenantID == "" && len(claims.Tenants) == 1 {
+		return claims.Tenants[0], true
+	}
+	reason := fmt.Sprintf("cross-tenant request: %s is not bound to tenant %q", claims.Subject, tenantID)
+	if len(claims.Tenants) == 0 {
+		reason = fmt.Sprintf("cross-tenant request: token of %s is not bound to any tenant", claims.Subject)
+	}
+	auditLogger.Log(logger.Entry{
+		Level:         "warn",
+		CorrelationID: middleware.CorrelationIDFromContext(r.Context()),
+		TenantID:      tenantID,
+		Subject:       claims.Subject,
+		APIKey:        claims.APIKey,
+		Action:        r.URL.Path,
+		Decision:      "deny",
+		Reason:        reason,
+	})
+	http.Error(w, reason, http.StatusForbidden)
+	return "", false
+}
+
+// boundTenants returns the tenants the caller is bound to, or nil when the
+// caller may act in any tenant.
+func boundTenants(r *http.Request) []string {
+	claims, ok := middleware.ClaimsFromContext(r.Context())
+	if !ok || !claims.Verified || !claims.TenantBound {
+		return nil
+	}
+	return append([]string{}, claims.Tenants...)
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bradtumy/authorization-service/internal/logger"
+	"github.com/bradtumy/authorization-service/internal/middleware"
+	"github.com/bradtumy/authorization-service/pkg/policy"
+)
+
+func TestTenantBinding(t *testing.T) {
+	var audit bytes.Buffer
+	defer func(l *logger.Logger) { auditLogger = l }(auditLogger)
+	auditLogger = logger.New(&audit, logger.LevelDebug)
+
+	bound := middleware.Claims{Subject: "user1", Verified: true, TenantBound: true, Tenants: []string{"default"}}
+	withClaims := func(r *http.Request, c middleware.Claims) *http.Request {
+		return r.WithContext(middleware.WithClaims(r.Context(), c))
+	}
+	check := func(c middleware.Claims, tenantID string) *httptest.ResponseRecorder {
+		body := `{"tenantID":"` + tenantID + `","resource":"file1","action":"read"}`
+		w := httptest.NewRecorder()
+		CheckAccess(w, withClaims(httptest.NewRequest(http.MethodPost, "/check-access", strings.NewReader(body)), c))
+		return w
+	}
+
+	w := check(bound, "")
+	var dec policy.Decision
+	json.NewDecoder(w.Body).Decode(&dec)
+	if w.Code != http.StatusOK || !dec.Allow || dec.Context["tenantID"] != "default" {
+		t.Fatalf("expected the bound tenant to be used, got %d %+v", w.Code, dec)
+	}
+	if w := check(bound, "default"); w.Code != http.StatusOK {
+		t.Fatalf("expected the bound tenant to be accepted, got %d", w.Code)
+	}
+
+	audit.Reset()
+	w = check(bound, "acme")
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "cross-tenant request") {
+		t.Fatalf("expected cross-tenant request to be rejected, got %d %s", w.Code, w.Body.String())
+	}
+	var entry logger.Entry
+	if err := json.Unmarshal(audit.Bytes(), &entry); err != nil {
+		t.Fatalf("audit entry: %v", err)
+	}
+	if entry.Level != "warn" || entry.Decision != "deny" || entry.TenantID != "acme" || entry.Subject != "user1" {
+		t.Fatalf("unexpected audit entry %+v", entry)
+	}
+
+	// A bound provider whose token lacks the tenant claim grants no tenant.
+	unbound := middleware.Claims{Subject: "user1", Verified: true, TenantBound: true}
+	if w := check(unbound, "default"); w.Code != http.StatusForbidden {
+		t.Fatalf("expected a token without tenants to be rejected, got %d", w.Code)
+	}
+	// Callers of providers without a binding may name any tenant.
+	if w := check(middleware.Claims{Subject: "user1", Verified: true}, "default"); w.Code != http.StatusOK {
+		t.Fatalf("expected unbound caller to be accepted, got %d", w.Code)
+	}
+
+	// Admin endpoints are bound the same way.
+	w = httptest.NewRecorder()
+	ListUsers(w, withClaims(httptest.NewRequest(http.MethodGet, "/user/list?tenantID=acme", nil), bound))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected cross-tenant admin request to be rejected, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	ListTenants(w, withClaims(httptest.NewRequest(http.MethodGet, "/tenant/list", nil), bound))
+	var tenants []Tenant
+	json.NewDecoder(w.Body).Decode(&tenants)
+	for _, tn := range tenants {
+		if tn.ID != "default" {
+			t.Fatalf("expected only the bound tenant to be listed, got %+v", tenants)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bradtumy/authorization-service/pkg/contextprovider"
+	"github.com/bradtumy/authorization-service/pkg/geoip"
+	"github.com/bradtumy/authorization-service/pkg/network"
+)
+
+// defaultContextSteps is the chain used when no configuration selects one.
+// The risk provider is left out: it copies the caller's X-Risk-Score header,
+// so it has to be chosen explicitly.
+var defaultContextSteps = []contextprovider.StepConfig{
+	{Provider: "time"},
+	{Provider: "geoip"},
+}
+
+// initContextProviders builds the per-tenant context provider chains from
+// CONTEXT_CONFIG_FILE (configs/context.yaml by default). Without the file
+// every tenant uses the time and geoip providers.
+func initContextProviders() contextprovider.Chains {
+	var trusted []netip.Prefix
+	if list := os.Getenv("TRUSTED_PROXIES"); list != "" {
+		p, err := network.ParsePrefixes(strings.Split(list, ","))
+		if err != nil {
+			panic("invalid TRUSTED_PROXIES: " + err.Error())
+		}
+		trusted = p
+	}
+	proxyHeader, err := network.ParseProxyHeader(os.Getenv("TRUSTED_PROXY_HEADER"))
+	if err != nil {
+		panic("invalid TRUSTED_PROXY_HEADER: " + err.Error())
+	}
+	var geoDBs []*geoip.DB
+	if list := os.Getenv("GEOIP_DB"); list != "" {
+		for _, path := range strings.Split(list, ",") {
+			db, err := geoip.Open(strings.TrimSpace(path))
+			if err != nil {
+				panic("failed to open GeoIP database: " + err.Error())
+			}
+			go db.Watch(context.Background(), time.Minute)
+			geoDBs = append(geoDBs, db)
+		}
+	}
+	factories := map[string]contextprovider.Factory{
+		"time":  contextprovider.Static(contextprovider.TimeProvider{}),
+		"geoip": contextprovider.Static(contextprovider.GeoIPProvider{TrustedProxies: trusted, ProxyHeader: proxyHeader, Databases: geoDBs}),
+		"risk":  contextprovider.Static(contextprovider.RiskProvider{}),
+		"webhook": func(sc contextprovider.StepConfig) (contextprovider.ContextProvider, error) {
+			if sc.Webhook == nil {
+				return nil, errors.New("webhook section is required")
+			}
+			p, err := contextprovider.NewWebhookProvider(*sc.Webhook)
+			if err != nil {
+				return nil, err
+			}
+			p.TrustedProxies = trusted
+			p.ProxyHeader = proxyHeader
+			return p, nil
+		},
+		"device": func(sc contextprovider.StepConfig) (contextprovider.ContextProvider, error) {
+			var cfg contextprovider.DeviceConfig
+			if sc.Device != nil {
+				cfg = *sc.Device
+			}
+			return contextprovider.NewDevicePostureProvider(cfg)
+		},
+	}
+
+	path := os.Getenv("CONTEXT_CONFIG_FILE")
+	if path == "" {
+		path = "configs/context.yaml"
+	}
+	cfg, err := contextprovider.LoadConfig(path)
+	if os.IsNotExist(err) {
+		cfg, err = &contextprovider.Config{}, nil
+	}
+	if err != nil {
+		panic("failed to load context provider config: " + err.Error())
+	}
+	if cfg.Default == nil {
+		cfg.Default = defaultContextSteps
+	}
+	chains, err := cfg.Build(factories)
+	if err != nil {
+		panic("invalid context provider config: " + err.Error())
+	}
+	return chains
+}
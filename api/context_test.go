@@ -0,0 +1,269 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bradtumy/authorization-service/pkg/contextprovider"
+	"github.com/bradtumy/authorization-service/pkg/graph"
+	"github.com/bradtumy/authorization-service/pkg/policy"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type unavailableProvider struct{}
+
+func (unavailableProvider) GetContext(*http.Request) (map[string]string, error) {
+	return nil, errors.New("posture service unavailable")
+}
+
+func TestCheckAccessContextProviderFailure(t *testing.T) {
+	saved := contextChains
+	defer func() { contextChains = saved }()
+
+	check := func(failClosed bool) policy.Decision {
+		contextChains = contextprovider.Chains{Tenants: map[string]contextprovider.Chain{
+			"default": {{Name: "device", Provider: unavailableProvider{}, FailClosed: failClosed}},
+		}}
+		body := `{"tenantID":"default","subject":"user1","resource":"file1","action":"read"}`
+		w := httptest.NewRecorder()
+		CheckAccess(w, httptest.NewRequest(http.MethodPost, "/check-access", strings.NewReader(body)))
+		var dec policy.Decision
+		if err := json.NewDecoder(w.Body).Decode(&dec); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if dec.ContextErrors["device"] != "posture service unavailable" {
+			t.Fatalf("expected provider error in decision, got %+v", dec)
+		}
+		return dec
+	}
+
+	if dec := check(false); !dec.Allow {
+		t.Fatalf("expected fail-open provider to be ignored, got %+v", dec)
+	}
+	// A shadow set is not compared with decisions that failed closed.
+	shadow := policy.NewPolicyStore()
+	if err := shadow.LoadPolicyData([]byte(shadowAllowYAML)); err != nil {
+		t.Fatalf("load shadow: %v", err)
+	}
+	shadowMu.Lock()
+	shadows["default"] = shadowSet{store: shadow, engine: policy.NewPolicyEngine(shadow, policyGraphs["default"])}
+	shadowMu.Unlock()
+	defer clearShadow("default")
+	counter := shadowEval.WithLabelValues("default", "deny", "none", "shadow-allow")
+	before := testutil.ToFloat64(counter)
+	if dec := check(true); dec.Allow || dec.Reason != "context unavailable" {
+		t.Fatalf("expected fail-closed provider to deny, got %+v", dec)
+	}
+	if got := testutil.ToFloat64(counter); got != before {
+		t.Fatalf("expected no shadow disagreement for a failed-closed decision, got %v", got-before)
+	}
+}
+
+const shadowAllowYAML = `roles:
+  - name: "reader"
+    policies: ["shadow-allow"]
+users:
+  - username: "user1"
+    roles: ["reader"]
+policies:
+  - id: "shadow-allow"
+    resource: ["file1"]
+    action: ["read"]
+    effect: "allow"
+`
+
+func TestCheckAccessCallerTime(t *testing.T) {
+	store := policy.NewPolicyStore()
+	err := store.LoadPolicyData([]byte(`roles:
+  - name: "reader"
+    policies: ["read-archive"]
+users:
+  - username: "user1"
+    roles: ["reader"]
+policies:
+  - id: "read-archive"
+    resource: ["archive"]
+    action: ["read"]
+    effect: "allow"
+    conditions:
+      time: "y2k"
+schedules:
+  y2k:
+    not_after: "2000-12-31"
+`))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	g := graph.New()
+	policyStores["sched"], policyGraphs["sched"], policyEngines["sched"] = store, g, policy.NewPolicyEngine(store, g)
+	saved := contextChains
+	contextChains = contextprovider.Chains{Tenants: map[string]contextprovider.Chain{"sched": {}}}
+	defer func() {
+		contextChains = saved
+		delete(policyStores, "sched")
+		delete(policyGraphs, "sched")
+		delete(policyEngines, "sched")
+	}()
+
+	// Without a time provider the caller cannot choose the evaluation time.
+	body := `{"tenantID":"sched","subject":"user1","resource":"archive","action":"read","conditions":{"time":"2000-06-01T10:00:00Z"}}`
+	w := httptest.NewRecorder()
+	CheckAccess(w, httptest.NewRequest(http.MethodPost, "/check-access", strings.NewReader(body)))
+	var dec policy.Decision
+	json.NewDecoder(w.Body).Decode(&dec)
+	if dec.Allow || dec.Reason != "time" {
+		t.Fatalf("expected the caller-supplied time to be ignored, got %+v", dec)
+	}
+}
+
+func TestCheckAccessCallerDevice(t *testing.T) {
+	store := policy.NewPolicyStore()
+	err := store.LoadPolicyData([]byte(`roles:
+  - name: "payroll"
+    policies: ["managed-only"]
+users:
+  - username: "user1"
+    roles: ["payroll"]
+policies:
+  - id: "managed-only"
+    resource: ["payroll"]
+    action: ["read"]
+    effect: "allow"
+    conditions:
+      device.managed: "true"
+`))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	g := graph.New()
+	policyStores["devices"], policyGraphs["devices"], policyEngines["devices"] = store, g, policy.NewPolicyEngine(store, g)
+	saved := contextChains
+	contextChains = contextprovider.Chains{Tenants: map[string]contextprovider.Chain{"devices": {}}}
+	defer func() {
+		contextChains = saved
+		delete(policyStores, "devices")
+		delete(policyGraphs, "devices")
+		delete(policyEngines, "devices")
+	}()
+
+	// Device attributes come from the device provider only.
+	body := `{"tenantID":"devices","subject":"user1","resource":"payroll","action":"read","conditions":{"device.managed":"true"}}`
+	w := httptest.NewRecorder()
+	CheckAccess(w, httptest.NewRequest(http.MethodPost, "/check-access", strings.NewReader(body)))
+	var dec policy.Decision
+	json.NewDecoder(w.Body).Decode(&dec)
+	if dec.Allow {
+		t.Fatalf("expected the caller-supplied device attribute to be ignored, got %+v", dec)
+	}
+}
+
+func TestCheckAccessCallerLocation(t *testing.T) {
+	saved := contextChains
+	defer func() {
+		contextChains = saved
+		delete(policyStores, "geo")
+		delete(policyGraphs, "geo")
+		delete(policyEngines, "geo")
+	}()
+	// Without a database the provider sets no location, so the caller's
+	// value must not stand in for it, whatever the step's namespace.
+	for namespace, key := range map[string]string{"": "geo_country", "geo": "geo.country"} {
+		store := policy.NewPolicyStore()
+		err := store.LoadPolicyData([]byte(`roles:
+  - name: "domestic"
+    policies: ["us-only"]
+users:
+  - username: "user1"
+    roles: ["domestic"]
+policies:
+  - id: "us-only"
+    resource: ["ledger"]
+    action: ["read"]
+    effect: "allow"
+    conditions:
+      ` + key + `: "US"
+`))
+		if err != nil {
+			t.Fatalf("load: %v", err)
+		}
+		g := graph.New()
+		policyStores["geo"], policyGraphs["geo"], policyEngines["geo"] = store, g, policy.NewPolicyEngine(store, g)
+		contextChains = contextprovider.Chains{Tenants: map[string]contextprovider.Chain{
+			"geo": {{Name: "geoip", Provider: contextprovider.GeoIPProvider{}, Namespace: namespace}},
+		}}
+
+		body := `{"tenantID":"geo","subject":"user1","resource":"ledger","action":"read","conditions":{"` + key + `":"US"}}`
+		w := httptest.NewRecorder()
+		CheckAccess(w, httptest.NewRequest(http.MethodPost, "/check-access", strings.NewReader(body)))
+		var dec policy.Decision
+		json.NewDecoder(w.Body).Decode(&dec)
+		if dec.Allow {
+			t.Fatalf("expected the caller-supplied %s to be ignored, got %+v", key, dec)
+		}
+	}
+}
+
+func TestCheckAccessCallerIP(t *testing.T) {
+	saved := contextChains
+	defer func() {
+		contextChains = saved
+		delete(policyStores, "zoned")
+		delete(policyGraphs, "zoned")
+		delete(policyEngines, "zoned")
+	}()
+	store := policy.NewPolicyStore()
+	err := store.LoadPolicyData([]byte(`roles:
+  - name: "staff"
+    policies: ["corp-only"]
+users:
+  - username: "user1"
+    roles: ["staff"]
+policies:
+  - id: "corp-only"
+    resource: ["console"]
+    action: ["manage"]
+    effect: "allow"
+    when:
+      - context.ip in zone("corp")
+      - context.ip in cidr("10.0.0.0/8")
+zones:
+  corp: ["10.1.0.0/16"]
+`))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	g := graph.New()
+	policyStores["zoned"], policyGraphs["zoned"], policyEngines["zoned"] = store, g, policy.NewPolicyEngine(store, g)
+	chains := map[string]contextprovider.Chain{
+		"namespaced": {{Name: "geoip", Provider: contextprovider.GeoIPProvider{}, Namespace: "geo"}},
+		"absent":     {{Name: "time", Provider: contextprovider.TimeProvider{}}},
+	}
+	for name, chain := range chains {
+		contextChains = contextprovider.Chains{Tenants: map[string]contextprovider.Chain{"zoned": chain}}
+		body := `{"tenantID":"zoned","subject":"user1","resource":"console","action":"manage","conditions":{"ip":"10.1.2.3","geo.ip":"10.1.2.3"}}`
+		w := httptest.NewRecorder()
+		CheckAccess(w, httptest.NewRequest(http.MethodPost, "/check-access", strings.NewReader(body)))
+		var dec policy.Decision
+		json.NewDecoder(w.Body).Decode(&dec)
+		if dec.Allow {
+			t.Fatalf("%s: expected the caller-supplied ip to be ignored, got %+v", name, dec)
+		}
+	}
+}
+
+func TestDefaultContextChainOmitsRisk(t *testing.T) {
+	t.Setenv("CONTEXT_CONFIG_FILE", t.TempDir()+"/missing.yaml")
+	chain := initContextProviders().For("acme")
+	if len(chain) == 0 {
+		t.Fatalf("expected a default chain")
+	}
+	for _, step := range chain {
+		if step.Name == "risk" {
+			t.Fatalf("the default chain must not trust the caller's X-Risk-Score header")
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bradtumy/authorization-service/internal/logger"
+	"github.com/bradtumy/authorization-service/internal/middleware"
+	"github.com/bradtumy/authorization-service/pkg/policy"
+	"github.com/bradtumy/authorization-service/pkg/policystore"
+)
+
+var (
+	gitStore     *policystore.GitStore
+	gitPolicyDir string
+	gitMu        sync.Mutex
+)
+
+// PolicyVersionResponse reports the revision of the policies active for a tenant.
+type PolicyVersionResponse struct {
+	TenantID string `json:"tenantID"`
+	Backend  string `json:"backend"`
+	Revision int    `json:"revision,omitempty"`
+	Commit   string `json:"commit,omitempty"`
+}
+
+// initGitPolicies clones the policy repository configured through
+// POLICY_GIT_URL and loads every tenant found in it.
+func initGitPolicies() error {
+	url := os.Getenv("POLICY_GIT_URL")
+	if url == "" {
+		return fmt.Errorf("POLICY_GIT_URL is required when POLICY_BACKEND=git")
+	}
+	path := os.Getenv("POLICY_GIT_PATH")
+	if path == "" {
+		dir, err := os.MkdirTemp("", "policies-*")
+		if err != nil {
+			return err
+		}
+		path = dir + "/repo"
+	}
+	gitPolicyDir = os.Getenv("POLICY_GIT_DIR")
+	gs, err := policystore.CloneRepo(url, os.Getenv("POLICY_GIT_BRANCH"), path)
+	if err != nil {
+		return err
+	}
+	gitStore = gs
+	return loadPoliciesFromGit(context.Background())
+}
+
+// loadPoliciesFromGit parses every tenant policy file in the checkout and
+// only swaps them into the tenant stores if all of them are valid, so a
+// commit is never applied to some tenants only. The system tenant's policies
+// always come from SYSTEM_POLICY_FILE, so a file for it in the repository is
+// ignored.
+func loadPoliciesFromGit(ctx context.Context) error {
+	gitMu.Lock()
+	defer gitMu.Unlock()
+	files, err := gitStore.TenantFiles(gitPolicyDir)
+	if err != nil {
+		return err
+	}
+	sets := make(map[string]*policy.PolicySet, len(files))
+	for tenantID, file := range files {
+		if tenantID == systemTenant {
+			log.Printf("git policy sync: ignoring %s, the system tenant is loaded from SYSTEM_POLICY_FILE", file)
+			continue
+		}
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		set, err := policy.ParsePolicySet(b)
+		if err != nil {
+			return fmt.Errorf("tenant %s: %w", tenantID, err)
+		}
+		sets[tenantID] = set
+	}
+	for tenantID := range sets {
+		if _, ok := tenantStore(tenantID); ok {
+			continue
+		}
+		t := Tenant{ID: tenantID, Name: tenantID, CreatedAt: time.Now()}
+		if err := backend.SaveTenant(ctx, t); err != nil {
+			return err
+		}
+	}
+	sha := gitStore.CommitSHA()
+	tenantMu.Lock()
+	defer tenantMu.Unlock()
+	for tenantID, set := range sets {
+		st, ok := policyStores[tenantID]
+		if !ok {
+			st = addTenant(tenantID, files[tenantID])
+		}
+		policyFiles[tenantID] = files[tenantID]
+		st.LoadPolicySet(set, "git", sha)
+	}
+	return nil
+}
+
+// syncGitPolicies pulls the tracked branch and reloads policies when the
+// revision changed. On validation failure the previous policies stay active.
+func syncGitPolicies(ctx context.Context) (bool, error) {
+	changed, err := gitStore.PullLatest()
+	if err != nil || !changed {
+		return false, err
+	}
+	if err := loadPoliciesFromGit(ctx); err != nil {
+		auditLogger.Log(logger.Entry{
+			Level:         "error",
+			CorrelationID: middleware.CorrelationIDFromContext(ctx),
+			Action:        "reload",
+			Resource:      "git",
+			Reason:        err.Error(),
+			Commit:        gitStore.CommitSHA(),
+		})
+		return false, err
+	}
+	auditLogger.Log(logger.Entry{
+		Level:         "info",
+		CorrelationID: middleware.CorrelationIDFromContext(ctx),
+		Action:        "reload",
+		Resource:      "git",
+		Decision:      "success",
+		Commit:        gitStore.CommitSHA(),
+	})
+	return true, nil
+}
+
+func watchGit() {
+	interval := time.Minute
+	if s := os.Getenv("POLICY_GIT_INTERVAL"); s != "" {
+		if d, err := time.ParseDuration(s); err == nil && d > 0 {
+			interval = d
+		}
+	}
+	ticker := time.NewTicker(interval)
+	for range ticker.C {
+		if _, err := syncGitPolicies(context.Background()); err != nil {
+			log.Printf("git policy sync failed: %v", err)
+		}
+	}
+}
+
+// GitWebhook handles push notifications from the policy repository and
+// triggers an immediate pull. The payload must carry a valid
+// X-Hub-Signature-256 HMAC keyed with POLICY_GIT_WEBHOOK_SECRET; without a
+// secret the webhook is disabled.
+func GitWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "GitWebhook")
+	defer span.End()
+	secret := os.Getenv("POLICY_GIT_WEBHOOK_SECRET")
+	if gitStore == nil || secret == "" {
+		http.Error(w, "git webhook not enabled", http.StatusNotFound)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !validSignature(secret, body, r.Header.Get("X-Hub-Signature-256")) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	if ev := r.Header.Get("X-GitHub-Event"); ev != "" && ev != "push" {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	changed, err := syncGitPolicies(ctx)
+	if err != nil {
+		http.Error(w, "failed to sync policies: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"commit": gitStore.CommitSHA(), "changed": changed})
+}
+
+func validSignature(secret string, body []byte, header string) bool {
+	sig, err := hex.DecodeString(strings.TrimPrefix(header, "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(sig, mac.Sum(nil))
+}
+
+// PolicyVersion returns the revision of the policies loaded for a tenant.
+func PolicyVersion(w http.ResponseWriter, r *http.Request) {
+	tenantID, ok := bindTenant(w, r, r.URL.Query().Get("tenantID"))
+	if !ok {
+		return
+	}
+	if tenantID == "" {
+		tenantID = "default"
+	}
+	st, ok := tenantStore(tenantID)
+	if !ok {
+		http.Error(w, "tenant not found", http.StatusNotFound)
+		return
+	}
+	resp := PolicyVersionResponse{TenantID: tenantID, Backend: policyBackend}
+	if rev, ok := st.ActiveRevision(); ok {
+		resp.Revision = rev.Number
+		resp.Commit = rev.Commit
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bradtumy/authorization-service/pkg/policy"
+)
+
+const gitTenantPolicy = `roles:
+  - name: "admin"
+    policies: ["p1"]
+users:
+  - username: "alice"
+    roles: ["admin"]
+policies:
+  - id: "p1"
+    subjects:
+      - role: "admin"
+    resource: ["file1"]
+    action: ["read"]
+    effect: "%s"
+`
+
+func pushPolicy(t *testing.T, work, rel, content string) {
+	t.Helper()
+	path := filepath.Join(work, rel)
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	for _, args := range [][]string{
+		{"add", "-A"},
+		{"commit", "-m", "update"},
+		{"push", "origin", "HEAD:main"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", work, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+}
+
+func TestGitPolicyBackend(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	tmp := t.TempDir()
+	bare := filepath.Join(tmp, "policies.git")
+	work := filepath.Join(tmp, "work")
+	if out, err := exec.Command("git", "init", "--bare", "-b", "main", bare).CombinedOutput(); err != nil {
+		t.Fatalf("init bare: %v: %s", err, out)
+	}
+	if out, err := exec.Command("git", "clone", bare, work).CombinedOutput(); err != nil {
+		t.Fatalf("clone: %v: %s", err, out)
+	}
+	pushPolicy(t, work, "gitacme/policies.yaml", fmt.Sprintf(gitTenantPolicy, "deny"))
+
+	t.Setenv("POLICY_GIT_URL", "file://"+bare)
+	t.Setenv("POLICY_GIT_PATH", filepath.Join(tmp, "checkout"))
+	t.Setenv("POLICY_GIT_WEBHOOK_SECRET", "")
+	t.Setenv("POLICY_GIT_DIR", "")
+	if err := initGitPolicies(); err != nil {
+		t.Fatalf("initGitPolicies: %v", err)
+	}
+	defer func() {
+		gitStore = nil
+		for _, id := range []string{"gitacme", "gitbeta"} {
+			delete(policyStores, id)
+			delete(policyEngines, id)
+			delete(policyGraphs, id)
+			delete(policyFiles, id)
+		}
+	}()
+
+	first := gitStore.CommitSHA()
+	dec := policyEngines["gitacme"].Evaluate("alice", "file1", "read", nil)
+	if dec.Allow || dec.Commit != first {
+		t.Fatalf("expected deny stamped with %s, got %#v", first, dec)
+	}
+
+	// An invalid revision must leave the previous policies active.
+	pushPolicy(t, work, "gitacme/policies.yaml", "policies:\n  - id: \"\"\n")
+	if _, err := syncGitPolicies(context.Background()); err == nil {
+		t.Fatalf("expected validation error for invalid revision")
+	}
+	if got := policyStores["gitacme"].Commit(); got != first {
+		t.Fatalf("expected commit %s to stay active, got %s", first, got)
+	}
+
+	// A commit that breaks one tenant is applied to none of them.
+	os.WriteFile(filepath.Join(work, "gitacme/policies.yaml"), []byte(fmt.Sprintf(gitTenantPolicy, "allow")), 0644)
+	pushPolicy(t, work, "gitbeta/policies.yaml", "policies:\n  - id: \"\"\n")
+	if _, err := syncGitPolicies(context.Background()); err == nil {
+		t.Fatalf("expected validation error for the broken tenant")
+	}
+	if got := policyStores["gitacme"].Commit(); got != first {
+		t.Fatalf("expected commit %s to stay active for the valid tenant, got %s", first, got)
+	}
+	if _, ok := policyStores["gitbeta"]; ok {
+		t.Fatalf("expected the broken tenant not to be created")
+	}
+
+	pushPolicy(t, work, "gitbeta/policies.yaml", fmt.Sprintf(gitTenantPolicy, "deny"))
+	webhook := func(sig string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/git", strings.NewReader(`{}`))
+		req.Header.Set("X-Hub-Signature-256", sig)
+		w := httptest.NewRecorder()
+		GitWebhook(w, req)
+		return w
+	}
+	if w := webhook(""); w.Code != http.StatusNotFound {
+		t.Fatalf("expected the webhook to be disabled without a secret, got %d", w.Code)
+	}
+	t.Setenv("POLICY_GIT_WEBHOOK_SECRET", "hook-secret")
+	if w := webhook("sha256=00"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected an invalid signature to be rejected, got %d", w.Code)
+	}
+	mac := hmac.New(sha256.New, []byte("hook-secret"))
+	mac.Write([]byte(`{}`))
+	w := webhook("sha256=" + hex.EncodeToString(mac.Sum(nil)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("webhook status %d: %s", w.Code, w.Body.String())
+	}
+	var dec2 policy.Decision
+	body := `{"tenantID":"gitacme","subject":"alice","resource":"file1","action":"read","conditions":{}}`
+	rw := httptest.NewRecorder()
+	CheckAccess(rw, httptest.NewRequest(http.MethodPost, "/check-access", strings.NewReader(body)))
+	if err := json.NewDecoder(rw.Body).Decode(&dec2); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !dec2.Allow || dec2.Commit == first || dec2.Commit != gitStore.CommitSHA() {
+		t.Fatalf("expected allow stamped with new commit, got %#v", dec2)
+	}
+
+	// The system tenant's policies never come from the repository.
+	sysFile := policyFiles[systemTenant]
+	sysRev, _ := policyStores[systemTenant].ActiveRevision()
+	pushPolicy(t, work, systemTenant+"/policies.yaml", fmt.Sprintf(gitTenantPolicy, "allow"))
+	if _, err := syncGitPolicies(context.Background()); err != nil {
+		t.Fatalf("sync with a system tenant file: %v", err)
+	}
+	if rev, _ := policyStores[systemTenant].ActiveRevision(); rev.Number != sysRev.Number || rev.Commit != "" {
+		t.Fatalf("expected the system policies to stay at revision %d, got %#v", sysRev.Number, rev)
+	}
+	if policyFiles[systemTenant] != sysFile {
+		t.Fatalf("expected the system policy file to stay %s, got %s", sysFile, policyFiles[systemTenant])
+	}
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bradtumy/authorization-service/internal/middleware"
+)
+
+// OIDCHealth reports the key sets of the configured OIDC providers. It
+// responds with 503 when the providers failed to load or a provider has no
+// usable keys or failed its last refresh.
+func OIDCHealth(w http.ResponseWriter, r *http.Request) {
+	providers, err := middleware.OIDCStatus()
+	resp := struct {
+		Status    string                      `json:"status"`
+		Error     string                      `json:"error,omitempty"`
+		Providers []middleware.ProviderStatus `json:"providers"`
+	}{Status: "ok", Providers: providers}
+	switch {
+	case err != nil:
+		resp.Status, resp.Error = "unavailable", err.Error()
+	case len(providers) == 0:
+		resp.Status = "disabled"
+	default:
+		for _, p := range providers {
+			if !p.Ready() {
+				resp.Status = "unavailable"
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Status == "unavailable" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
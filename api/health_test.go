@@ -0,0 +1,60 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bradtumy/authorization-service/internal/middleware"
+	jose "gopkg.in/go-jose/go-jose.v2"
+)
+
+func TestOIDCHealth(t *testing.T) {
+	t.Cleanup(func() { middleware.LoadOIDCConfig() })
+	dir := t.TempDir()
+	cfg := filepath.Join(dir, "oidc.yaml")
+	t.Setenv("OIDC_ISSUERS", "")
+	t.Setenv("OIDC_CONFIG_FILE", cfg)
+
+	type health struct {
+		Status    string                      `json:"status"`
+		Error     string                      `json:"error"`
+		Providers []middleware.ProviderStatus `json:"providers"`
+	}
+	check := func(config string) (int, health) {
+		t.Helper()
+		os.WriteFile(cfg, []byte(config), 0o600)
+		middleware.LoadOIDCConfig()
+		w := httptest.NewRecorder()
+		SetupRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health/oidc", nil))
+		var h health
+		json.NewDecoder(w.Body).Decode(&h)
+		return w.Code, h
+	}
+
+	if code, h := check("providers: []\n"); code != http.StatusOK || h.Status != "disabled" {
+		t.Fatalf("expected disabled status without providers, got %d %+v", code, h)
+	}
+
+	priv, _ := rsa.GenerateKey(rand.Reader, 2048)
+	jwks, _ := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &priv.PublicKey, KeyID: "k1", Algorithm: "RS256", Use: "sig"}}})
+	jwksPath := filepath.Join(dir, "jwks.json")
+	os.WriteFile(jwksPath, jwks, 0o600)
+	code, h := check("providers:\n  - issuer: https://idp.internal\n    jwks_file: " + jwksPath + "\n")
+	if code != http.StatusOK || h.Status != "ok" || len(h.Providers) != 1 {
+		t.Fatalf("expected healthy provider, got %d %+v", code, h)
+	}
+	if p := h.Providers[0]; p.Issuer != "https://idp.internal" || p.Source != "jwks_file" || len(p.KIDs) != 1 || p.KIDs[0] != "k1" || p.LoadedAt.IsZero() {
+		t.Fatalf("unexpected provider status %+v", p)
+	}
+
+	code, h = check("providers:\n  - issuer: https://idp.internal\n    jwks_file: " + filepath.Join(dir, "missing.json") + "\n")
+	if code != http.StatusServiceUnavailable || h.Status != "unavailable" || h.Error == "" {
+		t.Fatalf("expected unavailable status after a failed load, got %d %+v", code, h)
+	}
+}
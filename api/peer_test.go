@@ -0,0 +1,73 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bradtumy/authorization-service/internal/middleware"
+	"github.com/bradtumy/authorization-service/pkg/user"
+)
+
+func TestClientCertificateAdmin(t *testing.T) {
+	const deployer = "spiffe://mesh.local/ns/ops/sa/deployer"
+	t.Cleanup(func() { middleware.LoadOIDCConfig() })
+	t.Setenv("TLS_PEER_TENANTS", "spiffe://mesh.local/ns/ops=default;CN=deployer=default")
+	if err := middleware.LoadOIDCConfig(); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	user.Create(systemTenant, deployer, []string{"Deployer"})
+	user.Create(systemTenant, "CN=deployer", []string{"Deployer"})
+	defer func() {
+		user.Delete(systemTenant, deployer)
+		user.Delete(systemTenant, "CN=deployer")
+	}()
+	st := policyStores[systemTenant]
+	defer func() {
+		if err := st.LoadPolicies(policyFiles[systemTenant]); err != nil {
+			t.Fatalf("restore system policies: %v", err)
+		}
+	}()
+	err := st.LoadPolicyData([]byte(`roles:
+  - name: "Deployer"
+    policies: ["mesh-reload"]
+policies:
+  - id: "mesh-reload"
+    resource: ["tenant:default"]
+    action: ["policy:reload"]
+    effect: "allow"
+    when:
+      - context.auth.spiffe_id == "` + deployer + `"
+`))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	router := SetupRouter()
+	reload := func(cert *x509.Certificate) int {
+		r := httptest.NewRequest(http.MethodPost, "/reload", strings.NewReader(`{"tenantID":"default"}`))
+		r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+	id, _ := url.Parse(deployer)
+	if code := reload(&x509.Certificate{URIs: []*url.URL{id}}); code != http.StatusOK {
+		t.Fatalf("expected the SPIFFE caller to reload, got %d", code)
+	}
+	if code := reload(&x509.Certificate{Subject: pkix.Name{CommonName: "deployer"}}); code != http.StatusForbidden {
+		t.Fatalf("expected a caller without the SPIFFE ID to be forbidden, got %d", code)
+	}
+	// Certificates not bound to the tenant cannot act in it.
+	user.Create(systemTenant, "spiffe://mesh.local/ns/shop/sa/orders", []string{"SystemAdmin"})
+	defer user.Delete(systemTenant, "spiffe://mesh.local/ns/shop/sa/orders")
+	orders, _ := url.Parse("spiffe://mesh.local/ns/shop/sa/orders")
+	if code := reload(&x509.Certificate{URIs: []*url.URL{orders}}); code != http.StatusForbidden {
+		t.Fatalf("expected an unbound certificate to be forbidden, got %d", code)
+	}
+}
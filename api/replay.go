@@ -0,0 +1,66 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/bradtumy/authorization-service/pkg/policy"
+	"github.com/bradtumy/authorization-service/pkg/replay"
+)
+
+// ReplayRequest replays recorded decisions against a candidate policy set.
+// Log holds JSON lines in the audit log or /check-access request format.
+type ReplayRequest struct {
+	TenantID string `json:"tenantID"`
+	Policy   string `json:"policy"`
+	Log      string `json:"log"`
+}
+
+// ReplayPolicies reports which recorded decisions would flip under the
+// candidate policies. Records without a recorded decision are compared with
+// the tenant's live policies.
+func ReplayPolicies(w http.ResponseWriter, r *http.Request) {
+	_, span := tracer.Start(r.Context(), "ReplayPolicies")
+	defer span.End()
+	var req ReplayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	tenantID, ok := bindTenant(w, r, req.TenantID)
+	if !ok {
+		return
+	}
+	req.TenantID = tenantID
+	if _, ok := requireAdmin(w, r, req.TenantID, actionPolicyReplay); !ok {
+		return
+	}
+	live, ok := tenantEngine(req.TenantID)
+	g, _ := tenantGraph(req.TenantID)
+	if !ok {
+		http.Error(w, "tenant not found", http.StatusNotFound)
+		return
+	}
+	st := policy.NewPolicyStore()
+	if err := st.LoadPolicyData([]byte(req.Policy)); err != nil {
+		http.Error(w, "invalid policy: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	records, err := replay.ReadLog(strings.NewReader(req.Log))
+	if err != nil {
+		http.Error(w, "invalid log: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	filtered := records[:0]
+	for _, rec := range records {
+		if rec.TenantID == "" || rec.TenantID == req.TenantID {
+			rec.TenantID = req.TenantID
+			filtered = append(filtered, rec)
+		}
+	}
+	candidate := policy.NewPolicyEngine(st, g)
+	report := replay.Run(candidate, live, filtered)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
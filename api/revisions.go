@@ -0,0 +1,114 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/bradtumy/authorization-service/internal/logger"
+	"github.com/bradtumy/authorization-service/internal/middleware"
+	"github.com/bradtumy/authorization-service/pkg/policy"
+)
+
+// RevisionRequest selects a policy revision for a tenant.
+type RevisionRequest struct {
+	TenantID string `json:"tenantID"`
+	Revision int    `json:"revision"`
+}
+
+// PolicyHistory lists the policy revisions retained for a tenant.
+func PolicyHistory(w http.ResponseWriter, r *http.Request) {
+	tenantID, ok := bindTenant(w, r, r.URL.Query().Get("tenantID"))
+	if !ok {
+		return
+	}
+	if tenantID == "" {
+		http.Error(w, "missing tenantID", http.StatusBadRequest)
+		return
+	}
+	if _, ok := requireAdmin(w, r, tenantID, actionPolicyHistory); !ok {
+		return
+	}
+	st, ok := tenantStore(tenantID)
+	if !ok {
+		http.Error(w, "tenant not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st.History())
+}
+
+// RollbackPolicies reactivates a previously loaded revision.
+func RollbackPolicies(w http.ResponseWriter, r *http.Request) {
+	changeRevision(w, r, "rollback")
+}
+
+// PinPolicies activates a revision and keeps it active across reloads.
+func PinPolicies(w http.ResponseWriter, r *http.Request) {
+	changeRevision(w, r, "pin")
+}
+
+// UnpinPolicies releases a pin and activates the latest revision.
+func UnpinPolicies(w http.ResponseWriter, r *http.Request) {
+	changeRevision(w, r, "unpin")
+}
+
+func changeRevision(w http.ResponseWriter, r *http.Request, action string) {
+	_, span := tracer.Start(r.Context(), "ChangeRevision")
+	defer span.End()
+	var req RevisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	tenantID, ok := bindTenant(w, r, req.TenantID)
+	if !ok {
+		return
+	}
+	req.TenantID = tenantID
+	sub, ok := requireAdmin(w, r, req.TenantID, "policy:"+action)
+	if !ok {
+		return
+	}
+	st, ok := tenantStore(req.TenantID)
+	if !ok {
+		http.Error(w, "tenant not found", http.StatusNotFound)
+		return
+	}
+	var err error
+	switch action {
+	case "rollback":
+		err = st.Rollback(req.Revision)
+	case "pin":
+		err = st.Pin(req.Revision)
+	case "unpin":
+		st.Unpin()
+	}
+	entry := logger.Entry{
+		CorrelationID: middleware.CorrelationIDFromContext(r.Context()),
+		TenantID:      req.TenantID,
+		Subject:       sub,
+		Action:        action,
+		Resource:      "revision:" + strconv.Itoa(req.Revision),
+	}
+	if err != nil {
+		entry.Level = "warn"
+		entry.Reason = err.Error()
+		auditLogger.Log(entry)
+		status := http.StatusConflict
+		if errors.Is(err, policy.ErrRevisionNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	rev, _ := st.ActiveRevision()
+	entry.Level = "info"
+	entry.Decision = "success"
+	entry.Resource = "revision:" + strconv.Itoa(rev.Number)
+	entry.Commit = rev.Commit
+	auditLogger.Log(entry)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rev)
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/bradtumy/authorization-service/internal/logger"
+	"github.com/bradtumy/authorization-service/internal/middleware"
+	"github.com/bradtumy/authorization-service/pkg/policy"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// shadowSet is the candidate policy set of a tenant.
+type shadowSet struct {
+	store  *policy.PolicyStore
+	engine *policy.PolicyEngine
+}
+
+var (
+	// shadows is read by every access check and written by the shadow
+	// endpoints and reloads, so it is guarded by shadowMu.
+	shadows    = make(map[string]shadowSet)
+	shadowMu   sync.RWMutex
+	shadowEval = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "shadow_eval_disagreement_count",
+			Help: "Number of live decisions that disagreed with the tenant's shadow policy set",
+		},
+		[]string{"tenant", "live_decision", "live_policy", "shadow_policy"},
+	)
+)
+
+// ShadowRequest loads a candidate policy set for a tenant from inline YAML.
+// Files on the service's host are deliberately not accepted: reading them on
+// behalf of a tenant administrator would expose files outside the tenant.
+type ShadowRequest struct {
+	TenantID string `json:"tenantID"`
+	Policy   string `json:"policy"`
+}
+
+// LoadShadowPolicies installs a shadow policy set that is evaluated alongside
+// live policies on every access check without affecting the response.
+func LoadShadowPolicies(w http.ResponseWriter, r *http.Request) {
+	_, span := tracer.Start(r.Context(), "LoadShadowPolicies")
+	defer span.End()
+	var req ShadowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	tenantID, ok := bindTenant(w, r, req.TenantID)
+	if !ok {
+		return
+	}
+	req.TenantID = tenantID
+	sub, ok := requireAdmin(w, r, req.TenantID, actionPolicyShadow)
+	if !ok {
+		return
+	}
+	g, ok := tenantGraph(req.TenantID)
+	if !ok {
+		http.Error(w, "tenant not found", http.StatusNotFound)
+		return
+	}
+	if strings.TrimSpace(req.Policy) == "" {
+		http.Error(w, "policy is required", http.StatusBadRequest)
+		return
+	}
+	st := policy.NewPolicyStore()
+	if err := st.LoadRevision([]byte(req.Policy), "data", ""); err != nil {
+		http.Error(w, "invalid policy: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	shadowMu.Lock()
+	shadows[req.TenantID] = shadowSet{store: st, engine: policy.NewPolicyEngine(st, g)}
+	shadowMu.Unlock()
+	auditLogger.Log(logger.Entry{
+		Level:         "info",
+		CorrelationID: middleware.CorrelationIDFromContext(r.Context()),
+		TenantID:      req.TenantID,
+		Subject:       sub,
+		Action:        "shadow_load",
+		Resource:      "data",
+		Decision:      "success",
+		Shadow:        true,
+	})
+	rev, _ := st.ActiveRevision()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rev)
+}
+
+// ClearShadowPolicies removes the shadow policy set of a tenant.
+func ClearShadowPolicies(w http.ResponseWriter, r *http.Request) {
+	var req TenantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	tenantID, ok := bindTenant(w, r, req.TenantID)
+	if !ok {
+		return
+	}
+	req.TenantID = tenantID
+	sub, ok := requireAdmin(w, r, req.TenantID, actionPolicyShadow)
+	if !ok {
+		return
+	}
+	clearShadow(req.TenantID)
+	auditLogger.Log(logger.Entry{
+		Level:         "info",
+		CorrelationID: middleware.CorrelationIDFromContext(r.Context()),
+		TenantID:      req.TenantID,
+		Subject:       sub,
+		Action:        "shadow_clear",
+		Decision:      "success",
+		Shadow:        true,
+	})
+	w.WriteHeader(http.StatusOK)
+}
+
+func clearShadow(tenantID string) {
+	shadowMu.Lock()
+	delete(shadows, tenantID)
+	shadowMu.Unlock()
+}
+
+// clearPromotedShadow drops the shadow set once the live policies were
+// reloaded with identical content.
+func clearPromotedShadow(tenantID string) {
+	shadowMu.Lock()
+	defer shadowMu.Unlock()
+	shadow, ok := shadows[tenantID]
+	if !ok {
+		return
+	}
+	st, ok := tenantStore(tenantID)
+	if !ok {
+		return
+	}
+	live, ok1 := st.ActiveRevision()
+	cand, ok2 := shadow.store.ActiveRevision()
+	if ok1 && ok2 && live.Digest == cand.Digest {
+		delete(shadows, tenantID)
+	}
+}
+
+// evaluateShadow evaluates the tenant's shadow set, if any, for the same
+// request and records a disagreement with the live decision. Live decisions
+// that failed closed on missing context were not made by the policies, so
+// they are not compared.
+func evaluateShadow(r *http.Request, req AccessRequest, live policy.Decision, failedClosed bool) {
+	if failedClosed {
+		return
+	}
+	shadowMu.RLock()
+	set, ok := shadows[req.TenantID]
+	shadowMu.RUnlock()
+	if !ok {
+		return
+	}
+	shadow := set.engine.Evaluate(req.Subject, req.Resource, req.Action, req.Conditions)
+	if shadow.Allow == live.Allow {
+		return
+	}
+	liveStatus, shadowStatus := "deny", "deny"
+	if live.Allow {
+		liveStatus = "allow"
+	}
+	if shadow.Allow {
+		shadowStatus = "allow"
+	}
+	livePolicy, shadowPolicy := policyLabel(live.PolicyID), policyLabel(shadow.PolicyID)
+	shadowEval.WithLabelValues(req.TenantID, liveStatus, livePolicy, shadowPolicy).Inc()
+	auditLogger.Log(logger.Entry{
+		Level:         "warn",
+		CorrelationID: middleware.CorrelationIDFromContext(r.Context()),
+		TenantID:      req.TenantID,
+		Subject:       req.Subject,
+		Action:        req.Action,
+		Resource:      req.Resource,
+		Decision:      shadowStatus,
+		PolicyID:      shadow.PolicyID,
+		Reason:        "shadow disagrees with live " + liveStatus + " (" + livePolicy + ")",
+		Shadow:        true,
+	})
+}
+
+func policyLabel(id string) string {
+	if id == "" {
+		return "none"
+	}
+	return id
+}
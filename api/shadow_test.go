@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bradtumy/authorization-service/internal/middleware"
+	"github.com/bradtumy/authorization-service/pkg/policy"
+	"github.com/bradtumy/authorization-service/pkg/user"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// asPolicyAdmin returns r made by name, a PolicyAdmin of tenantID.
+func asPolicyAdmin(t *testing.T, r *http.Request, tenantID, name string) *http.Request {
+	t.Helper()
+	if _, err := user.Create(tenantID, name, []string{"PolicyAdmin"}); err != nil {
+		t.Fatalf("create admin: %v", err)
+	}
+	t.Cleanup(func() { user.Delete(tenantID, name) })
+	return r.WithContext(middleware.WithClaims(r.Context(), middleware.Claims{Subject: name, Verified: true}))
+}
+
+func TestShadowPolicyDisagreement(t *testing.T) {
+	shadowYAML := `roles:
+  - name: "admin"
+    policies: ["deny-read"]
+users:
+  - username: "user1"
+    roles: ["admin"]
+policies:
+  - id: "deny-read"
+    subjects:
+      - role: "admin"
+    resource: ["*"]
+    action: ["read"]
+    effect: "deny"
+`
+	body, _ := json.Marshal(ShadowRequest{TenantID: "default", Policy: shadowYAML})
+	r := httptest.NewRequest(http.MethodPost, "/policies/shadow", strings.NewReader(string(body)))
+	w := httptest.NewRecorder()
+	LoadShadowPolicies(w, asPolicyAdmin(t, r, "default", "shadowadmin"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("load shadow status %d: %s", w.Code, w.Body.String())
+	}
+	defer clearShadow("default")
+
+	counter := shadowEval.WithLabelValues("default", "allow", "policy1", "deny-read")
+	before := testutil.ToFloat64(counter)
+	reqBody := `{"tenantID":"default","subject":"user1","resource":"file1","action":"read","conditions":{}}`
+	cw := httptest.NewRecorder()
+	CheckAccess(cw, httptest.NewRequest(http.MethodPost, "/check-access", strings.NewReader(reqBody)))
+	var dec policy.Decision
+	if err := json.NewDecoder(cw.Body).Decode(&dec); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !dec.Allow {
+		t.Fatalf("shadow set must not affect the live decision, got %#v", dec)
+	}
+	if after := testutil.ToFloat64(counter); after != before+1 {
+		t.Fatalf("expected disagreement counter to increment, before %v after %v", before, after)
+	}
+}
+
+func TestShadowPolicyRejectsFile(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/policies/shadow", strings.NewReader(`{"tenantID":"default","file":"/etc/passwd"}`))
+	w := httptest.NewRecorder()
+	LoadShadowPolicies(w, asPolicyAdmin(t, r, "default", "shadowadmin"))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a file path, got %d: %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "root") {
+		t.Fatalf("response leaked file content: %s", w.Body.String())
+	}
+	shadowMu.RLock()
+	_, loaded := shadows["default"]
+	shadowMu.RUnlock()
+	if loaded {
+		t.Fatalf("expected no shadow set to be installed")
+	}
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/bradtumy/authorization-service/internal/middleware"
+	"github.com/bradtumy/authorization-service/pkg/contextprovider"
+	"github.com/bradtumy/authorization-service/pkg/policy"
+)
+
+// Subject modes select whom CheckAccess evaluates when the caller's token is
+// verified.
+const (
+	// subjectModeSelf evaluates the caller; a different subject in the request
+	// body is rejected.
+	subjectModeSelf = "self"
+	// subjectModeOnBehalfOf also lets callers evaluate another subject when
+	// policy allows them onBehalfOfAction on "subject:<name>".
+	subjectModeOnBehalfOf = "on-behalf-of"
+)
+
+// onBehalfOfAction is the action checked before a caller may evaluate for
+// another subject.
+const onBehalfOfAction = "evaluate-on-behalf"
+
+var subjectMode = subjectModeSelf
+
+// initSubjectMode reads SUBJECT_MODE.
+func initSubjectMode() {
+	switch mode := os.Getenv("SUBJECT_MODE"); mode {
+	case "":
+		subjectMode = subjectModeSelf
+	case subjectModeSelf, subjectModeOnBehalfOf:
+		subjectMode = mode
+	default:
+		panic("invalid SUBJECT_MODE " + mode + ": must be self or on-behalf-of")
+	}
+}
+
+// resolveSubject returns the subject to evaluate for req and, when it is not
+// the caller, the caller acting on its behalf. Requests whose token was not
+// verified, which JWTMiddleware only lets through when no OIDC provider is
+// configured, are evaluated for the subject in the body. API keys are issued to
+// services checking access for their users, so their callers name the
+// subject and are recorded as its actor.
+func resolveSubject(r *http.Request, req AccessRequest, engine *policy.PolicyEngine) (subject, actor string, err error) {
+	claims, ok := middleware.ClaimsFromContext(r.Context())
+	if !ok || !claims.Verified {
+		return req.Subject, "", nil
+	}
+	caller := claims.Subject
+	if caller == "" {
+		return "", "", fmt.Errorf("token has no subject")
+	}
+	if claims.APIKey != "" {
+		if req.Subject == "" {
+			return "", "", fmt.Errorf("subject is required with an API key")
+		}
+		return req.Subject, caller, nil
+	}
+	if req.Subject == "" || req.Subject == caller {
+		return caller, "", nil
+	}
+	if subjectMode != subjectModeOnBehalfOf {
+		return "", "", fmt.Errorf("subject %s does not match the authenticated caller", req.Subject)
+	}
+	ctx := map[string]string{"tenantID": req.TenantID}
+	for k, v := range claims.Attributes {
+		ctx[k] = v
+	}
+	if dec := engine.Evaluate(caller, "subject:"+req.Subject, onBehalfOfAction, ctx); !dec.Allow {
+		return "", "", fmt.Errorf("%s may not evaluate on behalf of %s", caller, req.Subject)
+	}
+	return req.Subject, caller, nil
+}
+
+// engineKeys are the context keys set by the policy engine.
+var engineKeys = map[string]bool{"next_window": true}
+
+// builtinProviders are reserved whatever a tenant's chain holds. Without them
+// a caller-chosen time would let them pick the instant schedules are checked
+// at, and a caller-chosen ip would be matched by in zone() and in cidr(), when
+// the tenant's chain lacks the provider or names its keys with a namespace.
+var builtinProviders = contextprovider.Chain{
+	{Provider: contextprovider.TimeProvider{}},
+	{Provider: contextprovider.GeoIPProvider{}},
+	{Provider: contextprovider.RiskProvider{}},
+	{Provider: &contextprovider.DevicePostureProvider{}},
+}
+
+// providerKey reports whether k is set only by context providers, those of
+// chain or the built-in ones, or the policy engine.
+func providerKey(k string, chain contextprovider.Chain) bool {
+	return engineKeys[k] || builtinProviders.Reserved(k) || chain.Reserved(k)
+}
+
+// applyClaims replaces the values in the reserved claim namespaces of
+// conditions, which came from the request body, with the claims mapped from
+// the caller's verified token, and drops the keys context providers set. The
+// claims describe the caller, so they are left out when evaluating on behalf
+// of another subject.
+func applyClaims(r *http.Request, conditions map[string]string, actor string, chain contextprovider.Chain) {
+	for k := range conditions {
+		if middleware.Reserved(k) || providerKey(k, chain) {
+			delete(conditions, k)
+		}
+	}
+	claims, ok := middleware.ClaimsFromContext(r.Context())
+	if !ok || !claims.Verified || actor != "" {
+		return
+	}
+	for k, v := range claims.Attributes {
+		conditions[k] = v
+	}
+}
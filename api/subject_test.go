@@ -0,0 +1,212 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bradtumy/authorization-service/internal/logger"
+	"github.com/bradtumy/authorization-service/internal/middleware"
+	"github.com/bradtumy/authorization-service/pkg/graph"
+	"github.com/bradtumy/authorization-service/pkg/policy"
+	"github.com/bradtumy/authorization-service/pkg/user"
+)
+
+func TestCheckAccessSubjectModes(t *testing.T) {
+	store := policy.NewPolicyStore()
+	err := store.LoadPolicyData([]byte(`roles:
+  - name: "reader"
+    policies: ["read-file1"]
+  - name: "gateway"
+    policies: ["obo-alice"]
+users:
+  - username: "alice"
+    roles: ["reader"]
+  - username: "bob"
+    roles: []
+  - username: "svc-gateway"
+    roles: ["gateway"]
+policies:
+  - id: "read-file1"
+    resource: ["file1"]
+    action: ["read"]
+    effect: "allow"
+  - id: "obo-alice"
+    resource: ["subject:alice"]
+    action: ["evaluate-on-behalf"]
+    effect: "allow"
+`))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	g := graph.New()
+	policyStores["subjects"] = store
+	policyGraphs["subjects"] = g
+	policyEngines["subjects"] = policy.NewPolicyEngine(store, g)
+	defer func() {
+		delete(policyStores, "subjects")
+		delete(policyGraphs, "subjects")
+		delete(policyEngines, "subjects")
+	}()
+	defer func() { subjectMode = subjectModeSelf }()
+
+	check := func(claims *middleware.Claims, subject string) (int, policy.Decision) {
+		body := `{"tenantID":"subjects","subject":"` + subject + `","resource":"file1","action":"read"}`
+		r := httptest.NewRequest(http.MethodPost, "/check-access", strings.NewReader(body))
+		if claims != nil {
+			r = r.WithContext(middleware.WithClaims(r.Context(), *claims))
+		}
+		w := httptest.NewRecorder()
+		CheckAccess(w, r)
+		var dec policy.Decision
+		if w.Code == http.StatusOK {
+			json.NewDecoder(w.Body).Decode(&dec)
+		}
+		return w.Code, dec
+	}
+	alice := &middleware.Claims{Subject: "alice", Verified: true}
+	bob := &middleware.Claims{Subject: "bob", Verified: true}
+	gateway := &middleware.Claims{Subject: "svc-gateway", Verified: true}
+
+	subjectMode = subjectModeSelf
+	if code, dec := check(alice, ""); code != http.StatusOK || !dec.Allow {
+		t.Fatalf("expected the caller to be evaluated, got %d %+v", code, dec)
+	}
+	if code, _ := check(bob, "alice"); code != http.StatusForbidden {
+		t.Fatalf("expected a foreign subject to be rejected in self mode, got %d", code)
+	}
+	if code, _ := check(gateway, "alice"); code != http.StatusForbidden {
+		t.Fatalf("expected on-behalf-of to be disabled in self mode, got %d", code)
+	}
+	// Unverified development tokens fall back to the body subject.
+	if code, dec := check(&middleware.Claims{Subject: "bob"}, "alice"); code != http.StatusOK || !dec.Allow {
+		t.Fatalf("expected body subject without a verifier, got %d %+v", code, dec)
+	}
+
+	subjectMode = subjectModeOnBehalfOf
+	if code, dec := check(gateway, "alice"); code != http.StatusOK || !dec.Allow {
+		t.Fatalf("expected the gateway to evaluate for alice, got %d %+v", code, dec)
+	}
+	if code, _ := check(bob, "alice"); code != http.StatusForbidden {
+		t.Fatalf("expected callers without an on-behalf-of policy to be rejected, got %d", code)
+	}
+}
+
+func TestSimulateAccessSubject(t *testing.T) {
+	store := policy.NewPolicyStore()
+	if err := store.LoadPolicyData([]byte(`roles:
+  - name: "reader"
+    policies: ["read-file1"]
+users:
+  - username: "alice"
+    roles: ["reader"]
+  - username: "bob"
+    roles: []
+policies:
+  - id: "read-file1"
+    resource: ["file1"]
+    action: ["read"]
+    effect: "allow"
+`)); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	g := graph.New()
+	policyStores["simulate"], policyGraphs["simulate"], policyEngines["simulate"] = store, g, policy.NewPolicyEngine(store, g)
+	user.Create("simulate", "author", []string{"PolicyAdmin"})
+	defer func() {
+		user.Delete("simulate", "author")
+		delete(policyStores, "simulate")
+		delete(policyGraphs, "simulate")
+		delete(policyEngines, "simulate")
+	}()
+	simulate := func(caller, subject string) (int, policy.Decision) {
+		body := `{"tenantID":"simulate","subject":"` + subject + `","resource":"file1","action":"read"}`
+		r := httptest.NewRequest(http.MethodPost, "/simulate", strings.NewReader(body))
+		r = r.WithContext(middleware.WithClaims(r.Context(), middleware.Claims{Subject: caller, Verified: true}))
+		w := httptest.NewRecorder()
+		SimulateAccess(w, r)
+		var dec policy.Decision
+		if w.Code == http.StatusOK {
+			json.NewDecoder(w.Body).Decode(&dec)
+		}
+		return w.Code, dec
+	}
+
+	if code, dec := simulate("alice", ""); code != http.StatusOK || !dec.Allow {
+		t.Fatalf("expected the caller to be simulated, got %d %+v", code, dec)
+	}
+	if code, _ := simulate("bob", "alice"); code != http.StatusForbidden {
+		t.Fatalf("expected another subject to require policy:simulate, got %d", code)
+	}
+	if code, dec := simulate("author", "alice"); code != http.StatusOK || !dec.Allow {
+		t.Fatalf("expected a PolicyAdmin to simulate alice, got %d %+v", code, dec)
+	}
+}
+
+func TestCheckAccessClaimAttributes(t *testing.T) {
+	store := policy.NewPolicyStore()
+	err := store.LoadPolicyData([]byte(`roles:
+  - name: "finance"
+    policies: ["approve"]
+policies:
+  - id: "approve"
+    resource: ["payments"]
+    action: ["approve"]
+    effect: "allow"
+    when:
+      - context.auth.level > 1
+`))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	g := graph.New()
+	policyStores["claims"] = store
+	policyGraphs["claims"] = g
+	policyEngines["claims"] = policy.NewPolicyEngine(store, g)
+	defer func() {
+		delete(policyStores, "claims")
+		delete(policyGraphs, "claims")
+		delete(policyEngines, "claims")
+	}()
+
+	check := func(claims middleware.Claims, conditions string) policy.Decision {
+		body := `{"tenantID":"claims","resource":"payments","action":"approve","conditions":` + conditions + `}`
+		r := httptest.NewRequest(http.MethodPost, "/check-access", strings.NewReader(body))
+		r = r.WithContext(middleware.WithClaims(r.Context(), claims))
+		w := httptest.NewRecorder()
+		CheckAccess(w, r)
+		var dec policy.Decision
+		json.NewDecoder(w.Body).Decode(&dec)
+		return dec
+	}
+	var audit bytes.Buffer
+	defer func(l *logger.Logger) { auditLogger = l }(auditLogger)
+	auditLogger = logger.New(&audit, logger.LevelDebug)
+	carol := middleware.Claims{Subject: "carol", Verified: true, Attributes: map[string]string{"subject.groups": "finance", "auth.level": "2"}}
+	if dec := check(carol, `{"email":"carol@example.com"}`); !dec.Allow {
+		t.Fatalf("expected mapped claims to grant access, got %+v", dec)
+	}
+	// The audit log records only the context the deciding policy read,
+	// unless the full context is opted into.
+	var entry logger.Entry
+	json.Unmarshal(audit.Bytes(), &entry)
+	if len(entry.Context) != 1 || entry.Context["auth.level"] != "2" {
+		t.Fatalf("expected only auth.level to be audited, got %v", entry.Context)
+	}
+	t.Setenv("AUDIT_FULL_CONTEXT", "true")
+	audit.Reset()
+	check(carol, `{"email":"carol@example.com"}`)
+	entry = logger.Entry{}
+	json.Unmarshal(audit.Bytes(), &entry)
+	if entry.Context["email"] != "carol@example.com" || entry.Context["subject.groups"] != "finance" {
+		t.Fatalf("expected the full context to be audited, got %v", entry.Context)
+	}
+	// Callers cannot supply claim values themselves.
+	dave := middleware.Claims{Subject: "dave", Verified: true}
+	if dec := check(dave, `{"subject.groups":"finance","auth.level":"3"}`); dec.Allow || dec.Context["subject.groups"] != "" {
+		t.Fatalf("expected body claim values to be ignored, got %+v", dec)
+	}
+}
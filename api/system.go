@@ -0,0 +1,169 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/bradtumy/authorization-service/internal/logger"
+	"github.com/bradtumy/authorization-service/internal/middleware"
+	"github.com/bradtumy/authorization-service/pkg/graph"
+	"github.com/bradtumy/authorization-service/pkg/policy"
+	"github.com/bradtumy/authorization-service/pkg/user"
+)
+
+// systemTenant holds the policy set authorizing the management API. It is
+// always loaded from SYSTEM_POLICY_FILE, whatever the policy backend, and is
+// reloaded, rolled back and shadowed like any other tenant's policies.
+const systemTenant = "system"
+
+// Management API actions, evaluated against the resource "tenant:<id>". The
+// revision endpoints use policy:rollback, policy:pin and policy:unpin.
+const (
+	actionTenantCreate   = "tenant:create"
+	actionTenantDelete   = "tenant:delete"
+	actionTenantList     = "tenant:list"
+	actionPolicyReload   = "policy:reload"
+	actionPolicyCompile  = "policy:compile"
+	actionPolicyValidate = "policy:validate"
+	actionPolicyHistory  = "policy:history"
+	actionPolicyShadow   = "policy:shadow"
+	actionPolicyReplay   = "policy:replay"
+	actionPolicySimulate = "policy:simulate"
+	actionUserCreate     = "user:create"
+	actionUserAssignRole = "user:assign-role"
+	actionUserDelete     = "user:delete"
+	actionUserList       = "user:list"
+	actionUserGet        = "user:get"
+	actionAPIKeyCreate   = "apikey:create"
+	actionAPIKeyList     = "apikey:list"
+	actionAPIKeyRevoke   = "apikey:revoke"
+)
+
+// initSystemPolicies loads the system policy set from SYSTEM_POLICY_FILE,
+// configs/system.yaml by default.
+func initSystemPolicies() {
+	file := os.Getenv("SYSTEM_POLICY_FILE")
+	if file == "" {
+		file = "configs/system.yaml"
+	}
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		for _, alt := range []string{"../" + file, "../../" + file} {
+			if _, err2 := os.Stat(alt); err2 == nil {
+				file = alt
+				break
+			}
+		}
+	}
+	store := policy.NewPolicyStore()
+	if err := store.LoadPolicies(file); err != nil {
+		panic("failed to load system policies: " + err.Error())
+	}
+	g := graph.New()
+	policyStores[systemTenant] = store
+	policyGraphs[systemTenant] = g
+	policyEngines[systemTenant] = policy.NewPolicyEngine(store, g)
+	policyFiles[systemTenant] = file
+}
+
+// authorizeAdmin evaluates whether the caller may perform action on the
+// tenant using the system policy set. The caller holds the roles it has in
+// the tenant, those it has in the system tenant and those mapped from its
+// token.
+func authorizeAdmin(r *http.Request, tenantID, action string) (string, policy.Decision, error) {
+	sub, err := subjectFromRequest(r)
+	if err != nil {
+		return "", policy.Decision{}, err
+	}
+	engine, ok := tenantEngine(systemTenant)
+	if !ok {
+		return sub, policy.Decision{Reason: "system policies not loaded"}, nil
+	}
+	env := map[string]string{"tenantID": tenantID}
+	if claims, _ := middleware.ClaimsFromContext(r.Context()); claims.Verified {
+		for k, v := range claims.Attributes {
+			env[k] = v
+		}
+	}
+	if u, err := user.Get(systemTenant, sub); err == nil && len(u.Roles) > 0 {
+		roles := strings.Join(u.Roles, ",")
+		if env[policy.RolesKey] != "" {
+			roles = env[policy.RolesKey] + "," + roles
+		}
+		env[policy.RolesKey] = roles
+	}
+	return sub, engine.Evaluate(sub, "tenant:"+tenantID, action, env), nil
+}
+
+// requireAdmin authorizes a management API call and returns the caller. It
+// responds with 401 without a caller and with 403, audited, when the system
+// policies deny the action.
+func requireAdmin(w http.ResponseWriter, r *http.Request, tenantID, action string) (string, bool) {
+	sub, dec, err := authorizeAdmin(r, tenantID, action)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return "", false
+	}
+	if !dec.Allow {
+		auditLogger.Log(logger.Entry{
+			Level:         "warn",
+			CorrelationID: middleware.CorrelationIDFromContext(r.Context()),
+			TenantID:      tenantID,
+			Subject:       sub,
+			APIKey:        apiKeyOf(r),
+			Action:        action,
+			Resource:      "tenant:" + tenantID,
+			Decision:      "deny",
+			PolicyID:      dec.PolicyID,
+			Reason:        dec.Reason,
+			Commit:        dec.Commit,
+		})
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return "", false
+	}
+	return sub, true
+}
+
+// requireGrantable checks that the caller may grant roles in the tenant and
+// responds with 403, audited, when it may not. Roles defined in the system
+// policy set authorize the management API, so granting one requires being
+// allowed every action it allows on the tenant; otherwise a PolicyAdmin could
+// make itself a SystemAdmin, globally when granted in the system tenant.
+func requireGrantable(w http.ResponseWriter, r *http.Request, tenantID string, roles []string) bool {
+	store, ok := tenantStore(systemTenant)
+	if !ok {
+		return true
+	}
+	for _, name := range roles {
+		role, ok := store.Roles[name]
+		if !ok {
+			continue
+		}
+		for _, id := range role.Policies {
+			p, ok := store.GetPolicy(id)
+			if !ok || p.Effect != "allow" {
+				continue
+			}
+			for _, action := range p.Action {
+				sub, dec, err := authorizeAdmin(r, tenantID, action)
+				if err == nil && dec.Allow {
+					continue
+				}
+				auditLogger.Log(logger.Entry{
+					Level:         "warn",
+					CorrelationID: middleware.CorrelationIDFromContext(r.Context()),
+					TenantID:      tenantID,
+					Subject:       sub,
+					APIKey:        apiKeyOf(r),
+					Action:        actionUserAssignRole,
+					Resource:      "role:" + name,
+					Decision:      "deny",
+					Reason:        "role " + name + " allows " + action + ", which the caller may not perform",
+				})
+				http.Error(w, "forbidden: role "+name+" exceeds the caller's permissions", http.StatusForbidden)
+				return false
+			}
+		}
+	}
+	return true
+}
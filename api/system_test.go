@@ -0,0 +1,129 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bradtumy/authorization-service/internal/middleware"
+	"github.com/bradtumy/authorization-service/pkg/user"
+)
+
+// asAdmin authenticates r as a user holding SystemAdmin in the system tenant.
+func asAdmin(r *http.Request) *http.Request {
+	user.Create(systemTenant, "root", []string{"SystemAdmin"})
+	return r.WithContext(middleware.WithClaims(r.Context(), middleware.Claims{Subject: "root", Verified: true}))
+}
+
+func TestSystemPolicies(t *testing.T) {
+	user.Create("default", "editor1", []string{"PolicyAdmin"})
+	user.Create("default", "viewer1", []string{"Viewer"})
+	defer func() {
+		user.Delete("default", "editor1")
+		user.Delete("default", "viewer1")
+	}()
+	as := func(sub string, r *http.Request) *http.Request {
+		return r.WithContext(middleware.WithClaims(r.Context(), middleware.Claims{Subject: sub, Verified: true}))
+	}
+	reload := func(r *http.Request) int {
+		w := httptest.NewRecorder()
+		ReloadPolicies(w, r)
+		return w.Code
+	}
+	body := func(tenantID string) *strings.Reader {
+		return strings.NewReader(`{"tenantID":"` + tenantID + `"}`)
+	}
+
+	if code := reload(as("editor1", httptest.NewRequest(http.MethodPost, "/reload", body("default")))); code != http.StatusOK {
+		t.Fatalf("expected a PolicyAdmin to reload its tenant, got %d", code)
+	}
+	if code := reload(as("viewer1", httptest.NewRequest(http.MethodPost, "/reload", body("default")))); code != http.StatusForbidden {
+		t.Fatalf("expected a viewer to be forbidden, got %d", code)
+	}
+	if code := reload(httptest.NewRequest(http.MethodPost, "/reload", body("default"))); code != http.StatusUnauthorized {
+		t.Fatalf("expected a request without a caller to be unauthorized, got %d", code)
+	}
+	unverified := httptest.NewRequest(http.MethodPost, "/reload", body("default"))
+	unverified = unverified.WithContext(middleware.WithClaims(unverified.Context(), middleware.Claims{Subject: "editor1"}))
+	if code := reload(unverified); code != http.StatusUnauthorized {
+		t.Fatalf("expected an unverified token to be unauthorized, got %d", code)
+	}
+	w := httptest.NewRecorder()
+	CreateTenant(w, as("editor1", httptest.NewRequest(http.MethodPost, "/tenant/create", body("editor-tenant"))))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected only system admins to create tenants, got %d", w.Code)
+	}
+	// Roles are held in the tenant they were granted in.
+	if code := reload(as("editor1", httptest.NewRequest(http.MethodPost, "/reload", body(systemTenant)))); code != http.StatusForbidden {
+		t.Fatalf("expected a tenant's PolicyAdmin to be forbidden on the system tenant, got %d", code)
+	}
+
+	// The system policies are edited like any other: narrowing them takes
+	// effect immediately.
+	st := policyStores[systemTenant]
+	defer func() {
+		if err := st.LoadPolicies(policyFiles[systemTenant]); err != nil {
+			t.Fatalf("restore system policies: %v", err)
+		}
+	}()
+	err := st.LoadPolicyData([]byte(`roles:
+  - name: "SystemAdmin"
+    policies: ["system-admin"]
+  - name: "PolicyAdmin"
+    policies: ["validate-only"]
+policies:
+  - id: "system-admin"
+    resource: ["*"]
+    action: ["*"]
+    effect: "allow"
+  - id: "validate-only"
+    resource: ["tenant:default"]
+    action: ["policy:validate"]
+    effect: "allow"
+`))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if code := reload(as("editor1", httptest.NewRequest(http.MethodPost, "/reload", body("default")))); code != http.StatusForbidden {
+		t.Fatalf("expected narrowed system policies to forbid reload, got %d", code)
+	}
+	if code := reload(asAdmin(httptest.NewRequest(http.MethodPost, "/reload", body(systemTenant)))); code != http.StatusOK {
+		t.Fatalf("expected a system admin to reload the system policies, got %d", code)
+	}
+	if code := reload(as("editor1", httptest.NewRequest(http.MethodPost, "/reload", body("default")))); code != http.StatusOK {
+		t.Fatalf("expected the reloaded system policies to allow reload again, got %d", code)
+	}
+}
+
+func TestAssignManagementRoles(t *testing.T) {
+	user.Create("default", "editor2", []string{"PolicyAdmin"})
+	defer user.Delete("default", "editor2")
+	assign := func(r *http.Request) int {
+		w := httptest.NewRecorder()
+		AssignRole(w, r)
+		return w.Code
+	}
+	as := func(sub, body string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/user/assign-role", strings.NewReader(body))
+		return r.WithContext(middleware.WithClaims(r.Context(), middleware.Claims{Subject: sub, Verified: true}))
+	}
+
+	if code := assign(as("editor2", `{"tenantID":"default","username":"editor2","roles":["SystemAdmin"]}`)); code != http.StatusForbidden {
+		t.Fatalf("expected a PolicyAdmin to be forbidden from granting SystemAdmin, got %d", code)
+	}
+	if code := assign(as("editor2", `{"tenantID":"default","username":"editor2","roles":["TenantAdmin"]}`)); code != http.StatusForbidden {
+		t.Fatalf("expected a PolicyAdmin to be forbidden from granting TenantAdmin, got %d", code)
+	}
+	if code := assign(as("editor2", `{"tenantID":"default","username":"editor2","roles":["PolicyAdmin","viewer"]}`)); code != http.StatusOK {
+		t.Fatalf("expected a PolicyAdmin to grant its own and business roles, got %d", code)
+	}
+	w := httptest.NewRecorder()
+	CreateUser(w, as("editor2", `{"tenantID":"default","username":"mallory","roles":["SystemAdmin"]}`))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected creating a SystemAdmin to be forbidden, got %d", w.Code)
+	}
+	if code := assign(asAdmin(httptest.NewRequest(http.MethodPost, "/user/assign-role", strings.NewReader(`{"tenantID":"default","username":"editor2","roles":["TenantAdmin"]}`)))); code != http.StatusOK {
+		t.Fatalf("expected a SystemAdmin to grant TenantAdmin, got %d", code)
+	}
+}
@@ -12,7 +12,7 @@ import (
 func TestCreateTenant(t *testing.T) {
 	id := "tenantCreate"
 	body := fmt.Sprintf(`{"tenantID":"%s","name":"%s"}`, id, id)
-	r := httptest.NewRequest(http.MethodPost, "/tenant/create", strings.NewReader(body))
+	r := asAdmin(httptest.NewRequest(http.MethodPost, "/tenant/create", strings.NewReader(body)))
 	w := httptest.NewRecorder()
 	CreateTenant(w, r)
 	if w.Code != http.StatusOK {
@@ -30,7 +30,7 @@ func TestCreateTenant(t *testing.T) {
 	}
 	// cleanup
 	delBody := fmt.Sprintf(`{"tenantID":"%s"}`, id)
-	dr := httptest.NewRequest(http.MethodPost, "/tenant/delete", strings.NewReader(delBody))
+	dr := asAdmin(httptest.NewRequest(http.MethodPost, "/tenant/delete", strings.NewReader(delBody)))
 	dw := httptest.NewRecorder()
 	DeleteTenant(dw, dr)
 }
@@ -40,14 +40,14 @@ func TestListTenants(t *testing.T) {
 	id2 := "tenantList2"
 	for _, id := range []string{id1, id2} {
 		body := fmt.Sprintf(`{"tenantID":"%s","name":"%s"}`, id, id)
-		r := httptest.NewRequest(http.MethodPost, "/tenant/create", strings.NewReader(body))
+		r := asAdmin(httptest.NewRequest(http.MethodPost, "/tenant/create", strings.NewReader(body)))
 		w := httptest.NewRecorder()
 		CreateTenant(w, r)
 		if w.Code != http.StatusOK {
 			t.Fatalf("create tenant %s failed", id)
 		}
 	}
-	r := httptest.NewRequest(http.MethodGet, "/tenant/list", nil)
+	r := asAdmin(httptest.NewRequest(http.MethodGet, "/tenant/list", nil))
 	w := httptest.NewRecorder()
 	ListTenants(w, r)
 	if w.Code != http.StatusOK {
@@ -72,7 +72,7 @@ func TestListTenants(t *testing.T) {
 	// cleanup
 	for _, id := range []string{id1, id2} {
 		delBody := fmt.Sprintf(`{"tenantID":"%s"}`, id)
-		dr := httptest.NewRequest(http.MethodPost, "/tenant/delete", strings.NewReader(delBody))
+		dr := asAdmin(httptest.NewRequest(http.MethodPost, "/tenant/delete", strings.NewReader(delBody)))
 		dw := httptest.NewRecorder()
 		DeleteTenant(dw, dr)
 	}
@@ -81,14 +81,14 @@ func TestListTenants(t *testing.T) {
 func TestDeleteTenant(t *testing.T) {
 	id := "tenantDelete"
 	createBody := fmt.Sprintf(`{"tenantID":"%s","name":"%s"}`, id, id)
-	cr := httptest.NewRequest(http.MethodPost, "/tenant/create", strings.NewReader(createBody))
+	cr := asAdmin(httptest.NewRequest(http.MethodPost, "/tenant/create", strings.NewReader(createBody)))
 	cw := httptest.NewRecorder()
 	CreateTenant(cw, cr)
 	if cw.Code != http.StatusOK {
 		t.Fatalf("create tenant failed")
 	}
 	delBody := fmt.Sprintf(`{"tenantID":"%s"}`, id)
-	r := httptest.NewRequest(http.MethodPost, "/tenant/delete", strings.NewReader(delBody))
+	r := asAdmin(httptest.NewRequest(http.MethodPost, "/tenant/delete", strings.NewReader(delBody)))
 	w := httptest.NewRecorder()
 	DeleteTenant(w, r)
 	if w.Code != http.StatusOK {
@@ -98,3 +98,15 @@ func TestDeleteTenant(t *testing.T) {
 		t.Fatalf("tenant not deleted")
 	}
 }
+
+func TestDeleteSystemTenant(t *testing.T) {
+	r := asAdmin(httptest.NewRequest(http.MethodPost, "/tenant/delete", strings.NewReader(`{"tenantID":"system"}`)))
+	w := httptest.NewRecorder()
+	DeleteTenant(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", w.Code)
+	}
+	if _, ok := policyEngines[systemTenant]; !ok {
+		t.Fatal("system policies were dropped")
+	}
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bradtumy/authorization-service/pkg/validator"
+)
+
+func TestValidatePolicyFindings(t *testing.T) {
+	policy := "policies:\n  - id: p1\n    resource: [\"*\"]\n    effect: allow\n"
+	body, _ := json.Marshal(ValidatePolicyRequest{TenantID: "default", Policy: policy})
+	w := httptest.NewRecorder()
+	ValidatePolicy(w, asAdmin(httptest.NewRequest(http.MethodPost, "/validate-policy", strings.NewReader(string(body)))))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+	var findings []validator.Finding
+	if err := json.NewDecoder(w.Body).Decode(&findings); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(findings) != 1 || findings[0].Code != "missing-action" || findings[0].Line != 2 {
+		t.Fatalf("unexpected findings %+v", findings)
+	}
+}
@@ -7,7 +7,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/bradtumy/authorization-service/pkg/validator"
@@ -35,11 +37,13 @@ func main() {
 	case "tenant":
 		handleTenant(args[1:], *addr, *token)
 	case "policy":
-		handlePolicy(args[1:])
+		handlePolicy(args[1:], *addr, *token)
 	case "check-access":
 		handleCheckAccess(args[1:], *addr, *token)
 	case "simulate":
 		handleSimulate(args[1:], *addr, *token)
+	case "apikey":
+		handleAPIKey(args[1:], *addr, *token)
 	default:
 		usage()
 	}
@@ -47,7 +51,7 @@ func main() {
 
 func usage() {
 	fmt.Println("usage: authzctl [--addr URL] [--token TOKEN] <command> [args]")
-	fmt.Println("commands: tenant, policy, check-access, simulate")
+	fmt.Println("commands: tenant, policy, check-access, simulate, apikey")
 	os.Exit(1)
 }
 
@@ -108,16 +112,134 @@ func handleTenant(args []string, addr, token string) {
 	}
 }
 
-func handlePolicy(args []string) {
-	if len(args) < 2 || args[0] != "validate" {
-		fmt.Println("usage: authzctl policy validate <file>")
+func handlePolicy(args []string, addr, token string) {
+	if len(args) < 1 {
+		policyUsage()
+	}
+	switch args[0] {
+	case "validate":
+		if len(args) < 2 {
+			policyUsage()
+		}
+		findings, err := validator.ValidateFile(args[1])
+		if err != nil {
+			fmt.Println("invalid policy:", err)
+			os.Exit(1)
+		}
+		for _, f := range findings {
+			fmt.Printf("%s:%s\n", args[1], f)
+		}
+		if validator.ErrorsOf(findings) != nil {
+			os.Exit(1)
+		}
+		fmt.Println("policy is valid")
+	case "history":
+		fs := flag.NewFlagSet("history", flag.ExitOnError)
+		tenant := fs.String("tenant", "default", "tenant ID")
+		fs.Parse(args[1:])
+		req, _ := http.NewRequest(http.MethodGet, addr+"/policies/history?tenantID="+url.QueryEscape(*tenant), nil)
+		doRequest(req, token)
+	case "rollback", "pin", "unpin":
+		fs := flag.NewFlagSet(args[0], flag.ExitOnError)
+		tenant := fs.String("tenant", "default", "tenant ID")
+		fs.Parse(args[1:])
+		rev := 0
+		if args[0] != "unpin" {
+			if fs.NArg() < 1 {
+				policyUsage()
+			}
+			n, err := strconv.Atoi(fs.Arg(0))
+			if err != nil {
+				fmt.Println("invalid revision:", fs.Arg(0))
+				os.Exit(1)
+			}
+			rev = n
+		}
+		data, _ := json.Marshal(map[string]any{"tenantID": *tenant, "revision": rev})
+		req, _ := http.NewRequest(http.MethodPost, addr+"/policies/"+args[0], bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		doRequest(req, token)
+	default:
+		policyUsage()
+	}
+}
+
+func policyUsage() {
+	fmt.Println("usage: authzctl policy validate <file>")
+	fmt.Println("       authzctl policy history [--tenant TENANT]")
+	fmt.Println("       authzctl policy rollback|pin [--tenant TENANT] <rev>")
+	fmt.Println("       authzctl policy unpin [--tenant TENANT]")
+	os.Exit(1)
+}
+
+// doRequest sends req with the bearer token, prints the response body and
+// exits non-zero on error statuses.
+func doRequest(req *http.Request, token string) {
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Println("request error:", err)
 		os.Exit(1)
 	}
-	if err := validator.ValidatePolicyFile(args[1]); err != nil {
-		fmt.Println("invalid policy:", err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	fmt.Println(string(body))
+	if resp.StatusCode >= 300 {
 		os.Exit(1)
 	}
-	fmt.Println("policy is valid")
+}
+
+func handleAPIKey(args []string, addr, token string) {
+	if len(args) < 1 {
+		apiKeyUsage()
+	}
+	fs := flag.NewFlagSet("apikey "+args[0], flag.ExitOnError)
+	tenant := fs.String("tenant", "default", "tenant ID")
+	switch args[0] {
+	case "create":
+		name := fs.String("name", "", "name of the key")
+		endpoints := fs.String("endpoints", "", "comma-separated endpoints the key may call (default /check-access)")
+		ttl := fs.String("ttl", "", "lifetime of the key, e.g. 720h (default no expiry)")
+		rotate := fs.String("rotate", "", "ID of the key to replace")
+		grace := fs.String("grace", "", "how long the replaced key stays valid (default 1h)")
+		fs.Parse(args[1:])
+		if *name == "" && *rotate == "" {
+			apiKeyUsage()
+		}
+		payload := map[string]any{"tenantID": *tenant, "name": *name, "ttl": *ttl, "rotate": *rotate, "grace": *grace}
+		if *endpoints != "" {
+			payload["endpoints"] = strings.Split(*endpoints, ",")
+		}
+		data, _ := json.Marshal(payload)
+		req, _ := http.NewRequest(http.MethodPost, addr+"/apikey/create", bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		doRequest(req, token)
+	case "list":
+		fs.Parse(args[1:])
+		req, _ := http.NewRequest(http.MethodGet, addr+"/apikey/list?tenantID="+url.QueryEscape(*tenant), nil)
+		doRequest(req, token)
+	case "revoke":
+		fs.Parse(args[1:])
+		if fs.NArg() < 1 {
+			apiKeyUsage()
+		}
+		data, _ := json.Marshal(map[string]string{"tenantID": *tenant, "id": fs.Arg(0)})
+		req, _ := http.NewRequest(http.MethodPost, addr+"/apikey/revoke", bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		doRequest(req, token)
+	default:
+		apiKeyUsage()
+	}
+}
+
+func apiKeyUsage() {
+	fmt.Println("usage: authzctl apikey create [--tenant TENANT] --name NAME [--endpoints PATHS] [--ttl DURATION]")
+	fmt.Println("       authzctl apikey create [--tenant TENANT] --rotate ID [--grace DURATION]")
+	fmt.Println("       authzctl apikey list [--tenant TENANT]")
+	fmt.Println("       authzctl apikey revoke [--tenant TENANT] <id>")
+	os.Exit(1)
 }
 
 func handleCheckAccess(args []string, addr, token string) {
@@ -6,9 +6,11 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/bradtumy/authorization-service/api"
 	"github.com/bradtumy/authorization-service/internal/telemetry"
+	"github.com/bradtumy/authorization-service/internal/tlsconfig"
 	"github.com/bradtumy/authorization-service/pkg/user"
 	"github.com/joho/godotenv"
 )
@@ -38,6 +40,24 @@ func main() {
 
 	user.EnablePersistence(*persistUsers)
 	router := api.SetupRouter()
-	log.Println("Starting server on :", port)
-	log.Fatal(http.ListenAndServe(":"+port, router))
+	srv := &http.Server{Addr: ":" + port, Handler: router}
+
+	// Serve TLS, and mutual TLS with a client CA, when a certificate is
+	// configured. The files are reloaded when they change.
+	tlsCfg, err := tlsconfig.FromEnv()
+	if err != nil {
+		log.Fatalf("invalid TLS configuration: %v", err)
+	}
+	if tlsCfg == nil {
+		log.Println("Starting server on :", port)
+		log.Fatal(srv.ListenAndServe())
+	}
+	certs, err := tlsconfig.New(*tlsCfg)
+	if err != nil {
+		log.Fatalf("failed to load TLS certificates: %v", err)
+	}
+	go certs.Watch(ctx, 30*time.Second)
+	srv.TLSConfig = certs.TLSConfig()
+	log.Println("Starting TLS server on :", port)
+	log.Fatal(srv.ListenAndServeTLS("", ""))
 }
@@ -3,13 +3,19 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 
 	"github.com/bradtumy/authorization-service/pkg/graph"
+	"github.com/bradtumy/authorization-service/pkg/lint"
+	"github.com/bradtumy/authorization-service/pkg/policy"
 	"github.com/bradtumy/authorization-service/pkg/policycompiler"
+	"github.com/bradtumy/authorization-service/pkg/policydiff"
+	"github.com/bradtumy/authorization-service/pkg/policytest"
+	"github.com/bradtumy/authorization-service/pkg/replay"
 	"github.com/bradtumy/authorization-service/pkg/validator"
 )
 
@@ -37,17 +43,39 @@ func main() {
 			fmt.Println("usage: policyctl validate <file.yaml>")
 			os.Exit(1)
 		}
-		if err := validator.ValidatePolicyFile(os.Args[2]); err != nil {
+		findings, err := validator.ValidateFile(os.Args[2])
+		if err != nil {
 			fmt.Println("invalid policy:", err)
 			os.Exit(1)
 		}
+		for _, f := range findings {
+			fmt.Printf("%s:%s\n", os.Args[2], f)
+		}
+		if validator.ErrorsOf(findings) != nil {
+			os.Exit(1)
+		}
 		fmt.Println("policy is valid")
 	case "tenant":
 		handleTenant(os.Args[2:])
 	case "graph":
 		handleGraph(os.Args[2:])
+	case "replay":
+		handleReplay(os.Args[2:])
+	case "test":
+		handleTest(os.Args[2:])
+	case "lint":
+		handleLint(os.Args[2:])
+	case "diff":
+		handleDiff(os.Args[2:])
+	case "schema":
+		data, err := policy.SchemaJSON()
+		if err != nil {
+			fmt.Println("schema error:", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
 	default:
-		fmt.Println("usage: policyctl <compile|validate|tenant|graph> ...")
+		fmt.Println("usage: policyctl <compile|validate|tenant|graph|replay|test|lint|diff|schema> ...")
 		os.Exit(1)
 	}
 }
@@ -158,6 +186,171 @@ func handleGraph(args []string) {
 	}
 }
 
+func handleReplay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	policies := fs.String("policies", "", "candidate policy file")
+	logFile := fs.String("log", "", "decision log in JSON lines format")
+	baseline := fs.String("baseline", "", "policy file used for records without a recorded decision")
+	tenant := fs.String("tenant", "", "only replay records for this tenant")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Parse(args)
+	if *policies == "" || *logFile == "" {
+		fmt.Println("usage: policyctl replay --policies new.yaml --log decisions.jsonl [--baseline current.yaml] [--tenant ID] [--json]")
+		os.Exit(1)
+	}
+	candidate, err := loadEngine(*policies)
+	if err != nil {
+		fmt.Println("invalid policy:", err)
+		os.Exit(1)
+	}
+	var base *policy.PolicyEngine
+	if *baseline != "" {
+		if base, err = loadEngine(*baseline); err != nil {
+			fmt.Println("invalid baseline policy:", err)
+			os.Exit(1)
+		}
+	}
+	f, err := os.Open(*logFile)
+	if err != nil {
+		fmt.Println("open log:", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	records, err := replay.ReadLog(f)
+	if err != nil {
+		fmt.Println("read log:", err)
+		os.Exit(1)
+	}
+	if *tenant != "" {
+		filtered := records[:0]
+		for _, rec := range records {
+			if rec.TenantID == *tenant {
+				filtered = append(filtered, rec)
+			}
+		}
+		records = filtered
+	}
+	report := replay.Run(candidate, base, records)
+	if *asJSON {
+		data, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		report.WriteText(os.Stdout)
+	}
+	if len(report.AllowToDeny) > 0 || len(report.DenyToAllow) > 0 {
+		os.Exit(2)
+	}
+}
+
+func handleTest(args []string) {
+	fs := flag.NewFlagSet("test", flag.ExitOnError)
+	junit := fs.String("junit", "", "write a JUnit XML report to this file")
+	jsonOut := fs.String("json", "", "write a JSON report to this file")
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fmt.Println("usage: policyctl test [--junit report.xml] [--json report.json] <dir|file>")
+		os.Exit(1)
+	}
+	res, err := policytest.Run(fs.Arg(0))
+	if err != nil {
+		fmt.Println("test error:", err)
+		os.Exit(1)
+	}
+	res.WriteText(os.Stdout)
+	if *junit != "" {
+		f, err := os.Create(*junit)
+		if err != nil {
+			fmt.Println("junit report:", err)
+			os.Exit(1)
+		}
+		err = res.WriteJUnit(f)
+		f.Close()
+		if err != nil {
+			fmt.Println("junit report:", err)
+			os.Exit(1)
+		}
+	}
+	if *jsonOut != "" {
+		data, _ := json.MarshalIndent(res, "", "  ")
+		if err := os.WriteFile(*jsonOut, data, 0644); err != nil {
+			fmt.Println("json report:", err)
+			os.Exit(1)
+		}
+	}
+	if res.Failed() > 0 {
+		os.Exit(1)
+	}
+}
+
+func handleLint(args []string) {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	jsonOut := fs.Bool("json", false, "print findings as JSON")
+	strict := fs.Bool("strict", false, "exit non-zero on warnings as well as errors")
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fmt.Println("usage: policyctl lint [--json] [--strict] <file.yaml>...")
+		os.Exit(1)
+	}
+	all := map[string][]validator.Finding{}
+	failed := false
+	for _, path := range fs.Args() {
+		findings, err := lint.LintFile(path)
+		if err != nil {
+			fmt.Printf("%s: %v\n", path, err)
+			os.Exit(1)
+		}
+		all[path] = findings
+		for _, f := range findings {
+			if f.Severity == validator.SeverityError || *strict {
+				failed = true
+			}
+			if !*jsonOut {
+				fmt.Printf("%s:%s\n", path, f)
+			}
+		}
+	}
+	if *jsonOut {
+		data, _ := json.MarshalIndent(all, "", "  ")
+		fmt.Println(string(data))
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func handleDiff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	jsonOut := fs.Bool("json", false, "print the delta as JSON")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fmt.Println("usage: policyctl diff [--json] <old.yaml> <new.yaml>")
+		os.Exit(1)
+	}
+	stores := make([]*policy.PolicyStore, 2)
+	for i, path := range fs.Args() {
+		stores[i] = policy.NewPolicyStore()
+		if err := stores[i].LoadPolicies(path); err != nil {
+			fmt.Printf("load %s: %v\n", path, err)
+			os.Exit(1)
+		}
+	}
+	res := policydiff.Compare(stores[0], stores[1])
+	if *jsonOut {
+		data, _ := json.MarshalIndent(res, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+	res.WriteText(os.Stdout)
+}
+
+func loadEngine(path string) (*policy.PolicyEngine, error) {
+	st := policy.NewPolicyStore()
+	if err := st.LoadPolicies(path); err != nil {
+		return nil, err
+	}
+	return policy.NewPolicyEngine(st, graph.New()), nil
+}
+
 func loadGraphFile(path string) *graph.Graph {
 	g := graph.New()
 	data, err := os.ReadFile(path)
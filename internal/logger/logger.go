@@ -9,16 +9,21 @@ import (
 
 // Entry represents a structured log entry.
 type Entry struct {
-	Timestamp     time.Time `json:"timestamp"`
-	Level         string    `json:"level"`
-	CorrelationID string    `json:"correlation_id"`
-	TenantID      string    `json:"tenant_id,omitempty"`
-	Subject       string    `json:"subject,omitempty"`
-	Action        string    `json:"action,omitempty"`
-	Resource      string    `json:"resource,omitempty"`
-	Decision      string    `json:"decision,omitempty"`
-	PolicyID      string    `json:"policy_id,omitempty"`
-	Reason        string    `json:"reason,omitempty"`
+	Timestamp     time.Time         `json:"timestamp"`
+	Level         string            `json:"level"`
+	CorrelationID string            `json:"correlation_id"`
+	TenantID      string            `json:"tenant_id,omitempty"`
+	Subject       string            `json:"subject,omitempty"`
+	Actor         string            `json:"actor,omitempty"`
+	APIKey        string            `json:"api_key,omitempty"`
+	Action        string            `json:"action,omitempty"`
+	Resource      string            `json:"resource,omitempty"`
+	Decision      string            `json:"decision,omitempty"`
+	PolicyID      string            `json:"policy_id,omitempty"`
+	Reason        string            `json:"reason,omitempty"`
+	Context       map[string]string `json:"context,omitempty"`
+	Commit        string            `json:"commit,omitempty"`
+	Shadow        bool              `json:"shadow,omitempty"`
 }
 
 type Level int
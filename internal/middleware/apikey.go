@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bradtumy/authorization-service/pkg/apikey"
+)
+
+// APIKeyHeader carries API keys. They are also accepted as bearer tokens and
+// in an "Authorization: ApiKey <key>" header.
+const APIKeyHeader = "X-API-Key"
+
+// Context keys of API key callers.
+const (
+	APIKeyIDKey   = "auth.api_key"
+	APIKeyNameKey = "auth.api_key_name"
+)
+
+// apiKeyCacheTTL bounds how long a stored key is used without reading it
+// again, and so how long a revocation by another instance takes to apply.
+const apiKeyCacheTTL = 10 * time.Second
+
+// APIKeyLookup returns the stored key with the given ID.
+type APIKeyLookup func(ctx context.Context, id string) (apikey.Key, error)
+
+type cachedAPIKey struct {
+	key     apikey.Key
+	fetched time.Time
+}
+
+var apiKeyCache = struct {
+	sync.RWMutex
+	keys map[string]cachedAPIKey
+}{keys: make(map[string]cachedAPIKey)}
+
+// ForgetAPIKey drops a key from the cache, so that its revocation or rotation
+// applies to the next request.
+func ForgetAPIKey(id string) {
+	apiKeyCache.Lock()
+	delete(apiKeyCache.keys, id)
+	apiKeyCache.Unlock()
+}
+
+// APIKeyMiddleware authenticates requests carrying an API key and passes the
+// others on to JWTMiddleware. A key is rejected with 401 when it is unknown,
+// revoked or expired and with 403 on an endpoint it does not allow. Its
+// caller is bound to the key's tenant.
+func APIKeyMiddleware(lookup APIKeyLookup) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		withJWT := JWTMiddleware(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw := apiKeyFromRequest(r)
+			if raw == "" {
+				withJWT.ServeHTTP(w, r)
+				return
+			}
+			k, ok := verifyAPIKey(r.Context(), lookup, raw)
+			if !ok {
+				http.Error(w, "Invalid API key", http.StatusUnauthorized)
+				return
+			}
+			if !k.Allows(r.URL.Path) {
+				http.Error(w, "API key not allowed for this endpoint", http.StatusForbidden)
+				return
+			}
+			c := Claims{
+				Subject:     "apikey:" + k.ID,
+				Verified:    true,
+				APIKey:      k.ID,
+				TenantBound: true,
+				Tenants:     []string{k.TenantID},
+				Attributes:  map[string]string{APIKeyIDKey: k.ID, APIKeyNameKey: k.Name},
+			}
+			next.ServeHTTP(w, withClaims(r, c))
+		})
+	}
+}
+
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	scheme, cred, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	switch {
+	case strings.EqualFold(scheme, "ApiKey"):
+		return cred
+	case strings.EqualFold(scheme, "Bearer") && strings.HasPrefix(cred, apikey.Prefix):
+		return cred
+	}
+	return ""
+}
+
+// verifyAPIKey returns the stored key of raw when its secret matches and it
+// is active.
+func verifyAPIKey(ctx context.Context, lookup APIKeyLookup, raw string) (apikey.Key, bool) {
+	id, secret, err := apikey.Parse(raw)
+	if err != nil {
+		return apikey.Key{}, false
+	}
+	now := time.Now()
+	apiKeyCache.RLock()
+	c, ok := apiKeyCache.keys[id]
+	apiKeyCache.RUnlock()
+	if !ok || now.Sub(c.fetched) >= apiKeyCacheTTL {
+		k, err := lookup(ctx, id)
+		if err != nil {
+			return apikey.Key{}, false
+		}
+		c = cachedAPIKey{key: k, fetched: now}
+		apiKeyCache.Lock()
+		apiKeyCache.keys[id] = c
+		apiKeyCache.Unlock()
+	}
+	if !c.key.Matches(secret) || !c.key.Active(now) {
+		return apikey.Key{}, false
+	}
+	return c.key, true
+}
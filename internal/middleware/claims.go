@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+// Claims are the identity claims of the bearer token a request was made with.
+type Claims struct {
+	// Subject is the preferred_username claim, or sub when it is absent.
+	Subject string
+	Issuer  string
+	// Verified is false when no OIDC provider is configured and the token was
+	// accepted without checking its signature.
+	Verified bool
+	Raw      jwt.MapClaims
+	// Attributes are the claims mapped into the evaluation context by the
+	// issuer's claim mapping. They are only set for verified tokens.
+	Attributes map[string]string
+	// TenantBound is set when the token's provider binds callers to tenants.
+	// Tenants lists those the caller may act in; it is empty when the token
+	// lacks the tenant claim.
+	TenantBound bool
+	Tenants     []string
+	// APIKey is the ID of the API key the request was made with, if any.
+	APIKey string
+	// Peer is the identity of the verified client certificate the request
+	// was made with, if any.
+	Peer string
+}
+
+// InTenant reports whether the caller may act in tenantID. Callers whose
+// token is unverified or not bound to a tenant may act in any.
+func (c Claims) InTenant(tenantID string) bool {
+	if !c.Verified || !c.TenantBound {
+		return true
+	}
+	for _, t := range c.Tenants {
+		if t == tenantID {
+			return true
+		}
+	}
+	return false
+}
+
+// tenantBinding resolves the tenants of a verified token.
+type tenantBinding struct {
+	// Tenant binds every token of the provider to one tenant.
+	Tenant string
+	// Claim names the claim, such as tenant or org_id, listing the caller's
+	// tenants.
+	Claim string
+}
+
+func (b tenantBinding) bound() bool {
+	return b.Tenant != "" || b.Claim != ""
+}
+
+// tenants returns the tenants raw is bound to.
+func (b tenantBinding) tenants(raw jwt.MapClaims) []string {
+	if b.Tenant != "" {
+		return []string{b.Tenant}
+	}
+	v, ok := claimValue(raw, b.Claim)
+	if !ok || v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
+
+// claimsKey is the context key for the caller's claims.
+type claimsKey struct{}
+
+// WithClaims returns a copy of ctx carrying c.
+func WithClaims(ctx context.Context, c Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, c)
+}
+
+// ClaimsFromContext returns the claims stored by JWTMiddleware.
+func ClaimsFromContext(ctx context.Context) (Claims, bool) {
+	c, ok := ctx.Value(claimsKey{}).(Claims)
+	return c, ok
+}
+
+func newClaims(raw jwt.MapClaims, verified bool) Claims {
+	c := Claims{Verified: verified, Raw: raw}
+	c.Issuer, _ = raw["iss"].(string)
+	if c.Subject, _ = raw["preferred_username"].(string); c.Subject == "" {
+		c.Subject, _ = raw["sub"].(string)
+	}
+	return c
+}
+
+// ClaimNamespaces are the context key prefixes claims may be mapped to. They
+// are reserved for token claims, so callers cannot supply them directly.
+var ClaimNamespaces = []string{"subject.", "auth."}
+
+// Reserved reports whether key is in one of the ClaimNamespaces.
+func Reserved(key string) bool {
+	for _, ns := range ClaimNamespaces {
+		if strings.HasPrefix(key, ns) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateMapping checks that every claim is mapped into a reserved
+// namespace.
+func validateMapping(mapping map[string]string) error {
+	for claim, key := range mapping {
+		if claim == "" || !Reserved(key) || strings.HasSuffix(key, ".") {
+			return fmt.Errorf("claim %q: target %q must be a key under %s", claim, key, strings.Join(ClaimNamespaces, " or "))
+		}
+	}
+	return nil
+}
+
+// mapClaims returns the context values of raw selected by mapping, which maps
+// claim names to context keys. Nested claims are addressed with dots, as in
+// realm_access.roles, lists are joined with commas, and the pseudo claim
+// email_domain is the part of the email claim after the @. Claims that are
+// absent or not scalars or lists of scalars are skipped.
+func mapClaims(raw jwt.MapClaims, mapping map[string]string) map[string]string {
+	if len(mapping) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(mapping))
+	for claim, key := range mapping {
+		if v, ok := claimValue(raw, claim); ok {
+			out[key] = v
+		}
+	}
+	return out
+}
+
+func claimValue(raw jwt.MapClaims, claim string) (string, bool) {
+	var v interface{} = map[string]interface{}(raw)
+	for _, part := range strings.Split(claim, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if v, ok = m[part]; !ok {
+			if claim != "email_domain" {
+				return "", false
+			}
+			email, _ := raw["email"].(string)
+			_, domain, found := strings.Cut(email, "@")
+			return strings.ToLower(domain), found && domain != ""
+		}
+	}
+	if list, ok := v.([]interface{}); ok {
+		items := make([]string, 0, len(list))
+		for _, item := range list {
+			s, ok := scalar(item)
+			if !ok {
+				return "", false
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), true
+	}
+	return scalar(v)
+}
+
+func scalar(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
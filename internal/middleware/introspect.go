@@ -0,0 +1,271 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+// sourceIntrospection is the key source of providers that verify tokens only
+// through introspection.
+const sourceIntrospection = "introspection"
+
+// Context keys of the introspection response.
+const (
+	ScopeKey    = "auth.scope"
+	ClientIDKey = "auth.client_id"
+)
+
+// defaultIntrospectionTTL bounds how long an active response is cached when
+// the introspection config sets no cache_ttl.
+const defaultIntrospectionTTL = 5 * time.Minute
+
+// inactiveIntrospectionTTL bounds how long an inactive or expired response is
+// cached, so repeated use of a revoked token does not reach the endpoint on
+// every request. It is further capped by the provider's TTL.
+const inactiveIntrospectionTTL = 30 * time.Second
+
+// maxIntrospectionCache bounds the number of cached responses; further
+// responses are not cached until entries expire.
+const maxIntrospectionCache = 10000
+
+// introspectionConfig configures the RFC 7662 endpoint of a provider.
+type introspectionConfig struct {
+	Endpoint string `yaml:"endpoint"`
+	// ClientID and ClientSecret authenticate the service to the endpoint
+	// with HTTP Basic authentication. ${VAR} references are expanded from
+	// the environment.
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	// CacheTTL caps how long an active response is cached, which is never
+	// beyond the token's exp. Zero uses defaultIntrospectionTTL and a
+	// negative value disables caching.
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+	// TokenPrefix routes opaque tokens starting with it to the endpoint. It
+	// is required when several providers use introspection, so that tokens
+	// are never disclosed to another provider's endpoint.
+	TokenPrefix string `yaml:"token_prefix"`
+}
+
+// introspector verifies opaque tokens with an introspection endpoint and
+// caches its responses.
+type introspector struct {
+	endpoint     string
+	prefix       string
+	clientID     string
+	clientSecret string
+	ttl          time.Duration
+	client       *http.Client
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]cachedIntrospection
+	// err is the error of the last call to the endpoint.
+	err error
+}
+
+// cachedIntrospection is a cached response; claims is nil for inactive
+// tokens.
+type cachedIntrospection struct {
+	claims  jwt.MapClaims
+	expires time.Time
+}
+
+func newIntrospector(cfg introspectionConfig) (*introspector, error) {
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("introspection endpoint %q must be an http or https URL", cfg.Endpoint)
+	}
+	ttl := cfg.CacheTTL
+	if ttl == 0 {
+		ttl = defaultIntrospectionTTL
+	}
+	return &introspector{
+		endpoint:     cfg.Endpoint,
+		prefix:       cfg.TokenPrefix,
+		clientID:     os.ExpandEnv(cfg.ClientID),
+		clientSecret: os.ExpandEnv(cfg.ClientSecret),
+		ttl:          ttl,
+		client:       &http.Client{Timeout: 5 * time.Second},
+		cache:        make(map[[sha256.Size]byte]cachedIntrospection),
+	}, nil
+}
+
+// errInactive is returned for tokens the endpoint reports as inactive.
+var errInactive = errors.New("token is not active")
+
+// introspect returns the introspection response of an active token. Active
+// responses are cached until the token's exp, capped at the TTL, and inactive
+// or expired ones for inactiveIntrospectionTTL, also capped at the TTL.
+func (in *introspector) introspect(ctx context.Context, token string) (jwt.MapClaims, error) {
+	key := sha256.Sum256([]byte(token))
+	now := time.Now()
+	in.mu.Lock()
+	if c, ok := in.cache[key]; ok && now.Before(c.expires) {
+		in.mu.Unlock()
+		if c.claims == nil {
+			return nil, errInactive
+		}
+		return c.claims, nil
+	}
+	in.mu.Unlock()
+
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, in.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if in.clientID != "" {
+		req.SetBasicAuth(url.QueryEscape(in.clientID), url.QueryEscape(in.clientSecret))
+	}
+	claims, err := in.call(req)
+	in.mu.Lock()
+	in.err = err
+	in.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if active, _ := claims["active"].(bool); !active || !claims.VerifyExpiresAt(now.Unix(), false) {
+		in.store(key, nil, now, now.Add(min(inactiveIntrospectionTTL, in.ttl)))
+		return nil, errInactive
+	}
+	// A token that is not valid yet is not cached: it becomes valid at nbf.
+	if !claims.VerifyNotBefore(now.Unix(), false) {
+		return nil, errInactive
+	}
+
+	expires := now.Add(in.ttl)
+	if exp, ok := claims["exp"].(float64); ok {
+		if t := time.Unix(int64(exp), 0); t.Before(expires) {
+			expires = t
+		}
+	}
+	in.store(key, claims, now, expires)
+	return claims, nil
+}
+
+// store caches a response until expires, dropping expired entries first. It
+// does nothing when caching is disabled or the cache is full.
+func (in *introspector) store(key [sha256.Size]byte, claims jwt.MapClaims, now, expires time.Time) {
+	if in.ttl <= 0 {
+		return
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	for k, c := range in.cache {
+		if !now.Before(c.expires) {
+			delete(in.cache, k)
+		}
+	}
+	if len(in.cache) < maxIntrospectionCache {
+		in.cache[key] = cachedIntrospection{claims: claims, expires: expires}
+	}
+}
+
+func (in *introspector) call(req *http.Request) (jwt.MapClaims, error) {
+	resp, err := in.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection returned %s", resp.Status)
+	}
+	claims := jwt.MapClaims{}
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return nil, fmt.Errorf("introspection response: %w", err)
+	}
+	return claims, nil
+}
+
+func (in *introspector) lastErr() error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.err
+}
+
+// introspectionClaims returns the Claims of an introspection response. The
+// subject is sub, or client_id for tokens issued to a client itself, and
+// scope and client_id are set in the evaluation context, scopes joined with
+// commas.
+func introspectionClaims(raw jwt.MapClaims, prov *oidcProvider) Claims {
+	c := newClaims(raw, true)
+	if c.Issuer == "" {
+		c.Issuer = prov.Issuer
+	}
+	clientID, _ := raw["client_id"].(string)
+	if c.Subject == "" {
+		c.Subject = clientID
+	}
+	c.Attributes = mapClaims(raw, prov.Claims)
+	if c.Attributes == nil {
+		c.Attributes = make(map[string]string)
+	}
+	if _, ok := c.Attributes[ClientIDKey]; !ok && clientID != "" {
+		c.Attributes[ClientIDKey] = clientID
+	}
+	if scope, _ := raw["scope"].(string); scope != "" {
+		if _, ok := c.Attributes[ScopeKey]; !ok {
+			c.Attributes[ScopeKey] = strings.Join(strings.Fields(scope), ",")
+		}
+	}
+	if prov.Binding.bound() {
+		c.TenantBound = true
+		c.Tenants = prov.Binding.tenants(raw)
+	}
+	return c
+}
+
+// introspectToken verifies token with the introspection endpoints of the
+// providers it is routed to and returns the claims of the first that reports
+// it active. JWTs are routed to the providers of their issuer and opaque
+// tokens to those whose token prefix they start with. A response naming
+// another issuer, or lacking the provider's audience when it has one, is not
+// accepted.
+func introspectToken(ctx context.Context, token string) (Claims, bool) {
+	unverified := jwt.MapClaims{}
+	iss := ""
+	if _, _, err := new(jwt.Parser).ParseUnverified(token, unverified); err == nil {
+		iss, _ = unverified["iss"].(string)
+	}
+	for i := range providers {
+		prov := &providers[i]
+		if prov.Introspection == nil {
+			continue
+		}
+		if iss != "" {
+			if iss != prov.Issuer {
+				continue
+			}
+		} else if !strings.HasPrefix(token, prov.Introspection.prefix) {
+			continue
+		}
+		raw, err := prov.Introspection.introspect(ctx, token)
+		if err != nil {
+			if !errors.Is(err, errInactive) {
+				log.Printf("oidc: introspection for %s: %v", prov.Issuer, err)
+			}
+			continue
+		}
+		if iss, ok := raw["iss"].(string); ok && iss != prov.Issuer {
+			continue
+		}
+		if !audienceMatch(raw["aud"], prov.Audience) {
+			continue
+		}
+		return introspectionClaims(raw, prov), true
+	}
+	return Claims{}, false
+}
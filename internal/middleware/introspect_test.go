@@ -0,0 +1,182 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+func TestIntrospection(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	soon := time.Now().Add(time.Minute).Unix()
+	responses := map[string]map[string]interface{}{
+		"opaque-user":   {"active": true, "sub": "alice", "aud": "test-aud", "scope": "read write", "client_id": "portal", "exp": exp},
+		"opaque-client": {"active": true, "aud": []string{"test-aud"}, "scope": "sync", "client_id": "batch", "exp": exp},
+		"opaque-other":  {"active": true, "sub": "mallory", "aud": "test-aud", "iss": "https://elsewhere"},
+		"opaque-noaud":  {"active": true, "sub": "mallory"},
+		"opaque-old":    {"active": true, "sub": "alice", "aud": "test-aud", "exp": time.Now().Add(-time.Minute).Unix()},
+		"opaque-dead":   {"active": false},
+		"opaque-soon":   {"active": true, "sub": "alice", "aud": "test-aud", "exp": soon},
+	}
+	var calls int32
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if id, secret, ok := r.BasicAuth(); !ok || id != "authz" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		resp, ok := responses[r.PostFormValue("token")]
+		if !ok {
+			resp = map[string]interface{}{"active": false}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer stub.Close()
+
+	t.Setenv("INTROSPECTION_SECRET", "s3cret")
+	writeOIDCConfig(t, "providers:\n  - issuer: "+keysIssuer+"\n    audience: test-aud\n    introspection:\n"+
+		"      endpoint: "+stub.URL+"\n      client_id: authz\n      client_secret: ${INTROSPECTION_SECRET}\n"+
+		"    tenant: acme\n")
+	if err := LoadOIDCConfig(); err != nil {
+		t.Fatalf("load providers: %v", err)
+	}
+	defer LoadOIDCConfig()
+
+	var got Claims
+	handler := JWTMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = ClaimsFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+	call := func(token string) int {
+		got = Claims{}
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := call("opaque-user"); code != http.StatusOK {
+		t.Fatalf("expected active token to be accepted, got %d", code)
+	}
+	if got.Subject != "alice" || !got.Verified || got.Issuer != keysIssuer || got.Attributes[ScopeKey] != "read,write" || got.Attributes[ClientIDKey] != "portal" {
+		t.Fatalf("unexpected claims %+v", got)
+	}
+	if !got.TenantBound || len(got.Tenants) != 1 || got.Tenants[0] != "acme" {
+		t.Fatalf("expected the provider's tenant binding to apply, got %+v", got)
+	}
+	n := atomic.LoadInt32(&calls)
+	if code := call("opaque-user"); code != http.StatusOK || atomic.LoadInt32(&calls) != n {
+		t.Fatalf("expected the cached response to be used, got %d after %d calls", code, atomic.LoadInt32(&calls)-n)
+	}
+	key := sha256.Sum256([]byte("opaque-user"))
+	if c := providers[0].Introspection.cache[key]; c.expires.IsZero() || c.expires.After(time.Now().Add(defaultIntrospectionTTL)) {
+		t.Fatalf("expected the cache entry to expire by the TTL, got %v", c.expires)
+	}
+
+	if code := call("opaque-client"); code != http.StatusOK || got.Subject != "batch" || got.Attributes[ClientIDKey] != "batch" {
+		t.Fatalf("expected client token to identify the client, got %d %+v", code, got)
+	}
+	for _, token := range []string{"opaque-dead", "opaque-old", "opaque-other", "opaque-noaud", "unknown"} {
+		if code := call(token); code != http.StatusUnauthorized {
+			t.Fatalf("expected %s to be rejected, got %d", token, code)
+		}
+	}
+	// Inactive and expired responses are cached briefly.
+	n = atomic.LoadInt32(&calls)
+	for _, token := range []string{"opaque-dead", "opaque-old"} {
+		if code := call(token); code != http.StatusUnauthorized || atomic.LoadInt32(&calls) != n {
+			t.Fatalf("expected the cached rejection of %s, got %d after %d calls", token, code, atomic.LoadInt32(&calls)-n)
+		}
+		if c := providers[0].Introspection.cache[sha256.Sum256([]byte(token))]; c.claims != nil || c.expires.After(time.Now().Add(inactiveIntrospectionTTL)) {
+			t.Fatalf("expected %s to be cached as inactive for at most %v, got %+v", token, inactiveIntrospectionTTL, c)
+		}
+	}
+
+	// A token expiring before the TTL is cached only until its exp.
+	call("opaque-soon")
+	if c := providers[0].Introspection.cache[sha256.Sum256([]byte("opaque-soon"))]; !c.expires.Equal(time.Unix(soon, 0)) {
+		t.Fatalf("expected the cache entry to expire with the token, got %v", c.expires)
+	}
+
+	// A full cache takes no further entries.
+	in := providers[0].Introspection
+	in.mu.Lock()
+	for i := len(in.cache); i < maxIntrospectionCache; i++ {
+		in.cache[sha256.Sum256([]byte{byte(i), byte(i >> 8)})] = cachedIntrospection{expires: time.Now().Add(time.Hour)}
+	}
+	in.mu.Unlock()
+	call("opaque-unseen")
+	if _, ok := in.cache[sha256.Sum256([]byte("opaque-unseen"))]; ok || len(in.cache) != maxIntrospectionCache {
+		t.Fatalf("expected the cache to stay at %d entries, got %d", maxIntrospectionCache, len(in.cache))
+	}
+
+	status, _ := OIDCStatus()
+	if len(status) != 1 || status[0].Source != sourceIntrospection || status[0].Introspection != stub.URL || !status[0].Ready() {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	// Failing client authentication is reported and rejects tokens.
+	t.Setenv("INTROSPECTION_SECRET", "wrong")
+	LoadOIDCConfig()
+	if code := call("opaque-user"); code != http.StatusUnauthorized {
+		t.Fatalf("expected rejection when the endpoint refuses the client, got %d", code)
+	}
+	if status, _ := OIDCStatus(); status[0].Ready() {
+		t.Fatalf("expected the endpoint error to be reported, got %+v", status)
+	}
+}
+
+func TestIntrospectionRouting(t *testing.T) {
+	var seen []string
+	endpoint := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = append(seen, name)
+			json.NewEncoder(w).Encode(map[string]interface{}{"active": true, "sub": "alice"})
+		}))
+	}
+	first, second := endpoint("first"), endpoint("second")
+	defer first.Close()
+	defer second.Close()
+	defer LoadOIDCConfig()
+
+	config := "providers:\n" +
+		"  - issuer: https://first.example\n    introspection:\n      endpoint: " + first.URL + "\n" +
+		"  - issuer: https://second.example\n    introspection:\n      endpoint: " + second.URL + "\n"
+	writeOIDCConfig(t, config)
+	if err := LoadOIDCConfig(); err == nil {
+		t.Fatal("expected several introspection providers without token prefixes to be rejected")
+	}
+	writeOIDCConfig(t, strings.Replace(strings.Replace(config, first.URL+"\n", first.URL+"\n      token_prefix: one_\n", 1),
+		second.URL+"\n", second.URL+"\n      token_prefix: two_\n", 1))
+	if err := LoadOIDCConfig(); err != nil {
+		t.Fatalf("load providers: %v", err)
+	}
+
+	handler := JWTMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	call := func(token string) int {
+		seen = nil
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if code := call("two_abc"); code != http.StatusOK || len(seen) != 1 || seen[0] != "second" {
+		t.Fatalf("expected the token to reach only the second endpoint, got %d %v", code, seen)
+	}
+	if code := call("three_abc"); code != http.StatusUnauthorized || len(seen) != 0 {
+		t.Fatalf("expected unrouted tokens to reach no endpoint, got %d %v", code, seen)
+	}
+	jwtTok, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"iss": "https://first.example", "sub": "alice"}).SignedString([]byte("any"))
+	if code := call(jwtTok); code != http.StatusOK || len(seen) != 1 || seen[0] != "first" {
+		t.Fatalf("expected the JWT to reach only its issuer's endpoint, got %d %v", code, seen)
+	}
+}
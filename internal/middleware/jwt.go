@@ -2,13 +2,13 @@ package middleware
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"strings"
 	"time"
 
-	"github.com/MicahParks/keyfunc"
 	jwt "github.com/golang-jwt/jwt/v4"
 	"gopkg.in/yaml.v2"
 )
@@ -16,143 +16,270 @@ import (
 type oidcProvider struct {
 	Issuer   string
 	Audience string
-	JWKS     *keyfunc.JWKS
+	// Keys is nil for providers verifying tokens only through introspection.
+	Keys *keySet
+	// Introspection verifies opaque tokens; it is nil when not configured.
+	Introspection *introspector
+	// Claims maps token claims to evaluation context keys.
+	Claims  map[string]string
+	Binding tenantBinding
 }
 
-var providers []oidcProvider
+var (
+	providers []oidcProvider
+	// loadErr is the error of the last LoadOIDCConfig. JWTMiddleware rejects
+	// every request while it is set rather than accept unverified tokens.
+	loadErr error
+	// stopWatch ends the JWKS file watcher of the current providers.
+	stopWatch context.CancelFunc
+)
+
+// keyWatchInterval is how often JWKS files are checked for changes.
+const keyWatchInterval = 30 * time.Second
+
+// strict rejects every request when no OIDC provider is configured instead of
+// accepting tokens unverified.
+var strict bool
 
-// LoadOIDCConfig loads OIDC provider configuration from environment variables or a YAML file.
-func LoadOIDCConfig() {
+// LoadOIDCConfig loads OIDC provider configuration from environment variables
+// or a YAML file. It fails when a configured provider cannot be initialised.
+func LoadOIDCConfig() error {
+	if stopWatch != nil {
+		stopWatch()
+		stopWatch = nil
+	}
+	for _, p := range providers {
+		if p.Keys != nil {
+			p.Keys.close()
+		}
+	}
 	providers = nil
-	loadFromEnv()
-	if len(providers) == 0 {
-		loadFromFile()
+	strict = os.Getenv("AUTH_STRICT") == "true"
+	if err := loadPeerTenants(); err != nil {
+		loadErr = err
+		return err
 	}
+	loaded, err := loadFromEnv()
+	if err == nil && len(loaded) == 0 {
+		loaded, err = loadFromFile()
+	}
+	if err != nil {
+		for _, p := range loaded {
+			if p.Keys != nil {
+				p.Keys.close()
+			}
+		}
+		loadErr = err
+		return err
+	}
+	providers, loadErr = loaded, nil
+	var files []*keySet
+	for _, p := range providers {
+		if p.Keys != nil && p.Keys.source == sourceJWKSFile {
+			files = append(files, p.Keys)
+		}
+	}
+	if len(files) > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		stopWatch = cancel
+		go watchKeys(ctx, files, keyWatchInterval)
+	}
+	return nil
 }
 
-func loadFromEnv() {
+func loadFromEnv() ([]oidcProvider, error) {
 	issuers := strings.Split(os.Getenv("OIDC_ISSUERS"), ",")
 	audiences := strings.Split(os.Getenv("OIDC_AUDIENCES"), ",")
+	files := strings.Split(os.Getenv("OIDC_JWKS_FILES"), ",")
 	if len(issuers) == 0 || issuers[0] == "" {
-		return
+		return nil, nil
 	}
+	var out []oidcProvider
 	for i := range issuers {
 		iss := strings.TrimSpace(issuers[i])
-		aud := ""
+		aud, file := "", ""
 		if i < len(audiences) {
 			aud = strings.TrimSpace(audiences[i])
 		}
+		if i < len(files) {
+			file = strings.TrimSpace(files[i])
+		}
 		if iss == "" {
 			continue
 		}
-		if jwks, err := fetchJWKS(iss); err == nil {
-			providers = append(providers, oidcProvider{Issuer: iss, Audience: aud, JWKS: jwks})
+		keys, err := newKeySet(keyConfig{Issuer: iss, JWKSFile: file})
+		if err != nil {
+			return out, fmt.Errorf("oidc provider %s: %w", iss, err)
 		}
+		out = append(out, oidcProvider{Issuer: iss, Audience: aud, Keys: keys, Binding: tenantBinding{Claim: os.Getenv("OIDC_TENANT_CLAIM")}})
 	}
+	return out, nil
 }
 
-func loadFromFile() {
+func loadFromFile() ([]oidcProvider, error) {
 	path := os.Getenv("OIDC_CONFIG_FILE")
 	if path == "" {
 		path = "configs/oidc.yaml"
 	}
 	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
 	if err != nil {
-		return
+		return nil, err
 	}
 	var cfg struct {
 		Providers []struct {
 			Issuer   string `yaml:"issuer"`
 			Audience string `yaml:"audience"`
+			// JWKSFile and Keys replace discovery from the issuer.
+			JWKSFile string            `yaml:"jwks_file"`
+			Keys     []staticKey       `yaml:"keys"`
+			Claims   map[string]string `yaml:"claims"`
+			// Tenant binds the provider's callers to one tenant; TenantClaim
+			// names the claim listing their tenants instead.
+			Tenant      string `yaml:"tenant"`
+			TenantClaim string `yaml:"tenant_claim"`
+			// Introspection verifies opaque tokens with an RFC 7662
+			// endpoint. Without jwks_file or keys the provider then
+			// skips discovery and verifies JWTs by introspection too.
+			Introspection *introspectionConfig `yaml:"introspection"`
 		} `yaml:"providers"`
 	}
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
 	}
-	for _, p := range cfg.Providers {
+	var out []oidcProvider
+	for i, p := range cfg.Providers {
 		if p.Issuer == "" {
-			continue
+			return out, fmt.Errorf("%s: provider %d: issuer is required", path, i+1)
 		}
-		if jwks, err := fetchJWKS(p.Issuer); err == nil {
-			providers = append(providers, oidcProvider{Issuer: p.Issuer, Audience: p.Audience, JWKS: jwks})
+		if err := validateMapping(p.Claims); err != nil {
+			return out, fmt.Errorf("oidc provider %s: %w", p.Issuer, err)
 		}
+		if p.Tenant != "" && p.TenantClaim != "" {
+			return out, fmt.Errorf("oidc provider %s: tenant and tenant_claim are mutually exclusive", p.Issuer)
+		}
+		prov := oidcProvider{
+			Issuer:   p.Issuer,
+			Audience: p.Audience,
+			Claims:   p.Claims,
+			Binding:  tenantBinding{Tenant: p.Tenant, Claim: p.TenantClaim},
+		}
+		if p.Introspection != nil {
+			if prov.Introspection, err = newIntrospector(*p.Introspection); err != nil {
+				return out, fmt.Errorf("oidc provider %s: %w", p.Issuer, err)
+			}
+		}
+		if p.Introspection == nil || p.JWKSFile != "" || len(p.Keys) > 0 {
+			if prov.Keys, err = newKeySet(keyConfig{Issuer: p.Issuer, JWKSFile: p.JWKSFile, Keys: p.Keys}); err != nil {
+				return out, fmt.Errorf("oidc provider %s: %w", p.Issuer, err)
+			}
+		}
+		out = append(out, prov)
 	}
-}
-
-func fetchJWKS(issuer string) (*keyfunc.JWKS, error) {
-	configURL := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
-	resp, err := http.Get(configURL)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	var conf struct {
-		JWKSURI string `json:"jwks_uri"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&conf); err != nil {
-		return nil, err
+	introspecting := 0
+	for _, p := range cfg.Providers {
+		if p.Introspection != nil {
+			introspecting++
+		}
 	}
-	interval := time.Hour
-	if s := os.Getenv("OIDC_JWKS_REFRESH_INTERVAL"); s != "" {
-		if d, err := time.ParseDuration(s); err == nil {
-			interval = d
+	for _, p := range cfg.Providers {
+		if introspecting > 1 && p.Introspection != nil && p.Introspection.TokenPrefix == "" {
+			return out, fmt.Errorf("oidc provider %s: introspection token_prefix is required with several introspection providers", p.Issuer)
 		}
 	}
-	return keyfunc.Get(conf.JWKSURI, keyfunc.Options{RefreshInterval: interval, RefreshTimeout: 5 * time.Second, RefreshUnknownKID: true})
+	return out, nil
 }
 
-// JWTMiddleware validates ID tokens using OIDC providers and JWKS.
+// JWTMiddleware validates ID tokens using OIDC providers and JWKS, or opaque
+// and JWT access tokens with the providers' introspection endpoints, and
+// stores the token's Claims in the request context. Without configured providers
+// tokens are accepted unverified, unless AUTH_STRICT is set; when the
+// providers failed to load every request with a token is rejected. Requests
+// without a token made over a verified client certificate are authenticated
+// by it.
 func JWTMiddleware(next http.Handler) http.Handler {
 	if len(providers) == 0 {
-		LoadOIDCConfig()
+		if err := LoadOIDCConfig(); err != nil {
+			log.Printf("oidc: %v", err)
+		}
 	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
+			// Callers without a token are identified by their client
+			// certificate.
+			if c, ok := peerClaims(r); ok {
+				next.ServeHTTP(w, withClaims(r, c))
+				return
+			}
 			http.Error(w, "Missing token", http.StatusUnauthorized)
 			return
 		}
+		if loadErr != nil {
+			http.Error(w, "Token verification unavailable", http.StatusServiceUnavailable)
+			return
+		}
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if len(providers) > 0 {
-			parser := jwt.Parser{}
-			unverified := jwt.MapClaims{}
-			if _, _, err := parser.ParseUnverified(tokenString, unverified); err != nil {
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
+		if len(providers) == 0 {
+			if strict {
+				http.Error(w, "No token verifier configured", http.StatusUnauthorized)
 				return
 			}
+			// Development mode: the token is accepted without verification and
+			// its claims are passed on marked as unverified.
+			unverified := jwt.MapClaims{}
+			if _, _, err := new(jwt.Parser).ParseUnverified(tokenString, unverified); err == nil {
+				r = r.WithContext(WithClaims(r.Context(), newClaims(unverified, false)))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		parser := jwt.Parser{}
+		unverified := jwt.MapClaims{}
+		var prov *oidcProvider
+		if _, _, err := parser.ParseUnverified(tokenString, unverified); err == nil {
 			iss, _ := unverified["iss"].(string)
-			audClaim := unverified["aud"]
-			var prov *oidcProvider
 			for i := range providers {
-				if providers[i].Issuer == iss && audienceMatch(audClaim, providers[i].Audience) {
+				if providers[i].Keys != nil && providers[i].Issuer == iss && audienceMatch(unverified["aud"], providers[i].Audience) {
 					prov = &providers[i]
 					break
 				}
 			}
-			if prov == nil {
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
-				return
-			}
-			claims := jwt.MapClaims{}
-			token, err := jwt.ParseWithClaims(tokenString, claims, prov.JWKS.Keyfunc)
-			if err != nil || !token.Valid {
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
-				return
-			}
-			if issClaim, _ := claims["iss"].(string); issClaim != prov.Issuer {
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
-				return
-			}
-			if !audienceMatch(claims["aud"], prov.Audience) {
+		}
+		if prov == nil {
+			// Opaque tokens, and JWTs of no provider with keys, are left to
+			// introspection.
+			c, ok := introspectToken(r.Context(), tokenString)
+			if !ok {
 				http.Error(w, "Invalid token", http.StatusUnauthorized)
 				return
 			}
-			if sub, _ := claims["sub"].(string); sub != "" {
-				ctx := context.WithValue(r.Context(), "subject", sub)
-				r = r.WithContext(ctx)
-			}
+			next.ServeHTTP(w, withClaims(r, c))
+			return
+		}
+		claims := jwt.MapClaims{}
+		token, err := jwt.ParseWithClaims(tokenString, claims, prov.Keys.Keyfunc)
+		if err != nil || !token.Valid {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+		if issClaim, _ := claims["iss"].(string); issClaim != prov.Issuer {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+		if !audienceMatch(claims["aud"], prov.Audience) {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+		c := newClaims(claims, true)
+		c.Attributes = mapClaims(claims, prov.Claims)
+		if prov.Binding.bound() {
+			c.TenantBound = true
+			c.Tenants = prov.Binding.tenants(claims)
 		}
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, withClaims(r, c))
 	})
 }
 
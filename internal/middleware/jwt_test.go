@@ -38,9 +38,11 @@ func TestJWTMiddleware(t *testing.T) {
 	}))
 	defer server.Close()
 
-	os.Setenv("OIDC_ISSUERS", server.URL)
-	os.Setenv("OIDC_AUDIENCES", "test-aud")
-	LoadOIDCConfig()
+	t.Setenv("OIDC_ISSUERS", server.URL)
+	t.Setenv("OIDC_AUDIENCES", "test-aud")
+	if err := LoadOIDCConfig(); err != nil {
+		t.Fatalf("load providers: %v", err)
+	}
 
 	makeToken := func(aud string, exp time.Time) string {
 		claims := jwt.MapClaims{
@@ -92,3 +94,96 @@ func TestJWTMiddleware(t *testing.T) {
 		}
 	})
 }
+
+func TestJWTMiddlewareWithoutProviders(t *testing.T) {
+	os.Setenv("OIDC_ISSUERS", "")
+	os.Setenv("OIDC_CONFIG_FILE", "/dev/null")
+	defer os.Unsetenv("AUTH_STRICT")
+
+	var got Claims
+	handler := JWTMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = ClaimsFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+	tok, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "u-1", "preferred_username": "alice"}).SignedString([]byte("any"))
+	call := func() int {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+tok)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	LoadOIDCConfig()
+	if code := call(); code != http.StatusOK {
+		t.Fatalf("expected unverified token to be accepted, got %d", code)
+	}
+	if got.Subject != "alice" || got.Verified {
+		t.Fatalf("expected unverified claims for alice, got %+v", got)
+	}
+
+	os.Setenv("AUTH_STRICT", "true")
+	LoadOIDCConfig()
+	if code := call(); code != http.StatusUnauthorized {
+		t.Fatalf("expected strict mode to reject requests without a verifier, got %d", code)
+	}
+}
+
+func TestMapClaims(t *testing.T) {
+	raw := jwt.MapClaims{
+		"groups":       []interface{}{"staff", "finance"},
+		"acr":          "2",
+		"amr":          []interface{}{"pwd", "mfa"},
+		"email":        "Carol@Example.com",
+		"realm_access": map[string]interface{}{"roles": []interface{}{"approver"}},
+		"mixed":        []interface{}{"a", map[string]interface{}{}},
+	}
+	mapping := map[string]string{
+		"groups":             "subject.groups",
+		"acr":                "auth.level",
+		"amr":                "auth.methods",
+		"email_domain":       "subject.email_domain",
+		"realm_access.roles": "subject.roles",
+		"mixed":              "subject.mixed",
+		"department":         "subject.department",
+	}
+	if err := validateMapping(mapping); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	got := mapClaims(raw, mapping)
+	want := map[string]string{
+		"subject.groups":       "staff,finance",
+		"auth.level":           "2",
+		"auth.methods":         "pwd,mfa",
+		"subject.email_domain": "example.com",
+		"subject.roles":        "approver",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected attributes %v", got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("expected %s=%s, got %v", k, v, got)
+		}
+	}
+	if err := validateMapping(map[string]string{"groups": "roles"}); err == nil {
+		t.Fatal("expected a target outside the claim namespaces to be rejected")
+	}
+}
+
+func TestTenantBindingClaims(t *testing.T) {
+	raw := jwt.MapClaims{"org_id": "acme", "orgs": []interface{}{"acme", "globex"}}
+	if got := (tenantBinding{Tenant: "initech"}).tenants(raw); len(got) != 1 || got[0] != "initech" {
+		t.Fatalf("expected fixed tenant, got %v", got)
+	}
+	if got := (tenantBinding{Claim: "orgs"}).tenants(raw); len(got) != 2 || got[1] != "globex" {
+		t.Fatalf("expected tenants from list claim, got %v", got)
+	}
+	c := Claims{Verified: true, TenantBound: true, Tenants: (tenantBinding{Claim: "org_id"}).tenants(raw)}
+	if !c.InTenant("acme") || c.InTenant("globex") {
+		t.Fatalf("unexpected tenant check for %v", c.Tenants)
+	}
+	if c := (Claims{Verified: true, TenantBound: true}); c.InTenant("acme") {
+		t.Fatal("expected a token without the tenant claim to be bound to no tenant")
+	}
+}
@@ -0,0 +1,288 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/keyfunc"
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+// Key sources of a provider.
+const (
+	sourceDiscovery = "discovery"
+	sourceJWKSFile  = "jwks_file"
+	sourceKeys      = "keys"
+)
+
+// staticKey is a public key, or certificate, configured inline as PEM.
+type staticKey struct {
+	KID string `yaml:"kid"`
+	PEM string `yaml:"pem"`
+}
+
+// keyConfig selects where a provider's verification keys come from: a local
+// JWKS file, inline keys, or by default OIDC discovery from the issuer.
+type keyConfig struct {
+	Issuer   string
+	JWKSFile string
+	Keys     []staticKey
+}
+
+// keySet holds the verification keys of a provider and when they were last
+// loaded.
+type keySet struct {
+	source  string
+	path    string
+	mu      sync.RWMutex
+	jwks    *keyfunc.JWKS
+	loaded  time.Time
+	modTime time.Time
+	size    int64
+	err     error
+}
+
+func newKeySet(cfg keyConfig) (*keySet, error) {
+	switch {
+	case cfg.JWKSFile != "" && len(cfg.Keys) > 0:
+		return nil, errors.New("jwks_file and keys are mutually exclusive")
+	case cfg.JWKSFile != "":
+		k := &keySet{source: sourceJWKSFile, path: cfg.JWKSFile}
+		if _, err := k.reload(); err != nil {
+			return nil, err
+		}
+		return k, nil
+	case len(cfg.Keys) > 0:
+		given := make(map[string]keyfunc.GivenKey, len(cfg.Keys))
+		for i, sk := range cfg.Keys {
+			if sk.KID == "" && len(cfg.Keys) > 1 {
+				return nil, fmt.Errorf("key %d: kid is required when several keys are configured", i+1)
+			}
+			if _, ok := given[sk.KID]; ok {
+				return nil, fmt.Errorf("key %d: duplicate kid %q", i+1, sk.KID)
+			}
+			key, err := parsePEM(sk.PEM)
+			if err != nil {
+				return nil, fmt.Errorf("key %d: %w", i+1, err)
+			}
+			given[sk.KID] = key
+		}
+		return &keySet{source: sourceKeys, jwks: keyfunc.NewGiven(given), loaded: time.Now()}, nil
+	default:
+		k := &keySet{source: sourceDiscovery}
+		jwks, err := fetchJWKS(cfg.Issuer, k)
+		if err != nil {
+			return nil, err
+		}
+		k.mu.Lock()
+		k.jwks = jwks
+		k.mu.Unlock()
+		return k, nil
+	}
+}
+
+// parsePEM parses an RSA, ECDSA or Ed25519 public key or certificate.
+func parsePEM(data string) (keyfunc.GivenKey, error) {
+	if rsaKey, err := jwt.ParseRSAPublicKeyFromPEM([]byte(data)); err == nil {
+		return keyfunc.NewGivenRSA(rsaKey), nil
+	}
+	if ecKey, err := jwt.ParseECPublicKeyFromPEM([]byte(data)); err == nil {
+		return keyfunc.NewGivenECDSA(ecKey), nil
+	}
+	if edKey, err := jwt.ParseEdPublicKeyFromPEM([]byte(data)); err == nil {
+		if key, ok := edKey.(ed25519.PublicKey); ok {
+			return keyfunc.NewGivenEdDSA(key), nil
+		}
+	}
+	return keyfunc.GivenKey{}, errors.New("pem is not an RSA, ECDSA or Ed25519 public key or certificate")
+}
+
+// reload rereads the JWKS file when it changed. A file that cannot be read or
+// parsed leaves the current keys in place.
+func (k *keySet) reload() (bool, error) {
+	fi, err := os.Stat(k.path)
+	if err != nil {
+		return false, k.fail(err)
+	}
+	k.mu.RLock()
+	unchanged := k.jwks != nil && fi.ModTime().Equal(k.modTime) && fi.Size() == k.size
+	k.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	data, err := os.ReadFile(k.path)
+	if err != nil {
+		return false, k.fail(err)
+	}
+	jwks, err := keyfunc.NewJSON(data)
+	if err != nil {
+		return false, k.fail(fmt.Errorf("%s: %w", k.path, err))
+	}
+	if jwks.Len() == 0 {
+		return false, k.fail(fmt.Errorf("%s: no usable keys", k.path))
+	}
+	k.mu.Lock()
+	k.jwks, k.loaded, k.modTime, k.size, k.err = jwks, time.Now(), fi.ModTime(), fi.Size(), nil
+	k.mu.Unlock()
+	return true, nil
+}
+
+func (k *keySet) fail(err error) error {
+	k.mu.Lock()
+	k.err = err
+	k.mu.Unlock()
+	return err
+}
+
+// touch records a successful load of remote keys.
+func (k *keySet) touch() {
+	k.mu.Lock()
+	k.loaded, k.err = time.Now(), nil
+	k.mu.Unlock()
+}
+
+// Keyfunc returns the key verifying token. A token without a kid is verified
+// with the only key of a single-key set.
+func (k *keySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	k.mu.RLock()
+	jwks := k.jwks
+	k.mu.RUnlock()
+	if jwks == nil {
+		return nil, errors.New("no keys loaded")
+	}
+	if _, ok := token.Header["kid"]; !ok {
+		if keys := jwks.ReadOnlyKeys(); len(keys) == 1 {
+			for _, key := range keys {
+				return key, nil
+			}
+		}
+	}
+	return jwks.Keyfunc(token)
+}
+
+func (k *keySet) close() {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.jwks != nil {
+		k.jwks.EndBackground()
+	}
+}
+
+// ProviderStatus describes the keys of an OIDC provider.
+type ProviderStatus struct {
+	Issuer   string `json:"issuer"`
+	Audience string `json:"audience,omitempty"`
+	Source   string `json:"source"`
+	// Introspection is the provider's introspection endpoint, if any.
+	Introspection string    `json:"introspection,omitempty"`
+	KIDs          []string  `json:"kids"`
+	LoadedAt      time.Time `json:"loaded_at"`
+	AgeSeconds    int64     `json:"age_seconds"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// Ready reports whether the provider can verify tokens: it has keys, or
+// verifies them through introspection, and its last refresh succeeded.
+func (s ProviderStatus) Ready() bool {
+	return s.Error == "" && (len(s.KIDs) > 0 || s.Source == sourceIntrospection)
+}
+
+func (k *keySet) status() ProviderStatus {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	s := ProviderStatus{Source: k.source, KIDs: []string{}, LoadedAt: k.loaded}
+	if k.jwks != nil {
+		s.KIDs = k.jwks.KIDs()
+		sort.Strings(s.KIDs)
+	}
+	if !k.loaded.IsZero() {
+		s.AgeSeconds = int64(time.Since(k.loaded).Seconds())
+	}
+	if k.err != nil {
+		s.Error = k.err.Error()
+	}
+	return s
+}
+
+// OIDCStatus reports the keys of every configured provider, and the error of
+// the last configuration load when it failed.
+func OIDCStatus() ([]ProviderStatus, error) {
+	out := make([]ProviderStatus, 0, len(providers))
+	for _, p := range providers {
+		s := ProviderStatus{Source: sourceIntrospection, KIDs: []string{}}
+		if p.Keys != nil {
+			s = p.Keys.status()
+		}
+		s.Issuer, s.Audience = p.Issuer, p.Audience
+		if p.Introspection != nil {
+			s.Introspection = p.Introspection.endpoint
+			if err := p.Introspection.lastErr(); err != nil && s.Error == "" {
+				s.Error = err.Error()
+			}
+		}
+		out = append(out, s)
+	}
+	return out, loadErr
+}
+
+// watchKeys reloads changed JWKS files every interval until ctx is done.
+func watchKeys(ctx context.Context, sets []*keySet, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, k := range sets {
+				k.reload()
+			}
+		}
+	}
+}
+
+func fetchJWKS(issuer string, k *keySet) (*keyfunc.JWKS, error) {
+	configURL := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	resp, err := http.Get(configURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery returned %s", resp.Status)
+	}
+	var conf struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&conf); err != nil {
+		return nil, err
+	}
+	interval := time.Hour
+	if s := os.Getenv("OIDC_JWKS_REFRESH_INTERVAL"); s != "" {
+		if d, err := time.ParseDuration(s); err == nil {
+			interval = d
+		}
+	}
+	return keyfunc.Get(conf.JWKSURI, keyfunc.Options{
+		RefreshInterval:     interval,
+		RefreshTimeout:      5 * time.Second,
+		RefreshUnknownKID:   true,
+		RefreshErrorHandler: func(err error) { k.fail(err) },
+		ResponseExtractor: func(ctx context.Context, resp *http.Response) (json.RawMessage, error) {
+			raw, err := keyfunc.ResponseExtractorStatusOK(ctx, resp)
+			if err == nil {
+				k.touch()
+			}
+			return raw, err
+		},
+	})
+}
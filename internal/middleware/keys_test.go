@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	jose "gopkg.in/go-jose/go-jose.v2"
+)
+
+const keysIssuer = "https://idp.internal"
+
+func writeJWKS(t *testing.T, path string, keys ...jose.JSONWebKey) {
+	t.Helper()
+	data, _ := json.Marshal(jose.JSONWebKeySet{Keys: keys})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write jwks: %v", err)
+	}
+}
+
+func writeOIDCConfig(t *testing.T, yaml string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "oidc.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	t.Setenv("OIDC_ISSUERS", "")
+	t.Setenv("OIDC_CONFIG_FILE", path)
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, key interface{}, kid string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, jwt.MapClaims{
+		"iss": keysIssuer,
+		"sub": "tester",
+		"aud": "test-aud",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	str, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return str
+}
+
+func serve(token string) int {
+	handler := JWTMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr.Code
+}
+
+func TestJWKSFile(t *testing.T) {
+	oldPriv, _ := rsa.GenerateKey(rand.Reader, 2048)
+	newPriv, _ := rsa.GenerateKey(rand.Reader, 2048)
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwksPath, jose.JSONWebKey{Key: &oldPriv.PublicKey, KeyID: "old", Algorithm: "RS256", Use: "sig"})
+	writeOIDCConfig(t, "providers:\n  - issuer: "+keysIssuer+"\n    audience: test-aud\n    jwks_file: "+jwksPath+"\n")
+	if err := LoadOIDCConfig(); err != nil {
+		t.Fatalf("load providers: %v", err)
+	}
+	defer LoadOIDCConfig()
+
+	if code := serve(signToken(t, jwt.SigningMethodRS256, oldPriv, "old")); code != http.StatusOK {
+		t.Fatalf("expected token signed with the file key to be accepted, got %d", code)
+	}
+	status, err := OIDCStatus()
+	if err != nil || len(status) != 1 || status[0].Source != sourceJWKSFile || strings.Join(status[0].KIDs, ",") != "old" {
+		t.Fatalf("unexpected status %+v %v", status, err)
+	}
+
+	// Rotate the file; the watcher picks up the new keys.
+	writeJWKS(t, jwksPath, jose.JSONWebKey{Key: &newPriv.PublicKey, KeyID: "new", Algorithm: "RS256", Use: "sig"})
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(jwksPath, future, future)
+	if changed, err := providers[0].Keys.reload(); !changed || err != nil {
+		t.Fatalf("expected the changed file to be reloaded, got %v %v", changed, err)
+	}
+	if code := serve(signToken(t, jwt.SigningMethodRS256, newPriv, "new")); code != http.StatusOK {
+		t.Fatalf("expected token signed with the rotated key to be accepted, got %d", code)
+	}
+	if code := serve(signToken(t, jwt.SigningMethodRS256, oldPriv, "old")); code != http.StatusUnauthorized {
+		t.Fatalf("expected token signed with the removed key to be rejected, got %d", code)
+	}
+
+	// A broken file keeps the last good keys and is reported.
+	os.WriteFile(jwksPath, []byte("{"), 0o600)
+	os.Chtimes(jwksPath, future.Add(time.Minute), future.Add(time.Minute))
+	if _, err := providers[0].Keys.reload(); err == nil {
+		t.Fatal("expected a broken file to fail to reload")
+	}
+	if code := serve(signToken(t, jwt.SigningMethodRS256, newPriv, "new")); code != http.StatusOK {
+		t.Fatalf("expected the last good keys to be kept, got %d", code)
+	}
+	if status, _ := OIDCStatus(); status[0].Error == "" {
+		t.Fatalf("expected the reload error to be reported, got %+v", status)
+	}
+}
+
+func TestStaticKeys(t *testing.T) {
+	rsaPriv, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecPriv, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	pemOf := func(pub interface{}) string {
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			t.Fatalf("marshal key: %v", err)
+		}
+		block := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+		return "|\n          " + strings.ReplaceAll(strings.TrimSpace(string(block)), "\n", "\n          ")
+	}
+
+	writeOIDCConfig(t, "providers:\n  - issuer: "+keysIssuer+"\n    audience: test-aud\n    keys:\n"+
+		"      - kid: rsa1\n        pem: "+pemOf(&rsaPriv.PublicKey)+"\n"+
+		"      - kid: ec1\n        pem: "+pemOf(&ecPriv.PublicKey)+"\n")
+	if err := LoadOIDCConfig(); err != nil {
+		t.Fatalf("load providers: %v", err)
+	}
+	defer LoadOIDCConfig()
+	if code := serve(signToken(t, jwt.SigningMethodRS256, rsaPriv, "rsa1")); code != http.StatusOK {
+		t.Fatalf("expected RSA signed token to be accepted, got %d", code)
+	}
+	if code := serve(signToken(t, jwt.SigningMethodES256, ecPriv, "ec1")); code != http.StatusOK {
+		t.Fatalf("expected ECDSA signed token to be accepted, got %d", code)
+	}
+	if code := serve(signToken(t, jwt.SigningMethodES256, ecPriv, "")); code != http.StatusUnauthorized {
+		t.Fatalf("expected token without kid to be rejected by a multi-key set, got %d", code)
+	}
+
+	// A single key may omit its kid and verifies tokens without one.
+	writeOIDCConfig(t, "providers:\n  - issuer: "+keysIssuer+"\n    audience: test-aud\n    keys:\n"+
+		"      - pem: "+pemOf(&ecPriv.PublicKey)+"\n")
+	if err := LoadOIDCConfig(); err != nil {
+		t.Fatalf("load providers: %v", err)
+	}
+	if code := serve(signToken(t, jwt.SigningMethodES256, ecPriv, "")); code != http.StatusOK {
+		t.Fatalf("expected token without kid to be accepted by a single key, got %d", code)
+	}
+}
+
+func TestOIDCStartupFailure(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	defer LoadOIDCConfig()
+
+	cases := map[string]string{
+		"unreachable issuer": "providers:\n  - issuer: " + down.URL + "\n",
+		"missing jwks file":  "providers:\n  - issuer: " + keysIssuer + "\n    jwks_file: " + filepath.Join(t.TempDir(), "missing.json") + "\n",
+		"invalid pem":        "providers:\n  - issuer: " + keysIssuer + "\n    keys:\n      - pem: nope\n",
+		"both key sources":   "providers:\n  - issuer: " + keysIssuer + "\n    jwks_file: jwks.json\n    keys:\n      - pem: nope\n",
+	}
+	for name, cfg := range cases {
+		t.Run(name, func(t *testing.T) {
+			writeOIDCConfig(t, cfg)
+			if err := LoadOIDCConfig(); err == nil {
+				t.Fatal("expected provider initialisation to fail")
+			}
+			if _, err := OIDCStatus(); err == nil {
+				t.Fatal("expected the load error to be reported")
+			}
+			tok, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "u-1"}).SignedString([]byte("any"))
+			if code := serve(tok); code != http.StatusServiceUnavailable {
+				t.Fatalf("expected requests to be rejected while providers are unavailable, got %d", code)
+			}
+		})
+	}
+
+	t.Setenv("OIDC_CONFIG_FILE", "/dev/null")
+	t.Setenv("OIDC_ISSUERS", down.URL)
+	if err := LoadOIDCConfig(); err == nil {
+		t.Fatal("expected an unreachable issuer from the environment to fail")
+	}
+}
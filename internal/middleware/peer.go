@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/bradtumy/authorization-service/internal/tlsconfig"
+)
+
+// Context keys of the caller's verified client certificate.
+const (
+	PeerKey     = "auth.peer"
+	SPIFFEIDKey = "auth.spiffe_id"
+)
+
+// PeerIdentity returns the identity of the verified client certificate r was
+// made with: its SPIFFE ID, or else its subject. Certificates that were
+// presented but not verified are ignored.
+func PeerIdentity(r *http.Request) (id, spiffeID string, ok bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", "", false
+	}
+	leaf := r.TLS.VerifiedChains[0][0]
+	spiffeID = tlsconfig.SPIFFEID(leaf)
+	if spiffeID != "" {
+		return spiffeID, spiffeID, true
+	}
+	return leaf.Subject.String(), "", true
+}
+
+// peerTenant binds the client certificates whose identity is, or for SPIFFE
+// IDs starts with, prefix to tenant. The tenant "*" lets them act in any.
+type peerTenant struct {
+	prefix string
+	tenant string
+}
+
+// peerTenants holds the bindings read from TLS_PEER_TENANTS.
+var peerTenants []peerTenant
+
+// loadPeerTenants reads TLS_PEER_TENANTS, semicolon-separated
+// <identity>=<tenant> entries such as "spiffe://acme.local=acme". The
+// identity is split from the tenant at the last "=", so certificate subjects
+// like "CN=orders,O=acme=acme" can be bound too.
+func loadPeerTenants() error {
+	peerTenants = nil
+	for _, entry := range strings.Split(os.Getenv("TLS_PEER_TENANTS"), ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		i := strings.LastIndex(entry, "=")
+		if i <= 0 || i == len(entry)-1 {
+			return fmt.Errorf("TLS_PEER_TENANTS entry %q must be <identity>=<tenant>", entry)
+		}
+		peerTenants = append(peerTenants, peerTenant{prefix: strings.TrimSpace(entry[:i]), tenant: strings.TrimSpace(entry[i+1:])})
+	}
+	return nil
+}
+
+// matches reports whether the binding applies to the caller id. SPIFFE IDs
+// match a trust domain or path prefix on a path segment boundary.
+func (b peerTenant) matches(id string) bool {
+	if id == b.prefix {
+		return true
+	}
+	if !strings.HasPrefix(b.prefix, "spiffe://") {
+		return false
+	}
+	return strings.HasPrefix(id, strings.TrimSuffix(b.prefix, "/")+"/")
+}
+
+// peerClaims returns the Claims of a caller authenticated only by its client
+// certificate. The caller is bound to the tenants of the TLS_PEER_TENANTS
+// entries matching it, and to none without one, so it cannot act in any
+// tenant it was not bound to.
+func peerClaims(r *http.Request) (Claims, bool) {
+	id, _, ok := PeerIdentity(r)
+	if !ok {
+		return Claims{}, false
+	}
+	c := Claims{Subject: id, Verified: true, TenantBound: true}
+	for _, b := range peerTenants {
+		if !b.matches(id) {
+			continue
+		}
+		if b.tenant == "*" {
+			c.TenantBound, c.Tenants = false, nil
+			break
+		}
+		c.Tenants = append(c.Tenants, b.tenant)
+	}
+	return c, true
+}
+
+// withClaims stores c in the request context. Verified callers that made the
+// request over a verified client certificate also carry its identity, in Peer
+// and the PeerKey and SPIFFEIDKey attributes.
+func withClaims(r *http.Request, c Claims) *http.Request {
+	if id, spiffeID, ok := PeerIdentity(r); ok && c.Verified {
+		c.Peer = id
+		attrs := make(map[string]string, len(c.Attributes)+2)
+		for k, v := range c.Attributes {
+			attrs[k] = v
+		}
+		attrs[PeerKey] = id
+		if spiffeID != "" {
+			attrs[SPIFFEIDKey] = spiffeID
+		}
+		c.Attributes = attrs
+	}
+	return r.WithContext(WithClaims(r.Context(), c))
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+func TestClientCertificateIdentity(t *testing.T) {
+	t.Setenv("OIDC_ISSUERS", "")
+	t.Setenv("OIDC_CONFIG_FILE", "/dev/null")
+	LoadOIDCConfig()
+
+	spiffe, _ := url.Parse("spiffe://mesh.local/ns/shop/sa/orders")
+	withCert := func(r *http.Request, cert *x509.Certificate) *http.Request {
+		r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		return r
+	}
+	var got Claims
+	handler := JWTMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = ClaimsFromContext(r.Context())
+	}))
+	serveReq := func(r *http.Request) int {
+		got = Claims{}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr.Code
+	}
+
+	mesh := &x509.Certificate{Subject: pkix.Name{CommonName: "orders"}, URIs: []*url.URL{spiffe}}
+	if code := serveReq(withCert(httptest.NewRequest("GET", "/", nil), mesh)); code != http.StatusOK {
+		t.Fatalf("expected the client certificate to authenticate, got %d", code)
+	}
+	if got.Subject != spiffe.String() || !got.Verified || got.Peer != spiffe.String() || got.Attributes[SPIFFEIDKey] != spiffe.String() {
+		t.Fatalf("expected the SPIFFE ID as caller, got %+v", got)
+	}
+	if !got.TenantBound || len(got.Tenants) != 0 {
+		t.Fatalf("expected a certificate without a binding to be bound to no tenant, got %+v", got)
+	}
+
+	plain := &x509.Certificate{Subject: pkix.Name{CommonName: "batch", Organization: []string{"acme"}}}
+	serveReq(withCert(httptest.NewRequest("GET", "/", nil), plain))
+	if got.Subject != "CN=batch,O=acme" || got.Attributes[PeerKey] != "CN=batch,O=acme" || got.Attributes[SPIFFEIDKey] != "" {
+		t.Fatalf("expected the certificate subject as caller, got %+v", got)
+	}
+
+	// Presented but unverified certificates do not authenticate.
+	r := httptest.NewRequest("GET", "/", nil)
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{mesh}}
+	if code := serveReq(r); code != http.StatusUnauthorized {
+		t.Fatalf("expected an unverified certificate to be rejected, got %d", code)
+	}
+
+	// Unverified development tokens do not carry the peer identity.
+	tok, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "alice"}).SignedString([]byte("any"))
+	r = withCert(httptest.NewRequest("GET", "/", nil), mesh)
+	r.Header.Set("Authorization", "Bearer "+tok)
+	serveReq(r)
+	if got.Subject != "alice" || got.Peer != "" || got.Attributes[PeerKey] != "" {
+		t.Fatalf("expected the token's caller without peer identity, got %+v", got)
+	}
+}
+
+func TestClientCertificateTenants(t *testing.T) {
+	t.Cleanup(func() { LoadOIDCConfig() })
+	t.Setenv("OIDC_ISSUERS", "")
+	t.Setenv("OIDC_CONFIG_FILE", "/dev/null")
+	t.Setenv("TLS_PEER_TENANTS", "spiffe://acme.local=acme; spiffe://mesh.local/ns/ops/=*; CN=batch,O=acme=acme")
+	if err := LoadOIDCConfig(); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	claims := func(cert *x509.Certificate) Claims {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		c, _ := peerClaims(r)
+		return c
+	}
+	spiffe := func(id string) *x509.Certificate {
+		u, _ := url.Parse(id)
+		return &x509.Certificate{URIs: []*url.URL{u}}
+	}
+
+	if c := claims(spiffe("spiffe://acme.local/ns/shop/sa/orders")); !c.InTenant("acme") || c.InTenant("globex") {
+		t.Fatalf("expected the trust domain to bind to acme, got %+v", c)
+	}
+	if c := claims(spiffe("spiffe://acme.local.evil/sa/orders")); c.InTenant("acme") {
+		t.Fatalf("expected another trust domain not to match, got %+v", c)
+	}
+	if c := claims(spiffe("spiffe://mesh.local/ns/ops/sa/deployer")); !c.InTenant("acme") || !c.InTenant("globex") {
+		t.Fatalf("expected * to allow every tenant, got %+v", c)
+	}
+	if c := claims(&x509.Certificate{Subject: pkix.Name{CommonName: "batch", Organization: []string{"acme"}}}); !c.InTenant("acme") {
+		t.Fatalf("expected the subject to bind to acme, got %+v", c)
+	}
+
+	t.Setenv("TLS_PEER_TENANTS", "spiffe://acme.local")
+	if err := LoadOIDCConfig(); err == nil {
+		t.Fatal("expected an entry without a tenant to be rejected")
+	}
+}
@@ -0,0 +1,229 @@
+// Package tlsconfig serves TLS, and optionally mutual TLS, from certificate
+// files that are reloaded when they change.
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config selects the server certificate and how clients authenticate.
+type Config struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile holds the CAs client certificates are verified against.
+	ClientCAFile string
+	ClientAuth   tls.ClientAuthType
+	// TrustDomains, when set, only admit client certificates carrying a
+	// SPIFFE ID in one of them.
+	TrustDomains []string
+}
+
+// clientAuthModes are the values of TLS_CLIENT_AUTH.
+var clientAuthModes = map[string]tls.ClientAuthType{
+	"none":            tls.NoClientCert,
+	"request":         tls.RequestClientCert,
+	"verify-if-given": tls.VerifyClientCertIfGiven,
+	"require":         tls.RequireAndVerifyClientCert,
+}
+
+// FromEnv reads TLS_CERT_FILE, TLS_KEY_FILE, TLS_CLIENT_CA_FILE,
+// TLS_CLIENT_AUTH and TLS_SPIFFE_TRUST_DOMAINS. It returns nil when
+// TLS_CERT_FILE is unset. Client certificates are required by default when a
+// client CA is configured.
+func FromEnv() (*Config, error) {
+	cfg := &Config{
+		CertFile:     os.Getenv("TLS_CERT_FILE"),
+		KeyFile:      os.Getenv("TLS_KEY_FILE"),
+		ClientCAFile: os.Getenv("TLS_CLIENT_CA_FILE"),
+	}
+	if cfg.CertFile == "" {
+		if cfg.KeyFile != "" || cfg.ClientCAFile != "" {
+			return nil, errors.New("TLS_CERT_FILE is required with TLS_KEY_FILE or TLS_CLIENT_CA_FILE")
+		}
+		return nil, nil
+	}
+	if cfg.KeyFile == "" {
+		return nil, errors.New("TLS_KEY_FILE is required with TLS_CERT_FILE")
+	}
+	mode := os.Getenv("TLS_CLIENT_AUTH")
+	if mode == "" {
+		mode = "none"
+		if cfg.ClientCAFile != "" {
+			mode = "require"
+		}
+	}
+	auth, ok := clientAuthModes[mode]
+	if !ok {
+		return nil, fmt.Errorf("invalid TLS_CLIENT_AUTH %s: must be none, request, verify-if-given or require", mode)
+	}
+	cfg.ClientAuth = auth
+	if s := os.Getenv("TLS_SPIFFE_TRUST_DOMAINS"); s != "" {
+		for _, td := range strings.Split(s, ",") {
+			if td = strings.TrimSpace(td); td != "" {
+				cfg.TrustDomains = append(cfg.TrustDomains, td)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// Server holds the current certificate and client CAs of a Config.
+type Server struct {
+	cfg Config
+
+	mu     sync.RWMutex
+	cert   *tls.Certificate
+	pool   *x509.CertPool
+	stamps map[string]stamp
+}
+
+type stamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// New loads the files of cfg.
+func New(cfg Config) (*Server, error) {
+	if cfg.ClientAuth >= tls.VerifyClientCertIfGiven && cfg.ClientCAFile == "" {
+		return nil, errors.New("verifying client certificates requires a client CA file")
+	}
+	if len(cfg.TrustDomains) > 0 && cfg.ClientAuth < tls.VerifyClientCertIfGiven {
+		return nil, errors.New("SPIFFE trust domains require verified client certificates")
+	}
+	s := &Server{cfg: cfg}
+	if _, err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload rereads the files when any of them changed. Files that cannot be
+// loaded leave the current certificate and CAs in place.
+func (s *Server) Reload() (bool, error) {
+	files := []string{s.cfg.CertFile, s.cfg.KeyFile}
+	if s.cfg.ClientCAFile != "" {
+		files = append(files, s.cfg.ClientCAFile)
+	}
+	stamps := make(map[string]stamp, len(files))
+	for _, f := range files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return false, err
+		}
+		stamps[f] = stamp{fi.ModTime(), fi.Size()}
+	}
+	s.mu.RLock()
+	unchanged := s.stamps != nil
+	for f, st := range stamps {
+		if s.stamps[f] != st {
+			unchanged = false
+		}
+	}
+	s.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	cert, err := tls.LoadX509KeyPair(s.cfg.CertFile, s.cfg.KeyFile)
+	if err != nil {
+		return false, err
+	}
+	var pool *x509.CertPool
+	if s.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(s.cfg.ClientCAFile)
+		if err != nil {
+			return false, err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return false, fmt.Errorf("%s: no certificates found", s.cfg.ClientCAFile)
+		}
+	}
+	s.mu.Lock()
+	s.cert, s.pool, s.stamps = &cert, pool, stamps
+	s.mu.Unlock()
+	return true, nil
+}
+
+// Watch reloads changed files every interval until ctx is done.
+func (s *Server) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if changed, err := s.Reload(); err != nil {
+				log.Printf("tls: reload: %v", err)
+			} else if changed {
+				log.Printf("tls: reloaded certificates")
+			}
+		}
+	}
+}
+
+// TLSConfig returns the server configuration. Every handshake uses the
+// certificate and CAs current at the time, and the application protocols of
+// the returned configuration, HTTP/2 and HTTP/1.1 unless changed.
+func (s *Server) TLSConfig() *tls.Config {
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		cfg := &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{*s.cert},
+			ClientAuth:   s.cfg.ClientAuth,
+			ClientCAs:    s.pool,
+			NextProtos:   base.NextProtos,
+		}
+		if len(s.cfg.TrustDomains) > 0 {
+			cfg.VerifyPeerCertificate = s.verifyTrustDomain
+		}
+		return cfg, nil
+	}
+	return base
+}
+
+// verifyTrustDomain admits verified client certificates whose SPIFFE ID is in
+// one of the trust domains.
+func (s *Server) verifyTrustDomain(_ [][]byte, chains [][]*x509.Certificate) error {
+	if len(chains) == 0 {
+		return nil
+	}
+	id := SPIFFEID(chains[0][0])
+	if id == "" {
+		return errors.New("client certificate has no SPIFFE ID")
+	}
+	u, _ := url.Parse(id)
+	for _, td := range s.cfg.TrustDomains {
+		if u.Host == td {
+			return nil
+		}
+	}
+	return fmt.Errorf("SPIFFE ID %s is not in a trusted domain", id)
+}
+
+// SPIFFEID returns the SPIFFE ID of cert, the URI SAN with the spiffe
+// scheme, or "" when it has none.
+func SPIFFEID(cert *x509.Certificate) string {
+	for _, u := range cert.URIs {
+		if u.Scheme == "spiffe" && u.Host != "" {
+			return u.String()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,215 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+var serial int64
+
+// issue creates a certificate signed by ca, or a self-signed CA when ca is nil.
+func issue(t *testing.T, ca *testCert, cn string, uris ...string) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("key: %v", err)
+	}
+	serial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	for _, u := range uris {
+		parsed, _ := url.Parse(u)
+		tmpl.URIs = append(tmpl.URIs, parsed)
+	}
+	parent, signer := tmpl, key
+	if ca == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+	} else {
+		parent, signer = ca.cert, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatalf("certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (c *testCert) keyPEM(t *testing.T) []byte {
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func (c *testCert) pair(t *testing.T) tls.Certificate {
+	pair, err := tls.X509KeyPair(c.pem, c.keyPEM(t))
+	if err != nil {
+		t.Fatalf("key pair: %v", err)
+	}
+	return pair
+}
+
+func write(t *testing.T, path string, data []byte, mod time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+	os.Chtimes(path, mod, mod)
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := issue(t, nil, "test-ca")
+	server := issue(t, ca, "authz")
+	cfg := Config{
+		CertFile:     filepath.Join(dir, "tls.crt"),
+		KeyFile:      filepath.Join(dir, "tls.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		TrustDomains: []string{"mesh.local"},
+	}
+	now := time.Now()
+	write(t, cfg.CertFile, server.pem, now)
+	write(t, cfg.KeyFile, server.keyPEM(t), now)
+	write(t, cfg.ClientCAFile, ca.pem, now)
+
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", s.TLSConfig())
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, SPIFFEID(r.TLS.VerifiedChains[0][0]))
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(client *testCert) (string, *x509.Certificate, error) {
+		tc := &tls.Config{RootCAs: roots}
+		if client != nil {
+			tc.Certificates = []tls.Certificate{client.pair(t)}
+		}
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: tc, DisableKeepAlives: true}}
+		resp, err := c.Get("https://" + ln.Addr().String())
+		if err != nil {
+			return "", nil, err
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body), resp.TLS.PeerCertificates[0], nil
+	}
+
+	id, served, err := get(issue(t, ca, "orders", "spiffe://mesh.local/ns/shop/sa/orders"))
+	if err != nil || id != "spiffe://mesh.local/ns/shop/sa/orders" {
+		t.Fatalf("expected SPIFFE client to be admitted, got %q %v", id, err)
+	}
+	if _, _, err := get(nil); err == nil {
+		t.Fatal("expected a client without certificate to be rejected")
+	}
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{issue(t, ca, "orders", "spiffe://mesh.local/sa/orders").pair(t)},
+		NextProtos:   []string{"h2", "http/1.1"},
+	})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if proto := conn.ConnectionState().NegotiatedProtocol; proto != "h2" {
+		t.Fatalf("expected HTTP/2 to be negotiated, got %q", proto)
+	}
+	conn.Close()
+	if _, _, err := get(issue(t, ca, "orders", "spiffe://other.local/sa/orders")); err == nil {
+		t.Fatal("expected a SPIFFE ID of another trust domain to be rejected")
+	}
+	if _, _, err := get(issue(t, ca, "orders")); err == nil {
+		t.Fatal("expected a certificate without SPIFFE ID to be rejected")
+	}
+	if _, _, err := get(issue(t, issue(t, nil, "rogue-ca"), "orders", "spiffe://mesh.local/sa/orders")); err == nil {
+		t.Fatal("expected a certificate of an unknown CA to be rejected")
+	}
+
+	// Rotated files are picked up by new connections.
+	rotated := issue(t, ca, "authz")
+	later := now.Add(time.Minute)
+	write(t, cfg.CertFile, rotated.pem, later)
+	write(t, cfg.KeyFile, rotated.keyPEM(t), later)
+	if changed, err := s.Reload(); !changed || err != nil {
+		t.Fatalf("expected certificates to be reloaded, got %v %v", changed, err)
+	}
+	_, served2, err := get(issue(t, ca, "orders", "spiffe://mesh.local/sa/orders"))
+	if err != nil || served2.SerialNumber.Cmp(rotated.cert.SerialNumber) != 0 || served2.SerialNumber.Cmp(served.SerialNumber) == 0 {
+		t.Fatalf("expected the rotated certificate to be served, got %v %v", served2.SerialNumber, err)
+	}
+
+	// A broken file keeps the current certificate.
+	write(t, cfg.KeyFile, []byte("broken"), later.Add(time.Minute))
+	if _, err := s.Reload(); err == nil {
+		t.Fatal("expected a broken key to fail to reload")
+	}
+	if _, _, err := get(issue(t, ca, "orders", "spiffe://mesh.local/sa/orders")); err != nil {
+		t.Fatalf("expected the current certificate to keep serving, got %v", err)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("TLS_CERT_FILE", "")
+	t.Setenv("TLS_KEY_FILE", "")
+	t.Setenv("TLS_CLIENT_CA_FILE", "")
+	t.Setenv("TLS_CLIENT_AUTH", "")
+	t.Setenv("TLS_SPIFFE_TRUST_DOMAINS", "")
+	if cfg, err := FromEnv(); cfg != nil || err != nil {
+		t.Fatalf("expected TLS to be off, got %+v %v", cfg, err)
+	}
+	t.Setenv("TLS_CERT_FILE", "tls.crt")
+	if _, err := FromEnv(); err == nil {
+		t.Fatal("expected a certificate without key to be rejected")
+	}
+	t.Setenv("TLS_KEY_FILE", "tls.key")
+	t.Setenv("TLS_CLIENT_CA_FILE", "ca.crt")
+	t.Setenv("TLS_SPIFFE_TRUST_DOMAINS", "mesh.local, prod.local")
+	cfg, err := FromEnv()
+	if err != nil || cfg.ClientAuth != tls.RequireAndVerifyClientCert || len(cfg.TrustDomains) != 2 || cfg.TrustDomains[1] != "prod.local" {
+		t.Fatalf("expected client certificates to be required, got %+v %v", cfg, err)
+	}
+	t.Setenv("TLS_CLIENT_AUTH", "optional")
+	if _, err := FromEnv(); err == nil {
+		t.Fatal("expected an invalid client auth mode to be rejected")
+	}
+	if _, err := New(Config{CertFile: "tls.crt", KeyFile: "tls.key", ClientAuth: tls.RequireAndVerifyClientCert}); err == nil {
+		t.Fatal("expected verification without a client CA to be rejected")
+	}
+}
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    id TEXT PRIMARY KEY,
+    tenant_id TEXT NOT NULL,
+    name TEXT,
+    hash TEXT NOT NULL,
+    endpoints TEXT,
+    created_at BIGINT,
+    created_by TEXT,
+    expires_at BIGINT,
+    revoked_at BIGINT,
+    rotated_from TEXT
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_tenant ON api_keys (tenant_id);
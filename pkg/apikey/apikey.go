@@ -0,0 +1,128 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Prefix starts every API key, so keys are recognisable in configuration and
+// secret scanners.
+const Prefix = "azk_"
+
+// DefaultEndpoints are the endpoints of a key created without any.
+var DefaultEndpoints = []string{"/check-access"}
+
+// Key is a tenant-scoped API key. Only the hash of its secret is stored; the
+// key itself is returned once, when it is created.
+type Key struct {
+	ID       string `json:"id"`
+	TenantID string `json:"tenantID"`
+	Name     string `json:"name"`
+	// Hash is the hex SHA-256 of the key's secret.
+	Hash string `json:"-"`
+	// Endpoints lists the paths the key may call. A trailing * matches any
+	// path with that prefix.
+	Endpoints []string  `json:"endpoints"`
+	CreatedAt time.Time `json:"createdAt"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+	// ExpiresAt is zero for keys that do not expire.
+	ExpiresAt time.Time `json:"expiresAt"`
+	RevokedAt time.Time `json:"revokedAt"`
+	// RotatedFrom is the ID of the key this one replaced.
+	RotatedFrom string `json:"rotatedFrom,omitempty"`
+}
+
+// MarshalJSON leaves out the unset ExpiresAt and RevokedAt.
+func (k Key) MarshalJSON() ([]byte, error) {
+	type key Key
+	return json.Marshal(struct {
+		key
+		ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+		RevokedAt *time.Time `json:"revokedAt,omitempty"`
+	}{key(k), timePtr(k.ExpiresAt), timePtr(k.RevokedAt)})
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// Generate returns a new key, of the form azk_<id>_<secret>, for the tenant
+// together with its stored form.
+func Generate(tenantID, name string, endpoints []string) (string, Key, error) {
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", Key{}, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", Key{}, err
+	}
+	if len(endpoints) == 0 {
+		endpoints = DefaultEndpoints
+	}
+	k := Key{
+		ID:        hex.EncodeToString(id),
+		TenantID:  tenantID,
+		Name:      name,
+		Endpoints: append([]string{}, endpoints...),
+		CreatedAt: time.Now().UTC(),
+	}
+	enc := base64.RawURLEncoding.EncodeToString(secret)
+	k.Hash = hash(enc)
+	return Prefix + k.ID + "_" + enc, k, nil
+}
+
+// Parse splits a key into its ID and secret.
+func Parse(key string) (id, secret string, err error) {
+	rest, ok := strings.CutPrefix(key, Prefix)
+	if !ok {
+		return "", "", errors.New("not an API key")
+	}
+	id, secret, ok = strings.Cut(rest, "_")
+	if !ok || id == "" || secret == "" {
+		return "", "", errors.New("malformed API key")
+	}
+	return id, secret, nil
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Matches reports whether secret is the key's secret.
+func (k Key) Matches(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(hash(secret)), []byte(k.Hash)) == 1
+}
+
+// Active reports whether the key is neither revoked nor expired at now.
+func (k Key) Active(now time.Time) bool {
+	if !k.RevokedAt.IsZero() && !now.Before(k.RevokedAt) {
+		return false
+	}
+	return k.ExpiresAt.IsZero() || now.Before(k.ExpiresAt)
+}
+
+// Allows reports whether the key may call path.
+func (k Key) Allows(path string) bool {
+	for _, e := range k.Endpoints {
+		if prefix, ok := strings.CutSuffix(e, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if e == path {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package apikey
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKey(t *testing.T) {
+	raw, k, err := Generate("acme", "orders", []string{"/check-access", "/policies/*"})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	id, secret, err := Parse(raw)
+	if err != nil || id != k.ID {
+		t.Fatalf("parse %q: %s %v", raw, id, err)
+	}
+	if !k.Matches(secret) || k.Matches(secret+"x") || k.Hash == secret {
+		t.Fatal("expected only the secret to match its hash")
+	}
+	for _, bad := range []string{"", "orders", Prefix, Prefix + "abc", Prefix + "_secret"} {
+		if _, _, err := Parse(bad); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+
+	for path, want := range map[string]bool{"/check-access": true, "/policies/history": true, "/simulate": false, "/check-access/x": false} {
+		if got := k.Allows(path); got != want {
+			t.Fatalf("Allows(%s) = %v, want %v", path, got, want)
+		}
+	}
+	if _, k, _ := Generate("acme", "default", nil); len(k.Endpoints) != 1 || k.Endpoints[0] != "/check-access" {
+		t.Fatalf("expected the default endpoints, got %v", k.Endpoints)
+	}
+
+	now := time.Now()
+	if !k.Active(now) {
+		t.Fatal("expected a new key to be active")
+	}
+	k.ExpiresAt = now
+	if k.Active(now) {
+		t.Fatal("expected an expired key to be inactive")
+	}
+	k.ExpiresAt = time.Time{}
+	k.RevokedAt = now.Add(time.Minute)
+	if !k.Active(now) || k.Active(now.Add(time.Minute)) {
+		t.Fatal("expected a key to be active until it is revoked")
+	}
+}
@@ -0,0 +1,115 @@
+package contextprovider
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// StepConfig configures one provider of a chain.
+type StepConfig struct {
+	Provider  string `yaml:"provider"`
+	Namespace string `yaml:"namespace"`
+	Timeout   string `yaml:"timeout"`
+	// OnError is "open" (the default) to evaluate without the provider's values
+	// when it fails, or "closed" to deny the request.
+	OnError string `yaml:"on_error"`
+	// Webhook configures the webhook provider.
+	Webhook *WebhookConfig `yaml:"webhook"`
+	// Device configures the device posture provider.
+	Device *DeviceConfig `yaml:"device"`
+}
+
+// Config selects the providers run for each tenant. Tenants without an entry
+// use Default.
+type Config struct {
+	Default []StepConfig            `yaml:"default"`
+	Tenants map[string][]StepConfig `yaml:"tenants"`
+}
+
+// Factory creates a provider for a configured step.
+type Factory func(StepConfig) (ContextProvider, error)
+
+// Static returns a Factory that always yields p.
+func Static(p ContextProvider) Factory {
+	return func(StepConfig) (ContextProvider, error) { return p, nil }
+}
+
+// Chains holds the built chain of every configured tenant.
+type Chains struct {
+	Default Chain
+	Tenants map[string]Chain
+}
+
+// For returns the chain configured for tenantID, or the default chain.
+func (c Chains) For(tenantID string) Chain {
+	if chain, ok := c.Tenants[tenantID]; ok {
+		return chain
+	}
+	return c.Default
+}
+
+// LoadConfig reads a chain configuration from a YAML file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// Build creates the chains of cfg using the named provider factories.
+func (cfg *Config) Build(factories map[string]Factory) (Chains, error) {
+	var out Chains
+	var err error
+	if out.Default, err = buildChain(cfg.Default, factories); err != nil {
+		return Chains{}, fmt.Errorf("default: %w", err)
+	}
+	out.Tenants = make(map[string]Chain, len(cfg.Tenants))
+	for tenantID, steps := range cfg.Tenants {
+		chain, err := buildChain(steps, factories)
+		if err != nil {
+			return Chains{}, fmt.Errorf("tenant %s: %w", tenantID, err)
+		}
+		out.Tenants[tenantID] = chain
+	}
+	return out, nil
+}
+
+func buildChain(steps []StepConfig, factories map[string]Factory) (Chain, error) {
+	chain := make(Chain, 0, len(steps))
+	for i, sc := range steps {
+		factory, ok := factories[sc.Provider]
+		if !ok {
+			return nil, fmt.Errorf("step %d: unknown provider %q", i+1, sc.Provider)
+		}
+		step := Step{Name: sc.Provider, Namespace: sc.Namespace}
+		if sc.Timeout != "" {
+			d, err := time.ParseDuration(sc.Timeout)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("step %d: invalid timeout %q", i+1, sc.Timeout)
+			}
+			step.Timeout = d
+		}
+		switch sc.OnError {
+		case "", "open":
+		case "closed":
+			step.FailClosed = true
+		default:
+			return nil, fmt.Errorf("step %d: on_error must be open or closed, not %q", i+1, sc.OnError)
+		}
+		p, err := factory(sc)
+		if err != nil {
+			return nil, fmt.Errorf("step %d: %s: %w", i+1, sc.Provider, err)
+		}
+		step.Provider = p
+		chain = append(chain, step)
+	}
+	return chain, nil
+}
@@ -1,10 +1,17 @@
 package contextprovider
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ContextProvider retrieves context values from an HTTP request.
@@ -12,24 +19,149 @@ type ContextProvider interface {
 	GetContext(req *http.Request) (map[string]string, error)
 }
 
+// KeyedProvider is implemented by providers whose keys are known up front. A
+// key ending in "." stands for every key with that prefix. Callers may not
+// supply those keys: a provider that leaves one out, for example because a
+// lookup found nothing, would otherwise let the caller's value stand in for
+// its own.
+type KeyedProvider interface {
+	Keys() []string
+}
+
+// Step is a provider in a chain together with how it is run.
+type Step struct {
+	Name     string
+	Provider ContextProvider
+	// Timeout bounds the provider; zero means no limit.
+	Timeout time.Duration
+	// FailClosed makes a failure of the provider deny the request instead of
+	// evaluating it without the provider's values.
+	FailClosed bool
+	// Namespace, when set, prefixes every key as "<namespace>.<key>". A key
+	// already starting with "<namespace>_" has that prefix replaced, so
+	// geo_country becomes geo.country.
+	Namespace string
+}
+
+// ProviderError records a provider that failed or timed out.
+type ProviderError struct {
+	Provider   string `json:"provider"`
+	Message    string `json:"error"`
+	FailClosed bool   `json:"fail_closed"`
+}
+
+func (e ProviderError) Error() string {
+	return e.Provider + ": " + e.Message
+}
+
 // Chain executes multiple providers and merges their context values.
-type Chain []ContextProvider
+type Chain []Step
 
-// GetContext gathers context values from all providers in the chain.
-func (c Chain) GetContext(req *http.Request) map[string]string {
-	ctxVals := make(map[string]string)
+// GetContext runs the providers in the chain concurrently and merges their
+// values in chain order, so later providers win on conflicting keys. Values of
+// a failed provider are dropped and the failure is recorded on the trace and
+// returned.
+func (c Chain) GetContext(req *http.Request) (map[string]string, []ProviderError) {
 	tracer := otel.Tracer("authorization-service")
 	ctx, span := tracer.Start(req.Context(), "ContextEvaluation")
 	defer span.End()
-	for _, p := range c {
-		vals, err := p.GetContext(req.WithContext(ctx))
-		if err != nil {
+
+	type result struct {
+		vals map[string]string
+		err  error
+	}
+	results := make([]chan result, len(c))
+	for i, step := range c {
+		results[i] = make(chan result, 1)
+		go func(step Step, out chan<- result) {
+			vals, err := step.run(ctx, req)
+			out <- result{vals, err}
+		}(step, results[i])
+	}
+
+	ctxVals := make(map[string]string)
+	var errs []ProviderError
+	for i, step := range c {
+		r := <-results[i]
+		if r.err != nil {
+			pe := ProviderError{Provider: step.Name, Message: r.err.Error(), FailClosed: step.FailClosed}
+			span.RecordError(pe, trace.WithAttributes(
+				attribute.String("provider", step.Name),
+				attribute.Bool("fail_closed", step.FailClosed),
+			))
+			errs = append(errs, pe)
 			continue
 		}
-		for k, v := range vals {
+		for k, v := range r.vals {
+			k = step.key(k)
 			ctxVals[k] = v
 			span.SetAttributes(attribute.String(k, v))
 		}
 	}
-	return ctxVals
+	if len(errs) > 0 {
+		span.SetStatus(codes.Error, fmt.Sprintf("%d context provider(s) failed", len(errs)))
+	}
+	return ctxVals, errs
+}
+
+// run calls the provider within the step's timeout. It runs on the goroutine
+// GetContext started for the step; providers must honour the request context
+// so that they return once the timeout cancels it.
+func (s Step) run(ctx context.Context, req *http.Request) (map[string]string, error) {
+	_, span := otel.Tracer("authorization-service").Start(ctx, "ContextProvider")
+	defer span.End()
+	span.SetAttributes(attribute.String("provider", s.Name))
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+	vals, err := s.Provider.GetContext(req.WithContext(ctx))
+	if s.Timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		// Values returned after the deadline are dropped like on an error.
+		vals, err = nil, fmt.Errorf("timed out after %s", s.Timeout)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return vals, err
+}
+
+// Reserved reports whether k is a key a provider of the chain sets, as named
+// after the step's namespace. Every key in a step's namespace is reserved, so
+// providers with dynamic keys, such as webhooks, are covered when namespaced.
+func (c Chain) Reserved(k string) bool {
+	for _, step := range c {
+		if step.Namespace != "" && strings.HasPrefix(k, step.Namespace+".") {
+			return true
+		}
+		kp, ok := step.Provider.(KeyedProvider)
+		if !ok {
+			continue
+		}
+		for _, key := range kp.Keys() {
+			if key = step.key(key); key == k || strings.HasSuffix(key, ".") && strings.HasPrefix(k, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s Step) key(k string) string {
+	if s.Namespace == "" {
+		return k
+	}
+	return s.Namespace + "." + strings.TrimPrefix(k, s.Namespace+"_")
+}
+
+// FailedClosed reports whether any of errs comes from a fail-closed provider.
+func FailedClosed(errs []ProviderError) bool {
+	for _, e := range errs {
+		if e.FailClosed {
+			return true
+		}
+	}
+	return false
 }
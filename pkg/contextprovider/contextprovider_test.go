@@ -0,0 +1,119 @@
+package contextprovider
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type staticProvider map[string]string
+
+func (p staticProvider) GetContext(*http.Request) (map[string]string, error) {
+	return p, nil
+}
+
+type failingProvider struct{}
+
+func (failingProvider) GetContext(*http.Request) (map[string]string, error) {
+	return nil, errors.New("backend unavailable")
+}
+
+type slowProvider struct{}
+
+func (slowProvider) GetContext(req *http.Request) (map[string]string, error) {
+	<-req.Context().Done()
+	return map[string]string{"late": "true"}, nil
+}
+
+func TestChainNamespacesAndErrors(t *testing.T) {
+	chain := Chain{
+		{Name: "geoip", Provider: staticProvider{"ip": "192.0.2.1", "geo_country": "US"}, Namespace: "geo"},
+		{Name: "risk", Provider: staticProvider{"risk_score": "10"}},
+		{Name: "slow", Provider: slowProvider{}, Timeout: 10 * time.Millisecond},
+		{Name: "device", Provider: failingProvider{}, FailClosed: true},
+	}
+	vals, errs := chain.GetContext(httptest.NewRequest("GET", "/", nil))
+
+	want := map[string]string{"geo.ip": "192.0.2.1", "geo.country": "US", "risk_score": "10"}
+	if len(vals) != len(want) {
+		t.Fatalf("unexpected values %v", vals)
+	}
+	for k, v := range want {
+		if vals[k] != v {
+			t.Fatalf("expected %s=%s, got %v", k, v, vals)
+		}
+	}
+	if len(errs) != 2 {
+		t.Fatalf("expected two provider errors, got %v", errs)
+	}
+	if errs[0].Provider != "slow" || !strings.Contains(errs[0].Message, "timed out") || errs[0].FailClosed {
+		t.Fatalf("unexpected timeout error %+v", errs[0])
+	}
+	if errs[1].Provider != "device" || !errs[1].FailClosed {
+		t.Fatalf("unexpected failure %+v", errs[1])
+	}
+	if !FailedClosed(errs) || FailedClosed(errs[:1]) {
+		t.Fatal("FailedClosed should report only fail-closed providers")
+	}
+}
+
+func TestConfigBuild(t *testing.T) {
+	factories := map[string]Factory{
+		"time": Static(staticProvider{"time": "now"}),
+		"risk": Static(staticProvider{"risk_score": "0"}),
+	}
+	cfg := &Config{
+		Default: []StepConfig{{Provider: "time"}},
+		Tenants: map[string][]StepConfig{
+			"acme": {{Provider: "risk", Namespace: "risk", Timeout: "250ms", OnError: "closed"}},
+		},
+	}
+	chains, err := cfg.Build(factories)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	acme := chains.For("acme")
+	if len(acme) != 1 || acme[0].Timeout != 250*time.Millisecond || !acme[0].FailClosed || acme[0].Namespace != "risk" {
+		t.Fatalf("unexpected acme chain %+v", acme)
+	}
+	if other := chains.For("globex"); len(other) != 1 || other[0].Name != "time" {
+		t.Fatalf("expected default chain for unconfigured tenant, got %+v", other)
+	}
+
+	for _, bad := range []StepConfig{
+		{Provider: "weather"},
+		{Provider: "time", Timeout: "soon"},
+		{Provider: "time", OnError: "retry"},
+	} {
+		cfg := &Config{Tenants: map[string][]StepConfig{"acme": {bad}}}
+		if _, err := cfg.Build(factories); err == nil || !strings.Contains(err.Error(), "tenant acme") {
+			t.Fatalf("expected error for %+v, got %v", bad, err)
+		}
+	}
+}
+
+func TestChainReserved(t *testing.T) {
+	chain := Chain{
+		{Name: "geoip", Provider: GeoIPProvider{}, Namespace: "geo"},
+		{Name: "device", Provider: &DevicePostureProvider{}},
+		{Name: "fraud", Provider: staticProvider{"score": "1"}, Namespace: "fraud"},
+	}
+	for k, want := range map[string]bool{
+		"geo.ip":        true,
+		"geo.country":   true,
+		"device.id":     true,
+		"device.custom": true,
+		"fraud.score":   true,
+		"fraud.other":   true,
+		"ip":            false,
+		"score":         false,
+		"region":        false,
+	} {
+		if got := chain.Reserved(k); got != want {
+			t.Errorf("Reserved(%q) = %v, want %v", k, got, want)
+		}
+	}
+}
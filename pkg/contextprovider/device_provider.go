@@ -0,0 +1,214 @@
+package contextprovider
+
+import (
+	"crypto/hmac"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers set by an MDM proxy to vouch for the device posture.
+const (
+	PostureHeader          = "X-Device-Posture"
+	PostureTimestampHeader = "X-Device-Posture-Timestamp"
+	PostureSignatureHeader = "X-Device-Posture-Signature"
+)
+
+// DeviceConfig configures a DevicePostureProvider.
+type DeviceConfig struct {
+	// SecretEnv names the environment variable holding the HMAC key the MDM
+	// proxy signs posture headers with. Headers are ignored when empty.
+	SecretEnv string `yaml:"secret_env"`
+	// MaxAge bounds how old a signed posture may be; 5m when empty.
+	MaxAge string `yaml:"max_age"`
+	// CAFile holds the PEM certificates of the CAs issuing device
+	// certificates. Client certificates they issued are devices.
+	CAFile string `yaml:"ca_file"`
+	// OU is an organizational unit marking client certificates as devices.
+	OU string `yaml:"ou"`
+}
+
+// Posture is the JSON document carried, base64url encoded, in the
+// X-Device-Posture header.
+type Posture struct {
+	ID        string `json:"id"`
+	OS        string `json:"os,omitempty"`
+	Managed   *bool  `json:"managed,omitempty"`
+	Compliant *bool  `json:"compliant,omitempty"`
+}
+
+// DevicePostureProvider derives device.* attributes from the verified client
+// certificate and from posture headers signed by an MDM proxy.
+//
+// A verified certificate marks the device as managed when it identifies a
+// device: it carries a urn:device:<id> URI SAN, was issued by a configured
+// device CA or has the configured organizational unit. Other certificates,
+// such as those of services, are ignored. The device.id is taken from the
+// SAN, falling back to the subject common name, and organizational units of
+// the form key=value, such as "os=macOS" or "compliant=true", become
+// device.<key>. Signed headers fill in attributes the certificate does not
+// provide. Without either, device.managed is "false".
+type DevicePostureProvider struct {
+	secret []byte
+	maxAge time.Duration
+	cas    []*x509.Certificate
+	ou     string
+	now    func() time.Time
+}
+
+// NewDevicePostureProvider validates cfg and creates a provider.
+func NewDevicePostureProvider(cfg DeviceConfig) (*DevicePostureProvider, error) {
+	p := &DevicePostureProvider{maxAge: 5 * time.Minute, ou: cfg.OU, now: time.Now}
+	if cfg.SecretEnv != "" {
+		secret := os.Getenv(cfg.SecretEnv)
+		if secret == "" {
+			return nil, fmt.Errorf("device posture secret %s is not set", cfg.SecretEnv)
+		}
+		p.secret = []byte(secret)
+	}
+	if cfg.MaxAge != "" {
+		d, err := time.ParseDuration(cfg.MaxAge)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("device max_age %q is not a positive duration", cfg.MaxAge)
+		}
+		p.maxAge = d
+	}
+	if cfg.CAFile != "" {
+		data, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("device ca_file: %w", err)
+		}
+		for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("device ca_file: %w", err)
+			}
+			p.cas = append(p.cas, cert)
+		}
+		if len(p.cas) == 0 {
+			return nil, fmt.Errorf("device ca_file %s: no certificates found", cfg.CAFile)
+		}
+	}
+	return p, nil
+}
+
+// Keys returns the prefix of the keys GetContext sets.
+func (*DevicePostureProvider) Keys() []string {
+	return []string{"device."}
+}
+
+// GetContext returns the device attributes of the request. Posture headers
+// with a missing, stale or invalid signature are an error.
+func (p *DevicePostureProvider) GetContext(req *http.Request) (map[string]string, error) {
+	vals := map[string]string{}
+	if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 && len(req.TLS.VerifiedChains[0]) > 0 && p.isDevice(req.TLS.VerifiedChains) {
+		leaf := req.TLS.VerifiedChains[0][0]
+		vals["device.managed"] = "true"
+		vals["device.id"] = deviceID(leaf)
+		if vals["device.id"] == "" {
+			vals["device.id"] = leaf.Subject.CommonName
+		}
+		for _, ou := range leaf.Subject.OrganizationalUnit {
+			if k, v, ok := strings.Cut(ou, "="); ok && k != "" {
+				vals["device."+strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+			}
+		}
+	}
+	if req.Header.Get(PostureHeader) != "" && p.secret != nil {
+		posture, err := p.verify(req.Header)
+		if err != nil {
+			return nil, err
+		}
+		fill := func(k, v string) {
+			if _, ok := vals[k]; !ok && v != "" {
+				vals[k] = v
+			}
+		}
+		fill("device.id", posture.ID)
+		fill("device.os", posture.OS)
+		if posture.Managed != nil {
+			fill("device.managed", strconv.FormatBool(*posture.Managed))
+		}
+		if posture.Compliant != nil {
+			fill("device.compliant", strconv.FormatBool(*posture.Compliant))
+		}
+	}
+	if vals["device.id"] == "" {
+		delete(vals, "device.id")
+	}
+	if _, ok := vals["device.managed"]; !ok {
+		vals["device.managed"] = "false"
+	}
+	return vals, nil
+}
+
+// isDevice reports whether the verified chains identify a device rather than,
+// for example, a service.
+func (p *DevicePostureProvider) isDevice(chains [][]*x509.Certificate) bool {
+	leaf := chains[0][0]
+	if deviceID(leaf) != "" {
+		return true
+	}
+	if p.ou != "" && slices.Contains(leaf.Subject.OrganizationalUnit, p.ou) {
+		return true
+	}
+	for _, chain := range chains {
+		for _, cert := range chain[1:] {
+			for _, ca := range p.cas {
+				if cert.Equal(ca) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// deviceID returns the id of the urn:device:<id> URI SAN of cert, if any.
+func deviceID(cert *x509.Certificate) string {
+	for _, u := range cert.URIs {
+		if id, ok := strings.CutPrefix(u.String(), "urn:device:"); ok && id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// verify checks the signature and age of the posture headers and decodes the
+// posture.
+func (p *DevicePostureProvider) verify(h http.Header) (Posture, error) {
+	encoded := h.Get(PostureHeader)
+	ts := h.Get(PostureTimestampHeader)
+	sig, _ := strings.CutPrefix(h.Get(PostureSignatureHeader), "sha256=")
+	if !hmac.Equal([]byte(sig), []byte(Sign(p.secret, ts, []byte(encoded)))) {
+		return Posture{}, errors.New("device posture signature is invalid")
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return Posture{}, errors.New("device posture timestamp is invalid")
+	}
+	if age := p.now().Sub(time.Unix(unix, 0)); age > p.maxAge || age < -time.Minute {
+		return Posture{}, fmt.Errorf("device posture is %s old", age.Round(time.Second))
+	}
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return Posture{}, errors.New("device posture is not base64url encoded")
+	}
+	var posture Posture
+	if err := json.Unmarshal(data, &posture); err != nil {
+		return Posture{}, fmt.Errorf("device posture: %w", err)
+	}
+	return posture, nil
+}
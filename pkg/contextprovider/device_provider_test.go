@@ -0,0 +1,121 @@
+package contextprovider
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDevicePostureFromCertificate(t *testing.T) {
+	p, err := NewDevicePostureProvider(DeviceConfig{})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	vals, _ := p.GetContext(req)
+	if vals["device.managed"] != "false" || len(vals) != 1 {
+		t.Fatalf("expected unmanaged device without credentials, got %v", vals)
+	}
+
+	leaf := &x509.Certificate{
+		Subject: pkix.Name{CommonName: "laptop-42", OrganizationalUnit: []string{"Engineering", "os=macOS", "Compliant=true"}},
+		URIs:    []*url.URL{{Scheme: "urn", Opaque: "device:C02XK1"}},
+	}
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{leaf}}}
+	vals, err = p.GetContext(req)
+	if err != nil {
+		t.Fatalf("get context: %v", err)
+	}
+	want := map[string]string{"device.managed": "true", "device.id": "C02XK1", "device.os": "macOS", "device.compliant": "true"}
+	if len(vals) != len(want) {
+		t.Fatalf("unexpected values %v", vals)
+	}
+	for k, v := range want {
+		if vals[k] != v {
+			t.Fatalf("expected %s=%s, got %v", k, v, vals)
+		}
+	}
+
+	// Unverified certificates are ignored.
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}}
+	if vals, _ := p.GetContext(req); vals["device.managed"] != "false" {
+		t.Fatalf("expected unverified certificate to be ignored, got %v", vals)
+	}
+
+	// Service certificates are not devices.
+	service := &x509.Certificate{
+		Subject: pkix.Name{CommonName: "billing", OrganizationalUnit: []string{"compliant=true"}},
+		URIs:    []*url.URL{{Scheme: "spiffe", Host: "example.org", Path: "/billing"}},
+	}
+	ca := &x509.Certificate{Raw: []byte("device-ca"), Subject: pkix.Name{CommonName: "Device CA"}}
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{service, ca}}}
+	if vals, _ := p.GetContext(req); vals["device.managed"] != "false" || len(vals) != 1 {
+		t.Fatalf("expected service certificate to be ignored, got %v", vals)
+	}
+
+	// Certificates from a device CA or with the device OU are devices.
+	p.cas = []*x509.Certificate{ca}
+	if vals, _ := p.GetContext(req); vals["device.managed"] != "true" || vals["device.id"] != "billing" {
+		t.Fatalf("expected certificate from the device CA to be a device, got %v", vals)
+	}
+	p.cas = nil
+	p.ou = "devices"
+	service.Subject.OrganizationalUnit = append(service.Subject.OrganizationalUnit, "devices")
+	if vals, _ := p.GetContext(req); vals["device.managed"] != "true" || vals["device.compliant"] != "true" {
+		t.Fatalf("expected certificate with the device OU to be a device, got %v", vals)
+	}
+}
+
+func TestDevicePostureFromSignedHeaders(t *testing.T) {
+	t.Setenv("MDM_SECRET", "mdm-key")
+	p, err := NewDevicePostureProvider(DeviceConfig{SecretEnv: "MDM_SECRET", MaxAge: "1m", OU: "devices"})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	p.now = func() time.Time { return now }
+	posture := base64.RawURLEncoding.EncodeToString([]byte(`{"id":"ipad-7","os":"iPadOS","managed":true,"compliant":false}`))
+	ts := strconv.FormatInt(now.Add(-30*time.Second).Unix(), 10)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(PostureHeader, posture)
+	req.Header.Set(PostureTimestampHeader, ts)
+	req.Header.Set(PostureSignatureHeader, "sha256="+Sign([]byte("mdm-key"), ts, []byte(posture)))
+	vals, err := p.GetContext(req)
+	if err != nil {
+		t.Fatalf("get context: %v", err)
+	}
+	if vals["device.id"] != "ipad-7" || vals["device.os"] != "iPadOS" || vals["device.managed"] != "true" || vals["device.compliant"] != "false" {
+		t.Fatalf("unexpected values %v", vals)
+	}
+
+	// The certificate takes precedence over the headers.
+	leaf := &x509.Certificate{Subject: pkix.Name{CommonName: "laptop-42", OrganizationalUnit: []string{"devices", "compliant=true"}}}
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{leaf}}}
+	if vals, _ := p.GetContext(req); vals["device.id"] != "laptop-42" || vals["device.compliant"] != "true" || vals["device.os"] != "iPadOS" {
+		t.Fatalf("unexpected merged values %v", vals)
+	}
+	req.TLS = nil
+
+	req.Header.Set(PostureSignatureHeader, "sha256="+Sign([]byte("wrong"), ts, []byte(posture)))
+	if _, err := p.GetContext(req); err == nil {
+		t.Fatal("expected forged posture to be rejected")
+	}
+	now = now.Add(time.Minute)
+	req.Header.Set(PostureSignatureHeader, "sha256="+Sign([]byte("mdm-key"), ts, []byte(posture)))
+	if _, err := p.GetContext(req); err == nil {
+		t.Fatal("expected stale posture to be rejected")
+	}
+
+	// Without a key the headers cannot be trusted and are ignored.
+	unsigned, _ := NewDevicePostureProvider(DeviceConfig{})
+	if vals, err := unsigned.GetContext(req); err != nil || vals["device.managed"] != "false" {
+		t.Fatalf("expected headers to be ignored without a key, got %v %v", vals, err)
+	}
+}
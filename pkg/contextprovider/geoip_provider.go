@@ -1,22 +1,64 @@
 package contextprovider
 
 import (
-	"net"
 	"net/http"
+	"net/netip"
+	"strconv"
+
+	"github.com/bradtumy/authorization-service/pkg/geoip"
+	"github.com/bradtumy/authorization-service/pkg/network"
 )
 
-// GeoIPProvider extracts the remote IP address and returns a stubbed geo-location.
-type GeoIPProvider struct{}
+// GeoIPProvider extracts the client IP address and resolves its location from
+// local MaxMind databases. The ProxyHeader forwarding header is honoured only
+// when the request arrives from one of the TrustedProxies.
+type GeoIPProvider struct {
+	TrustedProxies []netip.Prefix
+	// ProxyHeader is network.HeaderXForwardedFor, the default when empty, or
+	// network.HeaderForwarded.
+	ProxyHeader string
+	// Databases are consulted in order; earlier databases take precedence for
+	// fields provided by several, e.g. a City database followed by ASN and
+	// Anonymous IP databases.
+	Databases []*geoip.DB
+}
+
+// Keys returns the keys GetContext may set.
+func (GeoIPProvider) Keys() []string {
+	return []string{"ip", "geo_country", "geo_region", "geo_city", "geo_asn", "geo_as_org", "geo_anonymous_proxy"}
+}
 
-// GetContext returns the client's IP and a stubbed country code.
-func (GeoIPProvider) GetContext(req *http.Request) (map[string]string, error) {
-	ip, _, err := net.SplitHostPort(req.RemoteAddr)
-	if err != nil {
-		ip = req.RemoteAddr
+// GetContext returns the client's IP and, when a database has a record for it,
+// geo_country, geo_region, geo_city, geo_asn, geo_as_org and
+// geo_anonymous_proxy. Location keys are omitted when unknown so that policies
+// conditioned on them fail closed; callers cannot supply them, see Keys. ip
+// is omitted too when the client address cannot be determined, for example
+// because a forwarding hop is malformed.
+func (p GeoIPProvider) GetContext(req *http.Request) (map[string]string, error) {
+	addr, ok := network.ClientIP(req, p.TrustedProxies, p.ProxyHeader)
+	if !ok {
+		if len(p.Databases) > 0 {
+			geoip.RecordInvalidAddress()
+		}
+		return map[string]string{}, nil
+	}
+	vals := map[string]string{"ip": addr.String()}
+	loc, found := geoip.LookupAll(p.Databases, addr)
+	if !found {
+		return vals, nil
+	}
+	set := func(k, v string) {
+		if v != "" {
+			vals[k] = v
+		}
+	}
+	set("geo_country", loc.Country)
+	set("geo_region", loc.Region)
+	set("geo_city", loc.City)
+	if loc.ASN != 0 {
+		vals["geo_asn"] = strconv.FormatUint(uint64(loc.ASN), 10)
 	}
-	// Stubbed country lookup
-	return map[string]string{
-		"ip":          ip,
-		"geo_country": "US",
-	}, nil
+	set("geo_as_org", loc.ASOrg)
+	vals["geo_anonymous_proxy"] = strconv.FormatBool(loc.AnonymousProxy)
+	return vals, nil
 }
@@ -2,9 +2,16 @@ package contextprovider
 
 import "net/http"
 
-// RiskProvider reads a static risk score from the X-Risk-Score header.
+// RiskProvider reads a static risk score from the X-Risk-Score header. The
+// header is set by the caller, who can therefore choose its own score; use it
+// only behind a proxy that sets the header, or for testing.
 type RiskProvider struct{}
 
+// Keys returns the keys GetContext sets.
+func (RiskProvider) Keys() []string {
+	return []string{"risk_score"}
+}
+
 // GetContext extracts the risk score header if present.
 func (RiskProvider) GetContext(req *http.Request) (map[string]string, error) {
 	score := req.Header.Get("X-Risk-Score")
@@ -4,15 +4,26 @@ import (
 	"net/http"
 	"strconv"
 	"time"
+
+	"github.com/bradtumy/authorization-service/pkg/schedule"
 )
 
-// TimeProvider annotates the request with whether it is during business hours.
+// TimeProvider annotates the request with the evaluation time and whether it
+// falls within business hours.
 type TimeProvider struct{}
 
-// GetContext returns a flag indicating if the current time is within business hours (9am-5pm).
+// Keys returns the keys GetContext sets.
+func (TimeProvider) Keys() []string {
+	return []string{"time", "business_hours"}
+}
+
+// GetContext returns the current time in RFC 3339 form, which time conditions
+// are evaluated against, and a flag indicating if it is within the default
+// business-hours schedule.
 func (TimeProvider) GetContext(req *http.Request) (map[string]string, error) {
-	now := time.Now()
-	hour := now.Hour()
-	inBusiness := hour >= 9 && hour < 17
-	return map[string]string{"business_hours": strconv.FormatBool(inBusiness)}, nil
+	now := time.Now().UTC()
+	return map[string]string{
+		"time":           now.Format(time.RFC3339),
+		"business_hours": strconv.FormatBool(schedule.BusinessHours.Contains(now)),
+	}, nil
 }
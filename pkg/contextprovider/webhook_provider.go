@@ -0,0 +1,303 @@
+package contextprovider
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bradtumy/authorization-service/pkg/network"
+)
+
+// Access describes the authorization request being evaluated.
+type Access struct {
+	TenantID string
+	Subject  string
+	Resource string
+	Action   string
+}
+
+type accessKey struct{}
+
+// WithAccess returns a copy of ctx carrying the request being evaluated, for
+// providers that need it.
+func WithAccess(ctx context.Context, a Access) context.Context {
+	return context.WithValue(ctx, accessKey{}, a)
+}
+
+// AccessFromContext returns the request stored by WithAccess.
+func AccessFromContext(ctx context.Context) (Access, bool) {
+	a, ok := ctx.Value(accessKey{}).(Access)
+	return a, ok
+}
+
+// ErrCircuitOpen is returned while the webhook circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// WebhookConfig configures a WebhookProvider.
+type WebhookConfig struct {
+	URL string `yaml:"url"`
+	// SecretEnv names the environment variable holding the HMAC key used to
+	// sign requests. Requests are unsigned when empty.
+	SecretEnv string `yaml:"secret_env"`
+	// Timeout bounds each call; 2s when empty.
+	Timeout string `yaml:"timeout"`
+	// CacheTTL is how long responses are reused for identical requests; no
+	// caching when empty.
+	CacheTTL string `yaml:"cache_ttl"`
+	// FailureThreshold consecutive failures open the circuit breaker for
+	// ResetAfter; 5 and 30s when unset.
+	FailureThreshold int    `yaml:"failure_threshold"`
+	ResetAfter       string `yaml:"reset_after"`
+}
+
+// WebhookPayload is the JSON body posted to the webhook.
+type WebhookPayload struct {
+	TenantID  string `json:"tenantID"`
+	Subject   string `json:"subject"`
+	Resource  string `json:"resource"`
+	Action    string `json:"action"`
+	IP        string `json:"ip,omitempty"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+// WebhookProvider obtains context values from an external HTTP service. The
+// service receives a WebhookPayload and answers with a JSON object whose
+// string, number and boolean members become context values.
+type WebhookProvider struct {
+	// TrustedProxies are honoured when determining the client IP sent to the
+	// webhook, through ProxyHeader, as for GeoIPProvider.
+	TrustedProxies []netip.Prefix
+	ProxyHeader    string
+	url            string
+	secret         []byte
+	client         *http.Client
+	ttl            time.Duration
+	breaker        breaker
+	mu             sync.Mutex
+	cache          map[string]cacheEntry
+	now            func() time.Time
+}
+
+type cacheEntry struct {
+	vals    map[string]string
+	expires time.Time
+}
+
+// maxCacheEntries bounds the response cache.
+const maxCacheEntries = 10000
+
+// NewWebhookProvider validates cfg and creates a provider.
+func NewWebhookProvider(cfg WebhookConfig) (*WebhookProvider, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("webhook url is required")
+	}
+	p := &WebhookProvider{
+		url:     cfg.URL,
+		client:  &http.Client{Timeout: 2 * time.Second},
+		breaker: breaker{threshold: 5, cooldown: 30 * time.Second},
+		cache:   make(map[string]cacheEntry),
+		now:     time.Now,
+	}
+	if cfg.SecretEnv != "" {
+		secret := os.Getenv(cfg.SecretEnv)
+		if secret == "" {
+			return nil, fmt.Errorf("webhook secret %s is not set", cfg.SecretEnv)
+		}
+		p.secret = []byte(secret)
+	}
+	durations := []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"timeout", cfg.Timeout, &p.client.Timeout},
+		{"cache_ttl", cfg.CacheTTL, &p.ttl},
+		{"reset_after", cfg.ResetAfter, &p.breaker.cooldown},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("webhook %s %q is not a positive duration", d.name, d.value)
+		}
+		*d.dst = v
+	}
+	if cfg.FailureThreshold < 0 {
+		return nil, errors.New("webhook failure_threshold must not be negative")
+	}
+	if cfg.FailureThreshold > 0 {
+		p.breaker.threshold = cfg.FailureThreshold
+	}
+	return p, nil
+}
+
+// GetContext posts the request being evaluated to the webhook and returns the
+// attributes it answers with.
+func (p *WebhookProvider) GetContext(req *http.Request) (map[string]string, error) {
+	access, _ := AccessFromContext(req.Context())
+	payload := WebhookPayload{
+		TenantID:  access.TenantID,
+		Subject:   access.Subject,
+		Resource:  access.Resource,
+		Action:    access.Action,
+		Method:    req.Method,
+		Path:      req.URL.Path,
+		UserAgent: req.UserAgent(),
+	}
+	if addr, ok := network.ClientIP(req, p.TrustedProxies, p.ProxyHeader); ok {
+		payload.IP = addr.String()
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	key := string(body)
+	if vals, ok := p.cached(key); ok {
+		return vals, nil
+	}
+	if !p.breaker.allow(p.now()) {
+		return nil, ErrCircuitOpen
+	}
+	vals, err := p.call(req.Context(), body)
+	p.breaker.record(err == nil, p.now())
+	if err != nil {
+		return nil, err
+	}
+	p.store(key, vals)
+	return vals, nil
+}
+
+func (p *WebhookProvider) call(ctx context.Context, body []byte) (map[string]string, error) {
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+	if p.secret != nil {
+		ts := strconv.FormatInt(p.now().Unix(), 10)
+		hreq.Header.Set("X-Authz-Timestamp", ts)
+		hreq.Header.Set("X-Authz-Signature", "sha256="+Sign(p.secret, ts, body))
+	}
+	resp, err := p.client.Do(hreq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	var attrs map[string]interface{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&attrs); err != nil {
+		return nil, fmt.Errorf("webhook response: %w", err)
+	}
+	vals := make(map[string]string, len(attrs))
+	for k, v := range attrs {
+		switch v := v.(type) {
+		case string:
+			vals[k] = v
+		case float64:
+			vals[k] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			vals[k] = strconv.FormatBool(v)
+		}
+	}
+	return vals, nil
+}
+
+// Sign returns the hex HMAC-SHA256 of "<timestamp>.<body>". Webhook requests
+// carry it in X-Authz-Signature, so receivers can verify them and reject
+// replays by checking X-Authz-Timestamp; MDM proxies sign device posture
+// headers the same way.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (p *WebhookProvider) cached(key string) (map[string]string, bool) {
+	if p.ttl == 0 {
+		return nil, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e, ok := p.cache[key]
+	if !ok || p.now().After(e.expires) {
+		return nil, false
+	}
+	return e.vals, true
+}
+
+func (p *WebhookProvider) store(key string, vals map[string]string) {
+	if p.ttl == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	if len(p.cache) >= maxCacheEntries {
+		for k, e := range p.cache {
+			if now.After(e.expires) {
+				delete(p.cache, k)
+			}
+		}
+		if len(p.cache) >= maxCacheEntries {
+			p.cache = make(map[string]cacheEntry)
+		}
+	}
+	p.cache[key] = cacheEntry{vals: vals, expires: now.Add(p.ttl)}
+}
+
+// breaker is a consecutive-failure circuit breaker. Once open it rejects calls
+// until cooldown has passed, then lets a single trial call through.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if now.Before(b.openUntil) || b.trial {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+func (b *breaker) record(ok bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+	if ok {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = now.Add(b.cooldown)
+	}
+}
@@ -0,0 +1,148 @@
+package contextprovider
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func accessRequest() *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/check-access", nil)
+	req.RemoteAddr = "198.51.100.7:4711"
+	return req.WithContext(WithAccess(req.Context(), Access{TenantID: "acme", Subject: "alice", Resource: "payments", Action: "approve"}))
+}
+
+func TestWebhookProviderSignsAndCaches(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		body, _ := io.ReadAll(r.Body)
+		ts := r.Header.Get("X-Authz-Timestamp")
+		if r.Header.Get("X-Authz-Signature") != "sha256="+Sign([]byte("s3cret"), ts, body) {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		var p WebhookPayload
+		json.Unmarshal(body, &p)
+		if p.Subject != "alice" || p.Resource != "payments" || p.Action != "approve" || p.IP != "198.51.100.7" {
+			http.Error(w, "unexpected payload", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"fraud_score": 87.5, "risk": "high", "blocked": false, "detail": {"ignored": true}}`))
+	}))
+	defer srv.Close()
+	t.Setenv("FRAUD_SECRET", "s3cret")
+
+	p, err := NewWebhookProvider(WebhookConfig{URL: srv.URL, SecretEnv: "FRAUD_SECRET", CacheTTL: "1m"})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	p.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		vals, err := p.GetContext(accessRequest())
+		if err != nil {
+			t.Fatalf("get context: %v", err)
+		}
+		want := map[string]string{"fraud_score": "87.5", "risk": "high", "blocked": "false"}
+		if len(vals) != len(want) {
+			t.Fatalf("unexpected values %v", vals)
+		}
+		for k, v := range want {
+			if vals[k] != v {
+				t.Fatalf("expected %s=%s, got %v", k, v, vals)
+			}
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected cached response to be reused, got %d calls", calls)
+	}
+	now = now.Add(2 * time.Minute)
+	if _, err := p.GetContext(accessRequest()); err != nil || calls != 2 {
+		t.Fatalf("expected expired entry to be refreshed, got %d calls, err %v", calls, err)
+	}
+}
+
+func TestWebhookProviderCircuitBreaker(t *testing.T) {
+	var calls int32
+	var healthy atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if !healthy.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"risk": "low"}`))
+	}))
+	defer srv.Close()
+
+	p, err := NewWebhookProvider(WebhookConfig{URL: srv.URL, FailureThreshold: 2, ResetAfter: "30s"})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	p.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if _, err := p.GetContext(accessRequest()); err == nil || !strings.Contains(err.Error(), "503") {
+			t.Fatalf("expected upstream error, got %v", err)
+		}
+	}
+	if _, err := p.GetContext(accessRequest()); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected open circuit, got %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected open circuit to skip the webhook, got %d calls", calls)
+	}
+
+	// After the cooldown a failing trial reopens the circuit.
+	now = now.Add(31 * time.Second)
+	if _, err := p.GetContext(accessRequest()); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected trial call to reach the webhook, got %v", err)
+	}
+	if _, err := p.GetContext(accessRequest()); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected circuit to reopen, got %v", err)
+	}
+
+	// A successful trial closes it.
+	now = now.Add(31 * time.Second)
+	healthy.Store(true)
+	for i := 0; i < 2; i++ {
+		if vals, err := p.GetContext(accessRequest()); err != nil || vals["risk"] != "low" {
+			t.Fatalf("expected recovery, got %v %v", vals, err)
+		}
+	}
+}
+
+func TestWebhookProviderTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(200 * time.Millisecond):
+		}
+	}))
+	defer srv.Close()
+
+	p, err := NewWebhookProvider(WebhookConfig{URL: srv.URL, Timeout: "20ms"})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	start := time.Now()
+	if _, err := p.GetContext(accessRequest()); err == nil {
+		t.Fatal("expected timeout")
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatal("timeout was not applied")
+	}
+
+	if _, err := NewWebhookProvider(WebhookConfig{URL: srv.URL, SecretEnv: "UNSET_WEBHOOK_SECRET"}); err == nil {
+		t.Fatal("expected missing secret to be rejected")
+	}
+}
@@ -0,0 +1,232 @@
+// Package geoip resolves IP addresses to locations using local MaxMind DB
+// (MMDB) files such as GeoIP2/GeoLite2 City, ASN and Anonymous IP. Databases
+// are reloaded when the file on disk changes.
+package geoip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	lookupFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "geoip_lookup_failures_total",
+			Help: "GeoIP lookups that produced no location",
+		},
+		[]string{"reason"},
+	)
+	reloads = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "geoip_reloads_total",
+			Help: "GeoIP database reload attempts",
+		},
+		[]string{"result"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(lookupFailures, reloads)
+}
+
+// ErrNotFound is returned when the database has no record for an address.
+var ErrNotFound = errors.New("address not found")
+
+// Location describes where an address is located. Fields a database does not
+// provide are left empty.
+type Location struct {
+	Country        string // ISO 3166-1 alpha-2 code
+	Region         string // ISO 3166-2 code of the most general subdivision
+	City           string // English city name
+	ASN            uint
+	ASOrg          string
+	AnonymousProxy bool
+}
+
+// Merge fills the fields of l that are empty from other.
+func (l *Location) Merge(other Location) {
+	if l.Country == "" {
+		l.Country = other.Country
+	}
+	if l.Region == "" {
+		l.Region = other.Region
+	}
+	if l.City == "" {
+		l.City = other.City
+	}
+	if l.ASN == 0 {
+		l.ASN, l.ASOrg = other.ASN, other.ASOrg
+	}
+	l.AnonymousProxy = l.AnonymousProxy || other.AnonymousProxy
+}
+
+// record covers the fields of the City, Country, Enterprise, ASN and
+// Anonymous IP database types.
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Traits struct {
+		ASN              uint   `maxminddb:"autonomous_system_number"`
+		ASOrg            string `maxminddb:"autonomous_system_organization"`
+		IsAnonymousProxy bool   `maxminddb:"is_anonymous_proxy"`
+		IsAnonymous      bool   `maxminddb:"is_anonymous"`
+	} `maxminddb:"traits"`
+	ASN            uint   `maxminddb:"autonomous_system_number"`
+	ASOrg          string `maxminddb:"autonomous_system_organization"`
+	IsAnonymous    bool   `maxminddb:"is_anonymous"`
+	IsPublicProxy  bool   `maxminddb:"is_public_proxy"`
+	IsTorExitNode  bool   `maxminddb:"is_tor_exit_node"`
+	IsAnonymousVPN bool   `maxminddb:"is_anonymous_vpn"`
+}
+
+func (r record) location() Location {
+	l := Location{
+		Country: r.Country.ISOCode,
+		City:    r.City.Names["en"],
+		ASN:     r.ASN,
+		ASOrg:   r.ASOrg,
+		AnonymousProxy: r.Traits.IsAnonymousProxy || r.Traits.IsAnonymous ||
+			r.IsAnonymous || r.IsPublicProxy || r.IsTorExitNode || r.IsAnonymousVPN,
+	}
+	if len(r.Subdivisions) > 0 && r.Subdivisions[0].ISOCode != "" && l.Country != "" {
+		l.Region = l.Country + "-" + r.Subdivisions[0].ISOCode
+	}
+	if l.ASN == 0 {
+		l.ASN, l.ASOrg = r.Traits.ASN, r.Traits.ASOrg
+	}
+	return l
+}
+
+// DB is a MaxMind database file that can be reloaded while in use.
+type DB struct {
+	path    string
+	mu      sync.RWMutex
+	reader  *maxminddb.Reader
+	modTime time.Time
+	size    int64
+}
+
+// Open opens the database at path.
+func Open(path string) (*DB, error) {
+	db := &DB{path: path}
+	if _, err := db.Reload(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Path returns the file the database is read from.
+func (db *DB) Path() string {
+	return db.path
+}
+
+// Reload reopens the file if its size or modification time changed since it
+// was last read. It reports whether a new version was loaded. On failure the
+// previous version stays in use.
+func (db *DB) Reload() (bool, error) {
+	info, err := os.Stat(db.path)
+	if err != nil {
+		reloads.WithLabelValues("failure").Inc()
+		return false, fmt.Errorf("geoip: %w", err)
+	}
+	db.mu.RLock()
+	unchanged := db.reader != nil && info.ModTime().Equal(db.modTime) && info.Size() == db.size
+	db.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	// The file is read into memory so that it may be replaced in place.
+	data, err := os.ReadFile(db.path)
+	if err != nil {
+		reloads.WithLabelValues("failure").Inc()
+		return false, fmt.Errorf("geoip: %w", err)
+	}
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		reloads.WithLabelValues("failure").Inc()
+		return false, fmt.Errorf("geoip: %s: %w", db.path, err)
+	}
+	db.mu.Lock()
+	db.reader, db.modTime, db.size = reader, info.ModTime(), info.Size()
+	db.mu.Unlock()
+	reloads.WithLabelValues("success").Inc()
+	return true, nil
+}
+
+// Watch reloads the database every interval until ctx is done. Failed reloads
+// are counted and retried on the next tick.
+func (db *DB) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			db.Reload()
+		}
+	}
+}
+
+// Lookup returns the location of addr. It returns ErrNotFound when the
+// database has no record for it. Failures are not counted; see LookupAll.
+func (db *DB) Lookup(addr netip.Addr) (Location, error) {
+	db.mu.RLock()
+	reader := db.reader
+	db.mu.RUnlock()
+	var r record
+	_, ok, err := reader.LookupNetwork(addr.Unmap().AsSlice(), &r)
+	if err != nil {
+		return Location{}, fmt.Errorf("geoip: lookup %s: %w", addr, err)
+	}
+	if !ok {
+		return Location{}, ErrNotFound
+	}
+	return r.location(), nil
+}
+
+// LookupAll merges the locations of addr in dbs, earlier databases taking
+// precedence. A failure is counted once, and only when no database resolved
+// the address: as an error when any lookup failed, otherwise as not_found.
+func LookupAll(dbs []*DB, addr netip.Addr) (Location, bool) {
+	var loc Location
+	found, failed := false, false
+	for _, db := range dbs {
+		l, err := db.Lookup(addr)
+		if err != nil {
+			failed = failed || !errors.Is(err, ErrNotFound)
+			continue
+		}
+		loc.Merge(l)
+		found = true
+	}
+	switch {
+	case found || len(dbs) == 0:
+	case failed:
+		lookupFailures.WithLabelValues("error").Inc()
+	default:
+		lookupFailures.WithLabelValues("not_found").Inc()
+	}
+	return loc, found
+}
+
+// RecordInvalidAddress counts a lookup skipped because the client address
+// could not be determined.
+func RecordInvalidAddress() {
+	lookupFailures.WithLabelValues("invalid_address").Inc()
+}
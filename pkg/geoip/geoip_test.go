@@ -0,0 +1,148 @@
+package geoip
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// writeDB writes an MMDB file mapping each network to its record.
+func writeDB(t *testing.T, path, dbType string, records map[string]mmdbtype.Map) {
+	t.Helper()
+	w, err := mmdbwriter.New(mmdbwriter.Options{DatabaseType: dbType, RecordSize: 24})
+	if err != nil {
+		t.Fatalf("writer: %v", err)
+	}
+	for cidr, rec := range records {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("cidr: %v", err)
+		}
+		if err := w.Insert(n, rec); err != nil {
+			t.Fatalf("insert %s: %v", cidr, err)
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer f.Close()
+	if _, err := w.WriteTo(f); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func cityRecord(country, region, city string) mmdbtype.Map {
+	return mmdbtype.Map{
+		"country":      mmdbtype.Map{"iso_code": mmdbtype.String(country)},
+		"subdivisions": mmdbtype.Slice{mmdbtype.Map{"iso_code": mmdbtype.String(region)}},
+		"city":         mmdbtype.Map{"names": mmdbtype.Map{"en": mmdbtype.String(city)}},
+	}
+}
+
+func TestLookup(t *testing.T) {
+	dir := t.TempDir()
+	city := filepath.Join(dir, "city.mmdb")
+	writeDB(t, city, "GeoIP2-City", map[string]mmdbtype.Map{
+		"81.2.69.0/24":  cityRecord("GB", "ENG", "London"),
+		"2a02:ec0::/29": cityRecord("DE", "BE", "Berlin"),
+	})
+	asn := filepath.Join(dir, "asn.mmdb")
+	writeDB(t, asn, "GeoLite2-ASN", map[string]mmdbtype.Map{
+		"81.2.69.0/24": {
+			"autonomous_system_number":       mmdbtype.Uint32(20712),
+			"autonomous_system_organization": mmdbtype.String("Andrews & Arnold"),
+		},
+	})
+	anon := filepath.Join(dir, "anon.mmdb")
+	writeDB(t, anon, "GeoIP2-Anonymous-IP", map[string]mmdbtype.Map{
+		"81.2.69.128/25": {"is_anonymous": mmdbtype.Bool(true), "is_public_proxy": mmdbtype.Bool(true)},
+	})
+
+	var dbs []*DB
+	for _, p := range []string{city, asn, anon} {
+		db, err := Open(p)
+		if err != nil {
+			t.Fatalf("open %s: %v", p, err)
+		}
+		dbs = append(dbs, db)
+	}
+	lookup := func(ip string) Location {
+		loc, _ := LookupAll(dbs, netip.MustParseAddr(ip))
+		return loc
+	}
+
+	want := Location{Country: "GB", Region: "GB-ENG", City: "London", ASN: 20712, ASOrg: "Andrews & Arnold"}
+	if got := lookup("81.2.69.1"); got != want {
+		t.Fatalf("unexpected location %+v", got)
+	}
+	want.AnonymousProxy = true
+	if got := lookup("::ffff:81.2.69.200"); got != want {
+		t.Fatalf("unexpected location for anonymous proxy %+v", got)
+	}
+	if got := lookup("2a02:ec0::1"); got != (Location{Country: "DE", Region: "DE-BE", City: "Berlin"}) {
+		t.Fatalf("unexpected IPv6 location %+v", got)
+	}
+
+	before := testutil.ToFloat64(lookupFailures.WithLabelValues("not_found"))
+	if _, err := dbs[0].Lookup(netip.MustParseAddr("8.8.8.8")); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	// An address missing from some databases only is not a failure.
+	lookup("2a02:ec0::1")
+	if got := testutil.ToFloat64(lookupFailures.WithLabelValues("not_found")); got != before {
+		t.Fatalf("expected partial matches not to be counted, got %v", got-before)
+	}
+	if _, found := LookupAll(dbs, netip.MustParseAddr("8.8.8.8")); found {
+		t.Fatal("expected 8.8.8.8 not to be found")
+	}
+	if got := testutil.ToFloat64(lookupFailures.WithLabelValues("not_found")); got != before+1 {
+		t.Fatalf("expected one not_found failure for three databases, got %v", got-before)
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	writeDB(t, path, "GeoIP2-City", map[string]mmdbtype.Map{"81.2.69.0/24": cityRecord("GB", "ENG", "London")})
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	addr := netip.MustParseAddr("81.2.69.1")
+
+	if changed, err := db.Reload(); changed || err != nil {
+		t.Fatalf("expected unchanged file to be skipped, got %v %v", changed, err)
+	}
+
+	writeDB(t, path, "GeoIP2-City", map[string]mmdbtype.Map{"81.2.69.0/24": cityRecord("FR", "IDF", "Paris")})
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(path, later, later)
+	if changed, err := db.Reload(); !changed || err != nil {
+		t.Fatalf("expected reload, got %v %v", changed, err)
+	}
+	if loc, _ := db.Lookup(addr); loc.Country != "FR" {
+		t.Fatalf("expected reloaded data, got %+v", loc)
+	}
+
+	failures := testutil.ToFloat64(reloads.WithLabelValues("failure"))
+	if err := os.WriteFile(path, []byte("not a database"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Reload(); err == nil {
+		t.Fatal("expected corrupt database to fail to load")
+	}
+	if got := testutil.ToFloat64(reloads.WithLabelValues("failure")); got != failures+1 {
+		t.Fatalf("expected reload failure to be counted")
+	}
+	if loc, _ := db.Lookup(addr); loc.Country != "FR" {
+		t.Fatalf("expected previous data to stay in use, got %+v", loc)
+	}
+}
@@ -0,0 +1,583 @@
+// Package lint statically analyses policy files for rules that conflict, can
+// never be reached or reference definitions that do not exist.
+package lint
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/bradtumy/authorization-service/pkg/network"
+	"github.com/bradtumy/authorization-service/pkg/policy"
+	"github.com/bradtumy/authorization-service/pkg/validator"
+)
+
+// Finding codes reported by Lint.
+const (
+	CodeUndefinedPolicy = "undefined-policy"
+	CodeUndefinedRole   = "undefined-role"
+	CodeUnattached      = "unattached"
+	CodeShadowed        = "shadowed"
+	CodeConflict        = "conflict"
+	CodeInvalidWhen     = "invalid-when"
+	CodeUnreachableWhen = "unreachable-when"
+	CodeUnusedRule      = "unused-remediation"
+)
+
+type roleEntry struct {
+	policy.Role
+	node *yaml.Node
+}
+
+type userEntry struct {
+	policy.User
+	node *yaml.Node
+}
+
+type policyEntry struct {
+	policy.Policy
+	node *yaml.Node
+}
+
+type ruleEntry struct {
+	policy.RemediationRule
+	node *yaml.Node
+}
+
+// document is a policy file decoded with the position of every entry.
+type document struct {
+	roles    []roleEntry
+	users    []userEntry
+	policies []policyEntry
+	rules    []ruleEntry
+	zones    map[string][]string
+	roleSet  map[string]*roleEntry
+	polSet   map[string]*policyEntry
+}
+
+// LintFile analyses the policy file at path.
+func LintFile(path string) ([]validator.Finding, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Lint(data)
+}
+
+// Lint analyses YAML policy data and returns its findings ordered by position.
+// An error is returned only when the data cannot be parsed.
+func Lint(data []byte) ([]validator.Finding, error) {
+	doc, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+	var out []validator.Finding
+	out = append(out, doc.undefinedReferences()...)
+	out = append(out, doc.unattached()...)
+	out = append(out, doc.shadowed()...)
+	out = append(out, doc.conflicts()...)
+	out = append(out, doc.unreachableWhen()...)
+	out = append(out, doc.remediationRules()...)
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Line != out[j].Line {
+			return out[i].Line < out[j].Line
+		}
+		return out[i].Column < out[j].Column
+	})
+	return out, nil
+}
+
+func parse(data []byte) (*document, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	doc := &document{roleSet: map[string]*roleEntry{}, polSet: map[string]*policyEntry{}}
+	if len(root.Content) == 0 {
+		return doc, nil
+	}
+	top := root.Content[0]
+	if top.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: policy file must be a mapping", top.Line)
+	}
+	for _, n := range items(field(top, "roles")) {
+		var r policy.Role
+		if err := n.Decode(&r); err != nil {
+			return nil, err
+		}
+		doc.roles = append(doc.roles, roleEntry{r, n})
+	}
+	for _, n := range items(field(top, "users")) {
+		var u policy.User
+		if err := n.Decode(&u); err != nil {
+			return nil, err
+		}
+		doc.users = append(doc.users, userEntry{u, n})
+	}
+	for _, n := range items(field(top, "policies")) {
+		var p policy.Policy
+		if err := n.Decode(&p); err != nil {
+			return nil, err
+		}
+		doc.policies = append(doc.policies, policyEntry{p, n})
+	}
+	for _, n := range items(field(top, "remediation")) {
+		var r policy.RemediationRule
+		if err := n.Decode(&r); err != nil {
+			return nil, err
+		}
+		doc.rules = append(doc.rules, ruleEntry{r, n})
+	}
+	if n := field(top, "zones"); n != nil {
+		if err := n.Decode(&doc.zones); err != nil {
+			return nil, err
+		}
+	}
+	for i := range doc.roles {
+		doc.roleSet[doc.roles[i].Name] = &doc.roles[i]
+	}
+	for i := range doc.policies {
+		doc.polSet[doc.policies[i].ID] = &doc.policies[i]
+	}
+	return doc, nil
+}
+
+// field returns the value node stored under key in a mapping node.
+func field(m *yaml.Node, key string) *yaml.Node {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func items(n *yaml.Node) []*yaml.Node {
+	if n == nil || n.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return n.Content
+}
+
+// item returns the node of the i-th element of the list stored under key,
+// falling back to the entry itself.
+func item(entry *yaml.Node, key string, i int) *yaml.Node {
+	if list := items(field(entry, key)); i < len(list) {
+		return list[i]
+	}
+	return entry
+}
+
+func finding(n *yaml.Node, code, severity, format string, args ...interface{}) validator.Finding {
+	return validator.Finding{
+		Line:     n.Line,
+		Column:   n.Column,
+		Code:     code,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+func (d *document) undefinedReferences() []validator.Finding {
+	var out []validator.Finding
+	for _, r := range d.roles {
+		for i, id := range r.Policies {
+			if _, ok := d.polSet[id]; !ok {
+				out = append(out, finding(item(r.node, "policies", i), CodeUndefinedPolicy, validator.SeverityError,
+					"role %q references undefined policy %q", r.Name, id))
+			}
+		}
+	}
+	for _, u := range d.users {
+		for i, name := range u.Roles {
+			if _, ok := d.roleSet[name]; !ok {
+				out = append(out, finding(item(u.node, "roles", i), CodeUndefinedRole, validator.SeverityError,
+					"user %q holds undefined role %q", u.Username, name))
+			}
+		}
+	}
+	for _, p := range d.policies {
+		for i, s := range p.Subjects {
+			if _, ok := d.roleSet[s.Role]; !ok {
+				out = append(out, finding(item(p.node, "subjects", i), CodeUndefinedRole, validator.SeverityError,
+					"policy %q names undefined subject role %q", p.ID, s.Role))
+			}
+		}
+	}
+	return out
+}
+
+// appliesTo reports whether the engine evaluates p for holders of role.
+func appliesTo(p policy.Policy, role string) bool {
+	if len(p.Subjects) == 0 {
+		return true
+	}
+	for _, s := range p.Subjects {
+		if s.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// effectiveRoles returns the roles that attach p and are allowed by its
+// subjects, in file order.
+func (d *document) effectiveRoles(p policy.Policy) (attached, effective []string) {
+	for _, r := range d.roles {
+		if !contains(r.Policies, p.ID) {
+			continue
+		}
+		attached = append(attached, r.Name)
+		if appliesTo(p, r.Name) {
+			effective = append(effective, r.Name)
+		}
+	}
+	return attached, effective
+}
+
+func (d *document) unattached() []validator.Finding {
+	var out []validator.Finding
+	for _, p := range d.policies {
+		attached, effective := d.effectiveRoles(p.Policy)
+		switch {
+		case len(attached) == 0:
+			out = append(out, finding(p.node, CodeUnattached, validator.SeverityWarning,
+				"policy %q is not attached to any role", p.ID))
+		case len(effective) == 0:
+			out = append(out, finding(p.node, CodeUnattached, validator.SeverityWarning,
+				"policy %q is attached to %s but its subjects exclude them", p.ID, quoteList(attached)))
+		}
+	}
+	return out
+}
+
+// shadowed reports policies that are never evaluated because, in every role
+// that uses them, an earlier policy matches all of their resources and actions.
+// The engine stops at the first matching policy whatever its conditions, so a
+// conditional rule shadows just as well as an unconditional one.
+func (d *document) shadowed() []validator.Finding {
+	var out []validator.Finding
+	for _, q := range d.policies {
+		_, roles := d.effectiveRoles(q.Policy)
+		if len(roles) == 0 {
+			continue
+		}
+		var by []string
+		for _, name := range roles {
+			p := d.shadowIn(d.roleSet[name], q.Policy)
+			if p == nil {
+				by = nil
+				break
+			}
+			by = append(by, fmt.Sprintf("%q in role %q", p.ID, name))
+		}
+		if by != nil {
+			out = append(out, finding(q.node, CodeShadowed, validator.SeverityWarning,
+				"policy %q is never reached: shadowed by %s", q.ID, strings.Join(by, ", ")))
+		}
+	}
+	return out
+}
+
+// shadowIn returns the earlier policy in role that covers q, if any.
+func (d *document) shadowIn(role *roleEntry, q policy.Policy) *policyEntry {
+	for _, id := range role.Policies {
+		if id == q.ID {
+			return nil
+		}
+		p, ok := d.polSet[id]
+		if !ok || !appliesTo(p.Policy, role.Name) {
+			continue
+		}
+		if covers(p.Resource, q.Resource) && covers(p.Action, q.Action) {
+			return p
+		}
+	}
+	return nil
+}
+
+// conflicts reports allow and deny policies that match the same resource and
+// action for some subject, leaving the outcome to evaluation order.
+func (d *document) conflicts() []validator.Finding {
+	var out []validator.Finding
+	for i, p := range d.policies {
+		for _, q := range d.policies[i+1:] {
+			if p.Effect == q.Effect || !isEffect(p.Effect) || !isEffect(q.Effect) {
+				continue
+			}
+			if !intersects(p.Resource, q.Resource) || !intersects(p.Action, q.Action) {
+				continue
+			}
+			holder := d.commonHolder(p.Policy, q.Policy)
+			if holder == "" {
+				continue
+			}
+			out = append(out, finding(q.node, CodeConflict, validator.SeverityWarning,
+				"policy %q (%s) overlaps policy %q (%s) on resource %q action %q for %s; the first one evaluated wins",
+				q.ID, q.Effect, p.ID, p.Effect, overlap(p.Resource, q.Resource), overlap(p.Action, q.Action), holder))
+		}
+	}
+	return out
+}
+
+// commonHolder describes a role or user to which both policies apply.
+func (d *document) commonHolder(p, q policy.Policy) string {
+	_, pr := d.effectiveRoles(p)
+	_, qr := d.effectiveRoles(q)
+	for _, r := range pr {
+		if contains(qr, r) {
+			return fmt.Sprintf("role %q", r)
+		}
+	}
+	for _, u := range d.users {
+		if holdsAny(u.Roles, pr) && holdsAny(u.Roles, qr) {
+			return fmt.Sprintf("user %q", u.Username)
+		}
+	}
+	return ""
+}
+
+// bounds collects the constraints a policy places on one context key.
+type bounds struct {
+	eq             *string
+	lo, hi         *float64
+	loRank, hiRank int
+}
+
+func (d *document) unreachableWhen() []validator.Finding {
+	var out []validator.Finding
+	for _, p := range d.policies {
+		keys := map[string]*bounds{}
+		dead := map[string]bool{}
+		check := func(n *yaml.Node, e policy.Expression) {
+			if dead[e.Key] {
+				return
+			}
+			b, ok := keys[e.Key]
+			if !ok {
+				b = &bounds{}
+				keys[e.Key] = b
+			}
+			if reason := b.add(e); reason != "" {
+				dead[e.Key] = true
+				out = append(out, finding(n, CodeUnreachableWhen, validator.SeverityWarning,
+					"policy %q can never match: %s", p.ID, reason))
+			}
+		}
+		conds := field(p.node, "conditions")
+		if conds != nil && conds.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(conds.Content); i += 2 {
+				key, val := conds.Content[i], conds.Content[i+1]
+				if key.Value == "time" {
+					continue
+				}
+				check(key, policy.Expression{Key: key.Value, Op: "==", Value: val.Value})
+			}
+		}
+		for i, expr := range p.When {
+			n := item(p.node, "when", i)
+			e, ok := policy.ParseExpression(expr)
+			if !ok {
+				out = append(out, finding(n, CodeInvalidWhen, validator.SeverityError,
+					"policy %q has invalid when clause %q: expected context.<key> followed by ==, <, > or contains, or in cidr(...) or zone(...)", p.ID, expr))
+				continue
+			}
+			if e.Op == "in" {
+				if reason := d.badNetwork(e); reason != "" {
+					out = append(out, finding(n, CodeInvalidWhen, validator.SeverityError,
+						"policy %q has invalid when clause %q: %s", p.ID, expr, reason))
+				}
+				continue
+			}
+			check(n, e)
+		}
+	}
+	return out
+}
+
+// remediationRules reports invalid if expressions of remediation rules, and
+// policies and when entries they name that do not exist, so the rule never
+// matches them.
+func (d *document) remediationRules() []validator.Finding {
+	clauses := map[string]bool{}
+	for _, p := range d.policies {
+		for _, expr := range p.When {
+			clauses[strings.Join(strings.Fields(expr), " ")] = true
+		}
+	}
+	var out []validator.Finding
+	for _, r := range d.rules {
+		for i, expr := range r.If {
+			if _, ok := policy.ParseExpression(expr); !ok {
+				out = append(out, finding(item(r.node, "if", i), CodeInvalidWhen, validator.SeverityError,
+					"remediation rule %q has invalid if clause %q: expected context.<key> followed by ==, <, > or contains, or in cidr(...) or zone(...)", r.ID, expr))
+			}
+		}
+		for i, id := range r.Policies {
+			if _, ok := d.polSet[id]; !ok {
+				out = append(out, finding(item(r.node, "policies", i), CodeUnusedRule, validator.SeverityWarning,
+					"remediation rule %q names undefined policy %s", r.ID, id))
+			}
+		}
+		for i, expr := range r.When {
+			if !clauses[strings.Join(strings.Fields(expr), " ")] {
+				out = append(out, finding(item(r.node, "when", i), CodeUnusedRule, validator.SeverityWarning,
+					"remediation rule %q matches when clause %q, which no policy has", r.ID, expr))
+			}
+		}
+	}
+	return out
+}
+
+// badNetwork reports an undefined zone or malformed range in an in
+// expression, or returns an empty string.
+func (d *document) badNetwork(e policy.Expression) string {
+	for _, arg := range e.Args {
+		if e.Value == "zone" {
+			if _, ok := d.zones[arg]; !ok {
+				return fmt.Sprintf("zone %q is not defined", arg)
+			}
+		} else if _, err := network.ParsePrefix(arg); err != nil {
+			return err.Error()
+		}
+	}
+	return ""
+}
+
+// add records e and returns why the combined constraints cannot be satisfied,
+// or an empty string.
+func (b *bounds) add(e policy.Expression) string {
+	switch e.Op {
+	case "==":
+		if b.eq != nil && *b.eq != e.Value {
+			return fmt.Sprintf("context.%s cannot equal both %q and %q", e.Key, *b.eq, e.Value)
+		}
+		v := e.Value
+		b.eq = &v
+	case "<", ">":
+		if f, err := strconv.ParseFloat(e.Value, 64); err == nil {
+			if e.Op == ">" && (b.lo == nil || f > *b.lo) {
+				b.lo = &f
+			}
+			if e.Op == "<" && (b.hi == nil || f < *b.hi) {
+				b.hi = &f
+			}
+		} else if r, ok := policy.LevelRank(e.Value); ok {
+			if e.Op == ">" && r > b.loRank {
+				b.loRank = r
+			}
+			if e.Op == "<" && (b.hiRank == 0 || r < b.hiRank) {
+				b.hiRank = r
+			}
+		}
+	}
+	return b.conflict(e.Key)
+}
+
+func (b *bounds) conflict(key string) string {
+	if b.lo != nil && b.hi != nil && *b.lo >= *b.hi {
+		return fmt.Sprintf("no value of context.%s is greater than %v and less than %v", key, *b.lo, *b.hi)
+	}
+	hiRank := b.hiRank
+	if hiRank == 0 {
+		hiRank = len(policy.Levels) + 1
+	}
+	if (b.loRank > 0 || b.hiRank > 0) && hiRank-b.loRank <= 1 {
+		var parts []string
+		if b.loRank > 0 {
+			parts = append(parts, fmt.Sprintf("above %q", policy.Levels[b.loRank-1]))
+		}
+		if b.hiRank > 0 {
+			parts = append(parts, fmt.Sprintf("below %q", policy.Levels[b.hiRank-1]))
+		}
+		return fmt.Sprintf("no level of context.%s is %s", key, strings.Join(parts, " and "))
+	}
+	if b.eq == nil {
+		return ""
+	}
+	if f, err := strconv.ParseFloat(*b.eq, 64); err == nil {
+		if (b.lo != nil && f <= *b.lo) || (b.hi != nil && f >= *b.hi) {
+			return fmt.Sprintf("context.%s == %q is outside its numeric bounds", key, *b.eq)
+		}
+	} else if r, ok := policy.LevelRank(*b.eq); ok {
+		if r <= b.loRank || (b.hiRank > 0 && r >= b.hiRank) {
+			return fmt.Sprintf("context.%s == %q is outside its level bounds", key, *b.eq)
+		}
+	}
+	return ""
+}
+
+func isEffect(e string) bool {
+	return e == "allow" || e == "deny"
+}
+
+// covers reports whether every value matched by b is also matched by a.
+func covers(a, b []string) bool {
+	if contains(a, "*") {
+		return true
+	}
+	for _, v := range b {
+		if !contains(a, v) {
+			return false
+		}
+	}
+	return len(b) > 0
+}
+
+func intersects(a, b []string) bool {
+	return overlap(a, b) != ""
+}
+
+// overlap returns a value matched by both lists, preferring a concrete one.
+func overlap(a, b []string) string {
+	for _, v := range a {
+		if v != "*" && (contains(b, v) || contains(b, "*")) {
+			return v
+		}
+	}
+	for _, v := range b {
+		if v != "*" && contains(a, "*") {
+			return v
+		}
+	}
+	if contains(a, "*") && contains(b, "*") {
+		return "*"
+	}
+	return ""
+}
+
+func holdsAny(held, roles []string) bool {
+	for _, r := range roles {
+		if contains(held, r) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func quoteList(list []string) string {
+	q := make([]string, len(list))
+	for i, s := range list {
+		q[i] = strconv.Quote(s)
+	}
+	if len(q) == 1 {
+		return "role " + q[0]
+	}
+	return "roles " + strings.Join(q, ", ")
+}
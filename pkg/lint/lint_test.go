@@ -0,0 +1,186 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bradtumy/authorization-service/pkg/validator"
+)
+
+const lintYAML = `roles:
+  - name: "admin"
+    policies: ["read-all", "read-file1", "missing"]
+  - name: "auditor"
+    policies: ["deny-file1"]
+users:
+  - username: "alice"
+    roles: ["admin", "auditor"]
+  - username: "bob"
+    roles: ["ghost"]
+policies:
+  - id: "read-all"
+    resource: ["*"]
+    action: ["read"]
+    effect: "allow"
+  - id: "read-file1"
+    resource: ["file1"]
+    action: ["read"]
+    effect: "allow"
+  - id: "deny-file1"
+    resource: ["file1"]
+    action: ["read", "write"]
+    effect: "deny"
+  - id: "orphan"
+    resource: ["file2"]
+    action: ["read"]
+    effect: "allow"
+    when:
+      - context.risk < "low"
+      - risk == high
+`
+
+func TestLintFindings(t *testing.T) {
+	findings, err := Lint([]byte(lintYAML))
+	if err != nil {
+		t.Fatalf("lint: %v", err)
+	}
+	want := map[string]int{
+		CodeUndefinedPolicy: 3,
+		CodeUndefinedRole:   10,
+		CodeShadowed:        16,
+		CodeConflict:        20,
+		CodeUnattached:      24,
+		CodeUnreachableWhen: 29,
+		CodeInvalidWhen:     30,
+	}
+	got := map[string]validator.Finding{}
+	conflicts := 0
+	for _, f := range findings {
+		if f.Code == CodeConflict {
+			conflicts++
+		}
+		if _, dup := got[f.Code]; dup && f.Code != CodeConflict {
+			t.Fatalf("unexpected second %s finding: %s", f.Code, f)
+		}
+		got[f.Code] = f
+	}
+	// deny-file1 overlaps both read-all and read-file1 for alice.
+	if conflicts != 2 {
+		t.Fatalf("expected 2 conflicts, got %d in %v", conflicts, findings)
+	}
+	for code, line := range want {
+		f, ok := got[code]
+		if !ok {
+			t.Fatalf("missing %s finding in %v", code, findings)
+		}
+		if f.Line != line {
+			t.Errorf("%s reported on line %d, want %d: %s", code, f.Line, line, f)
+		}
+	}
+	if len(findings) != len(want)+1 {
+		t.Fatalf("expected %d findings, got %v", len(want), findings)
+	}
+	if !strings.Contains(got[CodeShadowed].Message, `"read-all"`) {
+		t.Fatalf("shadowed finding should name the broader rule: %s", got[CodeShadowed])
+	}
+	if !strings.Contains(got[CodeConflict].Message, `user "alice"`) {
+		t.Fatalf("conflict finding should name the shared holder: %s", got[CodeConflict])
+	}
+}
+
+func TestLintContradictoryBounds(t *testing.T) {
+	data := []byte(`roles:
+  - name: "admin"
+    policies: ["p1"]
+policies:
+  - id: "p1"
+    resource: ["*"]
+    action: ["read"]
+    effect: "allow"
+    conditions:
+      risk: "high"
+    when:
+      - context.score > 80
+      - context.score < 20
+      - context.risk < "medium"
+`)
+	findings, err := Lint(data)
+	if err != nil {
+		t.Fatalf("lint: %v", err)
+	}
+	if len(findings) != 2 {
+		t.Fatalf("expected two unreachable clauses, got %v", findings)
+	}
+	if findings[0].Line != 13 || findings[1].Line != 14 {
+		t.Fatalf("unexpected positions %v", findings)
+	}
+}
+
+func TestLintNetworkClauses(t *testing.T) {
+	data := []byte(`roles:
+  - name: "admin"
+    policies: ["p1"]
+policies:
+  - id: "p1"
+    resource: ["*"]
+    action: ["read"]
+    effect: "allow"
+    when:
+      - context.ip in zone("corp")
+      - context.ip in zone("office-nyc")
+      - context.ip in cidr("10.0.0.0/8", "fd00::/8")
+      - context.ip in cidr("10.0.0.300/8")
+zones:
+  corp: ["10.0.0.0/8"]
+`)
+	findings, err := Lint(data)
+	if err != nil {
+		t.Fatalf("lint: %v", err)
+	}
+	if len(findings) != 2 {
+		t.Fatalf("expected two invalid clauses, got %v", findings)
+	}
+	if findings[0].Line != 11 || !strings.Contains(findings[0].Message, `zone "office-nyc" is not defined`) {
+		t.Fatalf("expected undefined zone on line 11, got %s", findings[0])
+	}
+	if findings[1].Line != 13 || findings[1].Code != CodeInvalidWhen {
+		t.Fatalf("expected invalid CIDR on line 13, got %s", findings[1])
+	}
+}
+
+func TestLintRemediationRules(t *testing.T) {
+	data := []byte(`roles:
+  - name: "admin"
+    policies: ["p1"]
+policies:
+  - id: "p1"
+    resource: ["*"]
+    action: ["read"]
+    effect: "allow"
+    when:
+      - context.auth.level == mfa
+remediation:
+  - id: "step-up"
+    policies: ["p1", "p2"]
+    when: ["context.auth.level == mfa", "context.mfa == true"]
+    if: ["risk_score > 70"]
+    advice:
+      - code: step_up
+`)
+	findings, err := Lint(data)
+	if err != nil {
+		t.Fatalf("lint: %v", err)
+	}
+	if len(findings) != 3 {
+		t.Fatalf("expected three remediation findings, got %v", findings)
+	}
+	if findings[0].Line != 13 || findings[0].Code != CodeUnusedRule || !strings.Contains(findings[0].Message, "p2") {
+		t.Fatalf("expected an undefined policy on line 13, got %s", findings[0])
+	}
+	if findings[1].Line != 14 || findings[1].Code != CodeUnusedRule || !strings.Contains(findings[1].Message, "context.mfa") {
+		t.Fatalf("expected an unused when clause on line 14, got %s", findings[1])
+	}
+	if findings[2].Line != 15 || findings[2].Code != CodeInvalidWhen {
+		t.Fatalf("expected an invalid if clause on line 15, got %s", findings[2])
+	}
+}
@@ -0,0 +1,142 @@
+// Package network parses IP ranges and determines the client address of HTTP
+// requests that pass through trusted proxies.
+package network
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ParsePrefix parses a CIDR range such as "10.0.0.0/8" or "2001:db8::/32". A
+// bare address is treated as a single-host range.
+func ParsePrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR %q", s)
+		}
+		return p.Masked(), nil
+	}
+	a, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid address %q", s)
+	}
+	a = a.Unmap()
+	return netip.PrefixFrom(a, a.BitLen()), nil
+}
+
+// ParsePrefixes parses each entry with ParsePrefix.
+func ParsePrefixes(list []string) ([]netip.Prefix, error) {
+	out := make([]netip.Prefix, 0, len(list))
+	for _, s := range list {
+		p, err := ParsePrefix(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// Contains reports whether addr lies in any of the prefixes. IPv4-mapped IPv6
+// addresses match IPv4 ranges.
+func Contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Forwarding headers ClientIP can read.
+const (
+	HeaderXForwardedFor = "X-Forwarded-For"
+	HeaderForwarded     = "Forwarded"
+)
+
+// ParseProxyHeader maps "x-forwarded-for" or "forwarded", in any case, to the
+// header ClientIP reads. An empty string selects X-Forwarded-For.
+func ParseProxyHeader(s string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "x-forwarded-for":
+		return HeaderXForwardedFor, nil
+	case "forwarded":
+		return HeaderForwarded, nil
+	}
+	return "", fmt.Errorf("unsupported proxy header %q", s)
+}
+
+// ClientIP returns the address of the client that originated req. The peer
+// address is used unless it is a trusted proxy, in which case the forwarding
+// chain from header, HeaderForwarded or HeaderXForwardedFor (the default when
+// empty), is walked from the nearest hop and the first untrusted address is
+// returned. Only that header is read, so a client cannot pick the other one
+// when the proxy sets just one of them. Addresses supplied by untrusted peers
+// are never consulted, and a malformed or obfuscated hop yields no address.
+func ClientIP(req *http.Request, trusted []netip.Prefix, header string) (netip.Addr, bool) {
+	peer, ok := parseHost(req.RemoteAddr)
+	if !ok {
+		return netip.Addr{}, false
+	}
+	if !Contains(trusted, peer) {
+		return peer, true
+	}
+	var chain []string
+	if header == HeaderForwarded {
+		chain = forwardedFor(req.Header.Values(HeaderForwarded))
+	} else {
+		for _, v := range req.Header.Values(HeaderXForwardedFor) {
+			chain = append(chain, strings.Split(v, ",")...)
+		}
+	}
+	client := peer
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr, ok := parseHost(chain[i])
+		if !ok {
+			// Nothing beyond the hop can be trusted, and the hop itself does
+			// not name the client.
+			return netip.Addr{}, false
+		}
+		client = addr
+		if !Contains(trusted, addr) {
+			break
+		}
+	}
+	return client, true
+}
+
+// forwardedFor extracts the for= parameters of RFC 7239 Forwarded headers.
+func forwardedFor(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, elem := range strings.Split(v, ",") {
+			for _, pair := range strings.Split(elem, ";") {
+				k, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(k, "for") {
+					out = append(out, strings.Trim(val, `"`))
+				}
+			}
+		}
+	}
+	return out
+}
+
+// parseHost parses an address with an optional port and IPv6 brackets.
+func parseHost(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	a, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return a.Unmap().WithZone(""), true
+}
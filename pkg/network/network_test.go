@@ -0,0 +1,77 @@
+package network
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParsePrefixes([]string{"10.0.0.0/8", "fd00::/8"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	cases := []struct {
+		name, header, remote, xff, forwarded, want string
+	}{
+		{"untrusted peer ignores headers", "", "203.0.113.9:4000", "198.51.100.1", "", "203.0.113.9"},
+		{"trusted proxy uses nearest untrusted hop", "", "10.0.0.5:4000", "198.51.100.1, 203.0.113.7, 10.1.1.1", "", "203.0.113.7"},
+		{"forwarded header with IPv6", HeaderForwarded, "[fd00::1]:443", "198.51.100.1", `for=192.0.2.60;proto=http, for="[2001:db8:cafe::17]:4711"`, "2001:db8:cafe::17"},
+		{"forwarded header ignored when not configured", HeaderXForwardedFor, "10.0.0.5:4000", "198.51.100.1", `for=203.0.113.7`, "198.51.100.1"},
+		{"x-forwarded-for ignored when not configured", HeaderForwarded, "10.0.0.5:4000", "198.51.100.1", "", "10.0.0.5"},
+		{"obfuscated hop yields no address", HeaderForwarded, "10.0.0.5:4000", "", `for=198.51.100.1, for=_hidden`, ""},
+		{"malformed hop yields no address", "", "10.0.0.5:4000", "198.51.100.1, bogus", "", ""},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = c.remote
+		if c.xff != "" {
+			r.Header.Set("X-Forwarded-For", c.xff)
+		}
+		if c.forwarded != "" {
+			r.Header.Set("Forwarded", c.forwarded)
+		}
+		got, ok := ClientIP(r, trusted, c.header)
+		if c.want == "" {
+			if ok {
+				t.Errorf("%s: got %s, want no address", c.name, got)
+			}
+			continue
+		}
+		if !ok || got.String() != c.want {
+			t.Errorf("%s: got %s, want %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestParseProxyHeader(t *testing.T) {
+	for in, want := range map[string]string{"": HeaderXForwardedFor, "X-Forwarded-For": HeaderXForwardedFor, "forwarded": HeaderForwarded} {
+		if got, err := ParseProxyHeader(in); err != nil || got != want {
+			t.Errorf("ParseProxyHeader(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseProxyHeader("x-real-ip"); err == nil {
+		t.Fatalf("expected unsupported header error")
+	}
+}
+
+func TestContains(t *testing.T) {
+	prefixes, err := ParsePrefixes([]string{"192.168.0.0/16", "2001:db8::/32", "203.0.113.5"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	for addr, want := range map[string]bool{
+		"192.168.4.2":        true,
+		"::ffff:192.168.4.2": true,
+		"2001:db8::1":        true,
+		"203.0.113.5":        true,
+		"203.0.113.6":        false,
+	} {
+		if got := Contains(prefixes, netip.MustParseAddr(addr)); got != want {
+			t.Errorf("Contains(%s) = %v, want %v", addr, got, want)
+		}
+	}
+	if _, err := ParsePrefix("10.0.0.0/33"); err == nil {
+		t.Fatalf("expected invalid CIDR error")
+	}
+}
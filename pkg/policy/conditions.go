@@ -1,18 +1,24 @@
 package policy
 
 import (
+	"net/netip"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/bradtumy/authorization-service/pkg/network"
+	"github.com/bradtumy/authorization-service/pkg/schedule"
 )
 
 // now is a variable for mocking current time in tests.
 var now = time.Now
 
 // evaluateConditions checks whether all policy conditions are satisfied using
-// the provided environment values. It returns false along with the offending
-// condition key when a condition fails.
-func evaluateConditions(policyConds map[string]string, env map[string]string) (bool, string) {
+// the provided environment values and named schedules. It returns false along
+// with the offending condition key when a condition fails.
+func evaluateConditions(policyConds map[string]string, env map[string]string, schedules map[string]*schedule.Schedule) (bool, string) {
 	if len(policyConds) == 0 {
 		return true, ""
 	}
@@ -20,7 +26,7 @@ func evaluateConditions(policyConds map[string]string, env map[string]string) (b
 		var res bool
 		switch key {
 		case "time":
-			res = evaluateTimeCondition(expected, env)
+			res = evaluateTimeCondition(expected, env, schedules)
 		default:
 			if v, ok := env[key]; ok {
 				res = v == expected
@@ -36,46 +42,58 @@ func evaluateConditions(policyConds map[string]string, env map[string]string) (b
 }
 
 // evaluateWhen evaluates a list of boolean expressions against the environment.
-// Supported operators are ==, <, and >. Expressions must reference context
-// values using the form `context.key`. It returns false and the context key if
-// any expression fails.
-func evaluateWhen(exprs []string, env map[string]string) (bool, string) {
+// Supported operators are ==, <, >, contains for list values such as mapped
+// token claims, and `in cidr(...)` or `in zone(...)` for IP addresses, with
+// zones resolved from the named network zones. Expressions
+// must reference context values using the form `context.key`. It returns false
+// and the context key if any expression fails, along with the number of
+// expressions evaluated.
+func evaluateWhen(exprs []string, env map[string]string, zones map[string][]netip.Prefix) (bool, string, int) {
 	if len(exprs) == 0 {
-		return true, ""
+		return true, "", 0
 	}
-	for _, expr := range exprs {
-		if !evaluateExpression(expr, env) {
+	for i, expr := range exprs {
+		if !evaluateExpression(expr, env, zones) {
 			key := extractContextKey(expr)
-			return false, key
+			return false, key, i + 1
 		}
 	}
-	return true, ""
+	return true, "", len(exprs)
 }
 
-// extractContextKey attempts to parse the context key from an expression like
-// `context.key < "value"`.
-func extractContextKey(expr string) string {
-	expr = strings.TrimSpace(expr)
-	var parts []string
-	if strings.Contains(expr, "==") {
-		parts = strings.SplitN(expr, "==", 2)
-	} else if strings.Contains(expr, ">") {
-		parts = strings.SplitN(expr, ">", 2)
-	} else if strings.Contains(expr, "<") {
-		parts = strings.SplitN(expr, "<", 2)
-	} else {
-		return ""
-	}
-	left := strings.TrimSpace(parts[0])
-	if strings.HasPrefix(left, "context.") {
-		return strings.TrimPrefix(left, "context.")
-	}
-	return ""
+// Expression is a parsed `when` clause of the form `context.key <op> value`.
+// For the in operator Value is the function, cidr or zone, and Args holds its
+// arguments. The contains operator tests for Value in a comma-separated list.
+type Expression struct {
+	Key   string
+	Op    string
+	Value string
+	Args  []string
 }
 
-// evaluateExpression parses and evaluates a single expression.
-func evaluateExpression(expr string, env map[string]string) bool {
+var (
+	inRe       = regexp.MustCompile(`^context\.([^\s<>=]+)\s+in\s+(cidr|zone)\((.*)\)$`)
+	containsRe = regexp.MustCompile(`^context\.([^\s<>=]+)\s+contains\s+(\S.*)$`)
+)
+
+// ParseExpression parses a single `when` clause. It returns false when the
+// expression has no supported operator or does not reference a context value.
+func ParseExpression(expr string) (Expression, bool) {
 	expr = strings.TrimSpace(expr)
+	if m := inRe.FindStringSubmatch(expr); m != nil {
+		e := Expression{Key: m[1], Op: "in", Value: m[2]}
+		for _, arg := range strings.Split(m[3], ",") {
+			arg = strings.Trim(strings.TrimSpace(arg), "'\"")
+			if arg == "" {
+				return Expression{}, false
+			}
+			e.Args = append(e.Args, arg)
+		}
+		return e, true
+	}
+	if m := containsRe.FindStringSubmatch(expr); m != nil {
+		return Expression{Key: m[1], Op: "contains", Value: strings.Trim(m[2], "'\"")}, true
+	}
 	var op string
 	var parts []string
 	if strings.Contains(expr, "==") {
@@ -88,31 +106,90 @@ func evaluateExpression(expr string, env map[string]string) bool {
 		op = "<"
 		parts = strings.SplitN(expr, "<", 2)
 	} else {
-		return false
+		return Expression{}, false
 	}
 	if len(parts) != 2 {
-		return false
+		return Expression{}, false
 	}
 	left := strings.TrimSpace(parts[0])
 	right := strings.TrimSpace(parts[1])
 	right = strings.Trim(right, "'\"")
 	if !strings.HasPrefix(left, "context.") {
+		return Expression{}, false
+	}
+	return Expression{Key: strings.TrimPrefix(left, "context."), Op: op, Value: right}, true
+}
+
+// extractContextKey attempts to parse the context key from an expression like
+// `context.key < "value"`.
+func extractContextKey(expr string) string {
+	e, _ := ParseExpression(expr)
+	return e.Key
+}
+
+// evaluateExpression parses and evaluates a single expression.
+func evaluateExpression(expr string, env map[string]string, zones map[string][]netip.Prefix) bool {
+	e, ok := ParseExpression(expr)
+	if !ok {
 		return false
 	}
-	key := strings.TrimPrefix(left, "context.")
-	val, ok := env[key]
+	val, ok := env[e.Key]
 	if !ok {
 		return false
 	}
-	switch op {
+	switch e.Op {
 	case "==":
-		return val == right
+		return val == e.Value
 	case "<", ">":
-		return compareValues(val, right, op)
+		return compareValues(val, e.Value, e.Op)
+	case "in":
+		return inNetwork(val, e, zones)
+	case "contains":
+		for _, item := range strings.Split(val, ",") {
+			if strings.TrimSpace(item) == e.Value {
+				return true
+			}
+		}
 	}
 	return false
 }
 
+// inNetwork reports whether the address val lies in the ranges or zones
+// named by an in expression. Unknown zones and invalid ranges never match.
+func inNetwork(val string, e Expression, zones map[string][]netip.Prefix) bool {
+	addr, err := netip.ParseAddr(val)
+	if err != nil {
+		return false
+	}
+	for _, arg := range e.Args {
+		var prefixes []netip.Prefix
+		if e.Value == "zone" {
+			prefixes = zones[arg]
+		} else if p, err := network.ParsePrefix(arg); err == nil {
+			prefixes = []netip.Prefix{p}
+		}
+		if network.Contains(prefixes, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Levels lists the qualitative values understood by < and >, lowest first.
+var Levels = []string{"low", "medium", "high"}
+
+// LevelRank returns the position of v in Levels, starting at 1, and whether v
+// is a known level.
+func LevelRank(v string) (int, bool) {
+	v = strings.ToLower(v)
+	for i, l := range Levels {
+		if l == v {
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
 // compareValues compares two values using the provided operator. It attempts
 // numeric comparison, then known risk level ordering, and finally falls back to
 // lexical string comparison.
@@ -127,9 +204,8 @@ func compareValues(left, right, op string) bool {
 			}
 		}
 	}
-	order := map[string]int{"low": 1, "medium": 2, "high": 3}
-	if lv, ok := order[strings.ToLower(left)]; ok {
-		if rv, ok := order[strings.ToLower(right)]; ok {
+	if lv, ok := LevelRank(left); ok {
+		if rv, ok := LevelRank(right); ok {
 			switch op {
 			case "<":
 				return lv < rv
@@ -147,25 +223,64 @@ func compareValues(left, right, op string) bool {
 	return false
 }
 
-// evaluateTimeCondition evaluates the "time" condition. The expected value
-// "business-hours" means the time must be between 9:00 and 17:00.
-// The current time is taken from env["time"] in HH:MM format, or time.Now() if
-// not provided.
-func evaluateTimeCondition(expected string, env map[string]string) bool {
-	if expected != "business-hours" {
-		return false
+// inlineSchedules caches schedules written inline in time conditions.
+var inlineSchedules sync.Map
+
+// resolveSchedule returns the named schedule, the default business-hours
+// window, or an inline schedule such as "Mon-Fri 08:00-18:00 America/Chicago".
+func resolveSchedule(expr string, schedules map[string]*schedule.Schedule) (*schedule.Schedule, bool) {
+	if s, ok := schedules[expr]; ok {
+		return s, true
 	}
-	var t time.Time
-	if env != nil {
-		if ts, ok := env["time"]; ok {
-			if parsed, err := time.Parse("15:04", ts); err == nil {
-				t = parsed
-			}
-		}
+	if expr == "business-hours" {
+		return schedule.BusinessHours, true
+	}
+	if s, ok := inlineSchedules.Load(expr); ok {
+		return s.(*schedule.Schedule), true
+	}
+	s, err := schedule.Parse(expr)
+	if err != nil {
+		return nil, false
+	}
+	inlineSchedules.Store(expr, s)
+	return s, true
+}
+
+// evaluationTime returns the instant a schedule is checked at. env["time"] may
+// hold an RFC 3339 timestamp or, for simulations, an HH:MM clock time on the
+// current day in the schedule's timezone. Otherwise the current time is used.
+func evaluationTime(env map[string]string, loc *time.Location) time.Time {
+	t := now()
+	ts, ok := env["time"]
+	if !ok {
+		return t
+	}
+	if parsed, err := time.Parse(time.RFC3339, ts); err == nil {
+		return parsed
 	}
-	if t.IsZero() {
-		t = now()
+	if parsed, err := time.Parse("15:04", ts); err == nil {
+		local := t.In(loc)
+		return time.Date(local.Year(), local.Month(), local.Day(), parsed.Hour(), parsed.Minute(), 0, 0, loc)
+	}
+	return t
+}
+
+// evaluateTimeCondition evaluates the "time" condition: the evaluation time
+// must fall inside the schedule named or written inline by expected.
+func evaluateTimeCondition(expected string, env map[string]string, schedules map[string]*schedule.Schedule) bool {
+	s, ok := resolveSchedule(expected, schedules)
+	if !ok {
+		return false
+	}
+	return s.Contains(evaluationTime(env, s.Location()))
+}
+
+// nextWindow returns when the schedule referenced by a failed time condition
+// next opens.
+func nextWindow(expected string, env map[string]string, schedules map[string]*schedule.Schedule) (time.Time, bool) {
+	s, ok := resolveSchedule(expected, schedules)
+	if !ok {
+		return time.Time{}, false
 	}
-	hour := t.Hour()
-	return hour >= 9 && hour < 17
+	return s.Next(evaluationTime(env, s.Location()))
 }
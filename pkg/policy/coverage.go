@@ -0,0 +1,88 @@
+package policy
+
+import (
+	"sort"
+	"sync"
+)
+
+// Coverage records which policies and `when` expressions were exercised by
+// evaluations. A policy is exercised when it matched the resource and action of
+// a request; an expression is exercised when it was evaluated.
+type Coverage struct {
+	mu       sync.Mutex
+	policies map[string]int
+	when     map[string]int // policy ID -> highest number of expressions evaluated
+}
+
+// NewCoverage creates an empty coverage recorder.
+func NewCoverage() *Coverage {
+	return &Coverage{policies: make(map[string]int), when: make(map[string]int)}
+}
+
+// SetCoverage attaches a coverage recorder to the engine. Pass nil to disable.
+func (pe *PolicyEngine) SetCoverage(c *Coverage) {
+	pe.coverage = c
+}
+
+func (c *Coverage) hitPolicy(id string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.policies[id]++
+	c.mu.Unlock()
+}
+
+func (c *Coverage) hitWhen(id string, evaluated int) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	if evaluated > c.when[id] {
+		c.when[id] = evaluated
+	}
+	c.mu.Unlock()
+}
+
+// UncoveredWhen identifies a `when` expression that was never evaluated.
+type UncoveredWhen struct {
+	PolicyID   string `json:"policy_id"`
+	Index      int    `json:"index"`
+	Expression string `json:"expression"`
+}
+
+// CoverageReport lists the policies and expressions of a store never exercised.
+type CoverageReport struct {
+	Policies        int             `json:"policies"`
+	Covered         int             `json:"covered"`
+	UncoveredPolicy []string        `json:"uncovered_policies"`
+	UncoveredWhen   []UncoveredWhen `json:"uncovered_when"`
+}
+
+// Report compares the recorded hits with the policies in store.
+func (c *Coverage) Report(store *PolicyStore) CoverageReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	rep := CoverageReport{UncoveredPolicy: []string{}, UncoveredWhen: []UncoveredWhen{}}
+	ids := make([]string, 0, len(store.Policies))
+	for id := range store.Policies {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		rep.Policies++
+		if c.policies[id] > 0 {
+			rep.Covered++
+		} else {
+			rep.UncoveredPolicy = append(rep.UncoveredPolicy, id)
+		}
+		for i, expr := range store.Policies[id].When {
+			if i >= c.when[id] {
+				rep.UncoveredWhen = append(rep.UncoveredWhen, UncoveredWhen{PolicyID: id, Index: i, Expression: expr})
+			}
+		}
+	}
+	return rep
+}
@@ -1,12 +1,104 @@
 package policy
 
+import (
+	"net/netip"
+
+	"github.com/bradtumy/authorization-service/pkg/remediation"
+)
+
 // Decision represents the outcome of a policy evaluation.
 type Decision struct {
-        Allow       bool              `json:"allow"`
-        PolicyID    string            `json:"policy_id,omitempty"`
-        Reason      string            `json:"reason"`
-        Context     map[string]string `json:"context,omitempty"`
-        Delegator   string            `json:"delegator,omitempty"`
-        Remediation []string          `json:"remediation,omitempty"`
-       Commit      string            `json:"commit,omitempty"`
+	Allow       bool              `json:"allow"`
+	PolicyID    string            `json:"policy_id,omitempty"`
+	Reason      string            `json:"reason"`
+	Context     map[string]string `json:"context,omitempty"`
+	Delegator   string            `json:"delegator,omitempty"`
+	Remediation []string          `json:"remediation,omitempty"`
+	// Obligations must be carried out by the enforcement point, for example a
+	// step-up authentication, before it acts on the decision.
+	Obligations []Obligation `json:"obligations,omitempty"`
+	// Advice holds actions the enforcement point may carry out or ignore.
+	Advice []Obligation `json:"advice,omitempty"`
+	Commit string       `json:"commit,omitempty"`
+	// ContextErrors maps context providers that failed to their error.
+	ContextErrors map[string]string `json:"context_errors,omitempty"`
+}
+
+// Obligation is a structured action returned with a decision: a code
+// enforcement points act on, such as step_up, its parameters and optional
+// messages keyed by locale.
+type Obligation struct {
+	Code     string            `yaml:"code" json:"code"`
+	Params   map[string]string `yaml:"params" json:"params,omitempty"`
+	Messages map[string]string `yaml:"messages" json:"messages,omitempty"`
+	// On limits the obligation to decisions of the policy with this outcome,
+	// allow or deny. It applies to both when empty.
+	On string `yaml:"on" json:"-"`
+}
+
+// Message returns the message of the obligation in locale, falling back to
+// the default locale, any message and finally the code.
+func (o Obligation) Message(locale string) string {
+	return remediation.Action{Code: o.Code, Params: o.Params, Messages: o.Messages}.Message(locale)
+}
+
+// applicable returns the obligations that apply to a decision with the given
+// outcome.
+func applicable(obligations []Obligation, allow bool) []Obligation {
+	outcome := "deny"
+	if allow {
+		outcome = "allow"
+	}
+	var out []Obligation
+	for _, o := range obligations {
+		if o.On == "" || o.On == outcome {
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
+// withRemediation adds the obligations and advice of the deciding policy, if
+// any, to dec. Denials also receive the actions of the matching remediation
+// rules or, when there are none, the advice derived from their context, unless
+// an action with the same code is already present, and the messages of all
+// actions as remediation strings.
+func withRemediation(dec Decision, p Policy, d denial, rules []RemediationRule, zones map[string][]netip.Prefix) Decision {
+	dec.Obligations = applicable(p.Obligations, dec.Allow)
+	dec.Advice = applicable(p.Advice, dec.Allow)
+	if dec.Allow {
+		return dec
+	}
+	codes := map[string]bool{}
+	for _, o := range append(append([]Obligation{}, dec.Obligations...), dec.Advice...) {
+		codes[o.Code] = true
+	}
+	add := func(list *[]Obligation, o Obligation) {
+		if !codes[o.Code] {
+			*list = append(*list, o)
+			codes[o.Code] = true
+		}
+	}
+	if len(rules) > 0 {
+		data := TemplateData{Context: dec.Context, Policy: d.policy, Reason: dec.Reason}
+		for _, r := range rules {
+			if !r.matches(dec, d, zones) {
+				continue
+			}
+			for _, o := range r.Obligations {
+				add(&dec.Obligations, r.render(o, data))
+			}
+			for _, o := range r.Advice {
+				add(&dec.Advice, r.render(o, data))
+			}
+		}
+	} else {
+		for _, a := range remediation.Advise(dec.Context) {
+			add(&dec.Advice, Obligation{Code: a.Code, Params: a.Params, Messages: a.Messages})
+		}
+	}
+	for _, o := range append(append([]Obligation{}, dec.Obligations...), dec.Advice...) {
+		dec.Remediation = append(dec.Remediation, o.Message(remediation.DefaultLocale))
+	}
+	return dec
 }
@@ -1,5 +1,7 @@
 package policy
 
+import "sort"
+
 // Role represents a user role.
 type Role struct {
 	Name     string   `yaml:"name"`
@@ -26,4 +28,33 @@ type Policy struct {
 	Effect      string            `yaml:"effect"`
 	Conditions  map[string]string `yaml:"conditions"`
 	When        []string          `yaml:"when"`
+	Obligations []Obligation      `yaml:"obligations"`
+	Advice      []Obligation      `yaml:"advice"`
+}
+
+// ContextKeys returns the context keys the policy's conditions and when
+// clauses read, in order of appearance.
+func (p Policy) ContextKeys() []string {
+	seen := map[string]bool{}
+	var keys []string
+	add := func(k string) {
+		if k != "" && !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	conds := make([]string, 0, len(p.Conditions))
+	for k := range p.Conditions {
+		conds = append(conds, k)
+	}
+	sort.Strings(conds)
+	for _, k := range conds {
+		add(k)
+	}
+	for _, expr := range p.When {
+		if e, ok := ParseExpression(expr); ok {
+			add(e.Key)
+		}
+	}
+	return keys
 }
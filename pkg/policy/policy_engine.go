@@ -2,9 +2,9 @@ package policy
 
 import (
 	"strings"
+	"time"
 
 	"github.com/bradtumy/authorization-service/pkg/graph"
-	"github.com/bradtumy/authorization-service/pkg/remediation"
 	authuser "github.com/bradtumy/authorization-service/pkg/user"
 )
 
@@ -15,8 +15,9 @@ import (
 // Evaluation stops at the first matching policy and returns a structured
 // decision describing the result.
 type PolicyEngine struct {
-	store *PolicyStore
-	graph *graph.Graph
+	store    *PolicyStore
+	graph    *graph.Graph
+	coverage *Coverage
 }
 
 // NewPolicyEngine creates a new PolicyEngine instance.
@@ -26,8 +27,10 @@ func NewPolicyEngine(store *PolicyStore, g *graph.Graph) *PolicyEngine {
 
 // Evaluate determines whether the given subject is allowed to perform the
 // specified action on the resource. It returns a Decision describing the
-// outcome and does not log sensitive data.
+// outcome and does not log sensitive data. The whole evaluation uses the
+// policy set active when it starts, even if a reload happens meanwhile.
 func (pe *PolicyEngine) Evaluate(subject, resource, action string, env map[string]string) Decision {
+	snap := pe.store.view()
 	ctx := map[string]string{
 		"subject":  subject,
 		"resource": resource,
@@ -37,10 +40,9 @@ func (pe *PolicyEngine) Evaluate(subject, resource, action string, env map[strin
 		ctx[k] = v
 	}
 
-	addRemediation := func(dec Decision) Decision {
-		if !dec.Allow {
-			dec.Remediation = remediation.Suggest(dec.Context)
-		}
+	addRemediation := func(dec Decision, p Policy, d denial) Decision {
+		dec = withRemediation(dec, p, d, snap.rules, snap.zones)
+		dec.Commit = snap.rev.Commit
 		return dec
 	}
 
@@ -67,22 +69,32 @@ func (pe *PolicyEngine) Evaluate(subject, resource, action string, env map[strin
 
 	tenantID := env["tenantID"]
 	for idx, subj := range subjects {
-		user, exists := pe.store.Users[subj]
+		user, exists := snap.users[subj]
 		if !exists && tenantID != "" {
 			if u, err := authuser.Get(tenantID, subj); err == nil {
 				user = User{Username: u.Username, Roles: u.Roles}
 				exists = true
 			}
 		}
+		// Roles and groups mapped from the caller's token belong to the
+		// requested subject only, not to delegators.
+		var dynamic []string
+		if idx == 0 {
+			dynamic = DynamicRoles(env)
+		}
+		if !exists && len(dynamic) > 0 {
+			user = User{Username: subj}
+			exists = true
+		}
 		if !exists {
 			if idx == 0 {
-				return addRemediation(Decision{Allow: false, Reason: "user not found", Context: ctx})
+				return addRemediation(Decision{Allow: false, Reason: "user not found", Context: ctx}, Policy{}, denial{})
 			}
 			continue
 		}
 
 		// Gather roles from user definition and graph-based group memberships.
-		roles := append([]string{}, user.Roles...)
+		roles := append(append([]string{}, user.Roles...), dynamic...)
 		if pe.graph != nil {
 			for _, target := range pe.graph.Targets("user:" + subj) {
 				if strings.HasPrefix(target, "group:") {
@@ -91,73 +103,118 @@ func (pe *PolicyEngine) Evaluate(subject, resource, action string, env map[strin
 			}
 		}
 
-		for _, roleName := range roles {
-			role, exists := pe.store.Roles[roleName]
+		policy, ok := pe.match(snap, roles, resource, action)
+		if !ok {
+			continue
+		}
+		pe.coverage.hitPolicy(policy.ID)
+		if ok, reason := evaluateConditions(policy.Conditions, env, snap.schedules); !ok {
+			if reason == "time" {
+				if next, ok := nextWindow(policy.Conditions["time"], env, snap.schedules); ok {
+					ctx["next_window"] = next.Format(time.RFC3339)
+				}
+			}
+			dec := Decision{Allow: false, PolicyID: policy.ID, Reason: reason, Context: ctx}
+			if subj != subject {
+				dec.Delegator = subj
+			}
+			return addRemediation(dec, policy, denial{policy: policy.ID, condition: reason})
+		}
+		ok, reason, evaluated := evaluateWhen(policy.When, env, snap.zones)
+		pe.coverage.hitWhen(policy.ID, evaluated)
+		if !ok {
+			dec := Decision{Allow: false, PolicyID: policy.ID, Reason: reason, Context: ctx}
+			if subj != subject {
+				dec.Delegator = subj
+			}
+			return addRemediation(dec, policy, denial{policy: policy.ID, when: policy.When[evaluated-1]})
+		}
+		dec := Decision{PolicyID: policy.ID, Context: ctx}
+		if subj != subject {
+			dec.Delegator = subj
+		}
+		switch policy.Effect {
+		case "allow":
+			dec.Allow = true
+			dec.Reason = "allowed by policy"
+		case "deny":
+			dec.Allow = false
+			dec.Reason = "denied by policy"
+		}
+		return addRemediation(dec, policy, denial{policy: policy.ID})
+	}
+
+	return addRemediation(Decision{Allow: false, Reason: "no matching policy", Context: ctx}, Policy{}, denial{})
+}
+
+// Context keys holding roles and groups of the subject, as comma-separated
+// lists, typically mapped from token claims.
+const (
+	RolesKey  = "subject.roles"
+	GroupsKey = "subject.groups"
+)
+
+// DynamicRoles returns the roles and groups listed in env under RolesKey and
+// GroupsKey. They are held in addition to the subject's configured roles.
+func DynamicRoles(env map[string]string) []string {
+	var roles []string
+	for _, key := range []string{RolesKey, GroupsKey} {
+		for _, r := range strings.Split(env[key], ",") {
+			if r = strings.TrimSpace(r); r != "" {
+				roles = append(roles, r)
+			}
+		}
+	}
+	return roles
+}
+
+// Match returns the first policy whose resource and action match for a holder
+// of roles, in the order Evaluate considers them. Conditions and when clauses
+// are not evaluated; a matched policy decides the request either way.
+func (pe *PolicyEngine) Match(roles []string, resource, action string) (Policy, bool) {
+	return pe.match(pe.store.view(), roles, resource, action)
+}
+
+func (pe *PolicyEngine) match(snap snapshot, roles []string, resource, action string) (Policy, bool) {
+	for _, roleName := range roles {
+		role, exists := snap.roles[roleName]
+		if !exists {
+			continue
+		}
+
+		for _, policyID := range role.Policies {
+			policy, exists := snap.policies[policyID]
 			if !exists {
 				continue
 			}
-
-			for _, policyID := range role.Policies {
-				policy, exists := pe.store.Policies[policyID]
-				if !exists {
-					continue
-				}
-				// Ensure the policy applies to the current role
-				if len(policy.Subjects) > 0 {
-					allowed := false
-					for _, subjRole := range policy.Subjects {
-						if subjRole.Role == roleName {
-							allowed = true
-							break
-						}
-					}
-					if !allowed {
-						continue
+			// Ensure the policy applies to the current role
+			if len(policy.Subjects) > 0 {
+				allowed := false
+				for _, subjRole := range policy.Subjects {
+					if subjRole.Role == roleName {
+						allowed = true
+						break
 					}
 				}
+				if !allowed {
+					continue
+				}
+			}
 
-				for _, polResource := range policy.Resource {
-					matchResource := polResource == "*" || polResource == resource
-					if !matchResource && pe.graph != nil {
-						if pe.graph.HasPath("group:"+polResource, "resource:"+resource) {
-							matchResource = true
-						}
+			for _, polResource := range policy.Resource {
+				matchResource := polResource == "*" || polResource == resource
+				if !matchResource && pe.graph != nil {
+					if pe.graph.HasPath("group:"+polResource, "resource:"+resource) {
+						matchResource = true
 					}
-					for _, polAction := range policy.Action {
-						if matchResource && (polAction == "*" || polAction == action) {
-							if ok, reason := evaluateConditions(policy.Conditions, env); !ok {
-								dec := Decision{Allow: false, PolicyID: policy.ID, Reason: reason, Context: ctx}
-								if subj != subject {
-									dec.Delegator = subj
-								}
-								return addRemediation(dec)
-							}
-							if ok, reason := evaluateWhen(policy.When, env); !ok {
-								dec := Decision{Allow: false, PolicyID: policy.ID, Reason: reason, Context: ctx}
-								if subj != subject {
-									dec.Delegator = subj
-								}
-								return addRemediation(dec)
-							}
-							dec := Decision{PolicyID: policy.ID, Context: ctx}
-							if subj != subject {
-								dec.Delegator = subj
-							}
-							switch policy.Effect {
-							case "allow":
-								dec.Allow = true
-								dec.Reason = "allowed by policy"
-							case "deny":
-								dec.Allow = false
-								dec.Reason = "denied by policy"
-							}
-							return addRemediation(dec)
-						}
+				}
+				for _, polAction := range policy.Action {
+					if matchResource && (polAction == "*" || polAction == action) {
+						return policy, true
 					}
 				}
 			}
 		}
 	}
-
-	return addRemediation(Decision{Allow: false, Reason: "no matching policy", Context: ctx})
+	return Policy{}, false
 }
@@ -1,7 +1,9 @@
 package policy
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/bradtumy/authorization-service/pkg/graph"
 )
@@ -132,7 +134,11 @@ func TestEvaluateConditionUnsatisfied(t *testing.T) {
 	if decision.Reason != "time" {
 		t.Fatalf("unexpected reason: %s", decision.Reason)
 	}
-	if len(decision.Remediation) == 0 || decision.Remediation[0] != "Try again during working hours" {
+	next, err := time.Parse(time.RFC3339, decision.Context["next_window"])
+	if err != nil || next.In(time.Local).Hour() != 9 {
+		t.Fatalf("expected the next window to open at 09:00, got %q", decision.Context["next_window"])
+	}
+	if len(decision.Remediation) == 0 || !strings.HasPrefix(decision.Remediation[0], "Try again after ") {
 		t.Fatalf("expected remediation for business hours, got %v", decision.Remediation)
 	}
 }
@@ -284,3 +290,250 @@ func TestEvaluateDelegationChainInvalid(t *testing.T) {
 		t.Fatalf("unexpected delegator %q for failed delegation", dec.Delegator)
 	}
 }
+
+func TestEvaluateNamedSchedule(t *testing.T) {
+	store := NewPolicyStore()
+	err := store.LoadPolicyData([]byte(`roles:
+  - name: "oncall"
+    policies: ["p1"]
+users:
+  - username: "user1"
+    roles: ["oncall"]
+policies:
+  - id: "p1"
+    resource: ["*"]
+    action: ["read"]
+    effect: "allow"
+    conditions:
+      time: "support"
+schedules:
+  support:
+    days: Mon-Fri
+    hours: "08:00-18:00"
+    timezone: America/Chicago
+    holidays: [us]
+calendars:
+  us: ["2025-01-06"]
+`))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	engine := NewPolicyEngine(store, nil)
+	// Tuesday 09:00 in Chicago.
+	if dec := engine.Evaluate("user1", "file1", "read", map[string]string{"time": "2025-01-07T15:00:00Z"}); !dec.Allow {
+		t.Fatalf("expected access inside the schedule, got %#v", dec)
+	}
+	// The Monday holiday defers the window to Tuesday 08:00 in Chicago.
+	dec := engine.Evaluate("user1", "file1", "read", map[string]string{"time": "2025-01-06T15:00:00Z"})
+	if dec.Allow || dec.Reason != "time" {
+		t.Fatalf("expected a time denial on the holiday, got %#v", dec)
+	}
+	if dec.Context["next_window"] != "2025-01-07T08:00:00-06:00" {
+		t.Fatalf("unexpected next window %q", dec.Context["next_window"])
+	}
+}
+
+func TestEvaluateNetworkZone(t *testing.T) {
+	store := NewPolicyStore()
+	err := store.LoadPolicyData([]byte(`roles:
+  - name: "admin"
+    policies: ["p1"]
+users:
+  - username: "user1"
+    roles: ["admin"]
+policies:
+  - id: "p1"
+    resource: ["console"]
+    action: ["manage"]
+    effect: "allow"
+    when:
+      - context.ip in zone("corp", "vpn")
+      - context.ip in cidr("10.0.0.0/8", "2001:db8::/32", "192.0.2.7")
+zones:
+  corp: ["10.1.0.0/16", "2001:db8:1::/48"]
+  vpn: ["192.0.2.7"]
+`))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	engine := NewPolicyEngine(store, nil)
+	for ip, want := range map[string]bool{
+		"10.1.2.3":        true,
+		"::ffff:10.1.2.3": true,
+		"2001:db8:1::5":   true,
+		"192.0.2.7":       true,
+		"10.2.0.1":        false,
+		"2001:db8:2::5":   false,
+		"198.51.100.1":    false,
+		"not-an-address":  false,
+	} {
+		dec := engine.Evaluate("user1", "console", "manage", map[string]string{"ip": ip})
+		if dec.Allow != want {
+			t.Errorf("ip %s: expected allow=%v, got %#v", ip, want, dec)
+		}
+		if !want && dec.Reason != "ip" {
+			t.Errorf("ip %s: unexpected reason %q", ip, dec.Reason)
+		}
+	}
+}
+
+func TestEvaluateClaimRoles(t *testing.T) {
+	store := NewPolicyStore()
+	store.Roles["finance"] = Role{Name: "finance", Policies: []string{"approve"}}
+	store.Policies["approve"] = Policy{
+		ID:       "approve",
+		Resource: []string{"payments"},
+		Action:   []string{"approve"},
+		Effect:   "allow",
+		When:     []string{`context.auth.methods contains "mfa"`},
+	}
+	engine := NewPolicyEngine(store, graph.New())
+
+	// A subject without a user record holds the groups mapped from its token.
+	env := map[string]string{GroupsKey: "staff, finance", "auth.methods": "pwd,mfa"}
+	if dec := engine.Evaluate("carol", "payments", "approve", env); !dec.Allow {
+		t.Fatalf("expected group from claims to grant access, got %+v", dec)
+	}
+	env["auth.methods"] = "pwd"
+	dec := engine.Evaluate("carol", "payments", "approve", env)
+	if dec.Allow || dec.Reason != "auth.methods" {
+		t.Fatalf("expected missing mfa to deny, got %+v", dec)
+	}
+	if len(dec.Remediation) != 1 || dec.Remediation[0] != "Require MFA step-up" {
+		t.Fatalf("expected step-up remediation, got %v", dec.Remediation)
+	}
+	if dec := engine.Evaluate("carol", "payments", "approve", nil); dec.Allow || dec.Reason != "user not found" {
+		t.Fatalf("expected unknown subject without claims to be denied, got %+v", dec)
+	}
+}
+
+func TestEvaluateObligations(t *testing.T) {
+	store := NewPolicyStore()
+	store.Roles["admin"] = Role{Name: "admin", Policies: []string{"policy1"}}
+	store.Users["user1"] = User{Username: "user1", Roles: []string{"admin"}}
+	store.Policies["policy1"] = Policy{
+		ID:       "policy1",
+		Resource: []string{"file1"},
+		Action:   []string{"read"},
+		Effect:   "allow",
+		When:     []string{"context.auth.level == mfa"},
+		Obligations: []Obligation{{
+			Code:     "step_up",
+			On:       "deny",
+			Params:   map[string]string{"required_acr": "mfa", "max_age": "300"},
+			Messages: map[string]string{"en": "Sign in with MFA", "de": "Mit MFA anmelden"},
+		}},
+		Advice: []Obligation{{Code: "audit", On: "allow"}},
+	}
+
+	engine := NewPolicyEngine(store, graph.New())
+	dec := engine.Evaluate("user1", "file1", "read", map[string]string{"auth.level": "pwd", "auth.methods": "pwd"})
+	if dec.Allow || len(dec.Obligations) != 1 || dec.Obligations[0].Params["max_age"] != "300" {
+		t.Fatalf("expected a step-up obligation, got %+v", dec)
+	}
+	if len(dec.Advice) != 0 || len(dec.Remediation) != 1 || dec.Remediation[0] != "Sign in with MFA" {
+		t.Fatalf("expected the policy's step-up to replace the suggested one, got %+v %v", dec.Advice, dec.Remediation)
+	}
+
+	dec = engine.Evaluate("user1", "file1", "read", map[string]string{"auth.level": "mfa"})
+	if !dec.Allow || len(dec.Obligations) != 0 || len(dec.Advice) != 1 || dec.Advice[0].Code != "audit" || dec.Remediation != nil {
+		t.Fatalf("expected only allow advice, got %+v", dec)
+	}
+
+	dec = engine.Evaluate("user1", "file2", "read", map[string]string{"auth.methods": "pwd"})
+	if len(dec.Advice) != 1 || dec.Advice[0].Code != "step_up" || dec.Advice[0].Params["required_acr"] != "mfa" {
+		t.Fatalf("expected suggested step-up advice, got %+v", dec)
+	}
+}
+
+func TestEvaluateRemediationRules(t *testing.T) {
+	base := `roles:
+  - name: "analyst"
+    policies: ["read-secrets", "reports"]
+users:
+  - username: "alice"
+    roles: ["analyst"]
+policies:
+  - id: "read-secrets"
+    resource: ["secret"]
+    action: ["read"]
+    effect: "allow"
+    when:
+      - context.auth.level == mfa
+  - id: "reports"
+    resource: ["report"]
+    action: ["read"]
+    effect: "allow"
+    conditions:
+      time: "Mon-Fri 09:00-17:00 UTC"
+`
+	rules := `remediation:
+  - id: "step-up"
+    when: ["context.auth.level  ==  mfa"]
+    if: ["context.risk_score > 70"]
+    obligations:
+      - code: step_up
+        params:
+          required_acr: mfa
+          max_age: "{{if eq (index .Context \"risk_score\") \"99\"}}0{{else}}300{{end}}"
+        messages:
+          en: "Sign in with MFA to read {{index .Context \"resource\"}} (max age {{.Params.max_age}}s)"
+  - id: "after-hours"
+    policies: ["reports"]
+    conditions: ["time"]
+    advice:
+      - code: retry_after
+        params:
+          not_before: "{{index .Context \"next_window\"}}"
+        messages:
+          en: "{{.Policy}} opens at {{.Params.not_before}}"
+`
+	store := NewPolicyStore()
+	if err := store.LoadPolicyData([]byte(base + rules)); err != nil {
+		t.Fatalf("load policies: %v", err)
+	}
+	engine := NewPolicyEngine(store, graph.New())
+	// Templates are parsed once, when the rules are loaded.
+	if n := len(store.Remediation[0].templates); n != 2 {
+		t.Fatalf("expected the step-up templates to be compiled, got %d", n)
+	}
+	broken := strings.Replace(rules, "{{.Policy}} opens", "{{.Policy opens", 1)
+	if err := NewPolicyStore().LoadPolicyData([]byte(base + broken)); err == nil {
+		t.Fatal("expected an invalid template to be rejected at load")
+	}
+
+	dec := engine.Evaluate("alice", "secret", "read", map[string]string{"auth.methods": "pwd", "risk_score": "80"})
+	if len(dec.Obligations) != 1 || dec.Obligations[0].Params["max_age"] != "300" || len(dec.Advice) != 0 {
+		t.Fatalf("expected the step-up rule to apply alone, got %+v", dec)
+	}
+	if len(dec.Remediation) != 1 || dec.Remediation[0] != "Sign in with MFA to read secret (max age 300s)" {
+		t.Fatalf("expected a rendered message, got %v", dec.Remediation)
+	}
+	// Rules replace the built-in heuristics: a low risk gets no step-up.
+	if dec := engine.Evaluate("alice", "secret", "read", map[string]string{"auth.methods": "pwd", "risk_score": "20"}); len(dec.Obligations)+len(dec.Advice) != 0 {
+		t.Fatalf("expected no remediation below the threshold, got %+v", dec)
+	}
+
+	dec = engine.Evaluate("alice", "report", "read", map[string]string{"time": "2025-01-04T10:00:00Z"})
+	if len(dec.Advice) != 1 || dec.Advice[0].Params["not_before"] != "2025-01-06T09:00:00Z" {
+		t.Fatalf("expected retry advice, got %+v", dec)
+	}
+	if dec.Remediation[0] != "reports opens at 2025-01-06T09:00:00Z" {
+		t.Fatalf("expected a rendered message, got %v", dec.Remediation)
+	}
+
+	// Rules are reloaded and rolled back with the policies.
+	if err := store.LoadPolicyData([]byte(base)); err != nil {
+		t.Fatalf("reload policies: %v", err)
+	}
+	dec = engine.Evaluate("alice", "secret", "read", map[string]string{"auth.methods": "pwd", "risk_score": "20"})
+	if len(dec.Advice) != 1 || dec.Advice[0].Code != "step_up" {
+		t.Fatalf("expected the built-in advice without rules, got %+v", dec)
+	}
+	if err := store.Rollback(1); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	if dec := engine.Evaluate("alice", "secret", "read", map[string]string{"auth.methods": "pwd", "risk_score": "80"}); len(dec.Obligations) != 1 {
+		t.Fatalf("expected the rules to be restored, got %+v", dec)
+	}
+}
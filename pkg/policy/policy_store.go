@@ -1,11 +1,15 @@
 package policy
 
 import (
+	"fmt"
 	"io/ioutil"
+	"net/netip"
 	"sync"
 
 	"gopkg.in/yaml.v2"
 
+	"github.com/bradtumy/authorization-service/pkg/network"
+	"github.com/bradtumy/authorization-service/pkg/schedule"
 	"github.com/bradtumy/authorization-service/pkg/validator"
 )
 
@@ -14,15 +18,27 @@ type PolicyStore struct {
 	Policies map[string]Policy
 	Roles    map[string]Role
 	Users    map[string]User
-	mu       sync.RWMutex
+	// Schedules holds the named time windows usable in time conditions.
+	Schedules map[string]*schedule.Schedule
+	// Zones holds the named network zones usable in `in zone(...)` expressions.
+	Zones map[string][]netip.Prefix
+	// Remediation holds the rules mapping denials to remediation actions.
+	Remediation []RemediationRule
+
+	history []snapshot
+	active  int
+	pinned  int
+	mu      sync.RWMutex
 }
 
 // NewPolicyStore creates a new PolicyStore instance.
 func NewPolicyStore() *PolicyStore {
 	return &PolicyStore{
-		Policies: make(map[string]Policy),
-		Roles:    make(map[string]Role),
-		Users:    make(map[string]User),
+		Policies:  make(map[string]Policy),
+		Roles:     make(map[string]Role),
+		Users:     make(map[string]User),
+		Schedules: make(map[string]*schedule.Schedule),
+		Zones:     make(map[string][]netip.Prefix),
 	}
 }
 
@@ -33,19 +49,43 @@ func (ps *PolicyStore) LoadPolicies(filePath string) error {
 	if err != nil {
 		return err
 	}
+	return ps.LoadRevision(data, "file:"+filePath, "")
+}
+
+// LoadPolicyData loads policies, roles, and users from raw YAML data. The data
+// is validated before being swapped into the store.
+func (ps *PolicyStore) LoadPolicyData(data []byte) error {
+	return ps.LoadRevision(data, "data", "")
+}
 
-	if err = validator.ValidatePolicyData(data); err != nil {
+// LoadRevision loads raw YAML data and records it as a new revision described
+// by source and, for version controlled sources, commit.
+func (ps *PolicyStore) LoadRevision(data []byte, source, commit string) error {
+	set, err := ParsePolicySet(data)
+	if err != nil {
 		return err
 	}
+	ps.LoadPolicySet(set, source, commit)
+	return nil
+}
+
+// PolicySet is a validated policy file ready to be loaded into a store.
+type PolicySet struct {
+	snap snapshot
+}
 
-	var config struct {
-		Roles    []Role   `yaml:"roles"`
-		Users    []User   `yaml:"users"`
-		Policies []Policy `yaml:"policies"`
+// ParsePolicySet validates and compiles raw YAML policy data without loading
+// it, so that several files can be checked before any of them is swapped in.
+func ParsePolicySet(data []byte) (*PolicySet, error) {
+	err := validator.ValidatePolicyData(data)
+	if err != nil {
+		return nil, err
 	}
 
+	var config policyFile
+
 	if err = yaml.UnmarshalStrict(data, &config); err != nil {
-		return err
+		return nil, err
 	}
 
 	newRoles := make(map[string]Role)
@@ -61,14 +101,41 @@ func (ps *PolicyStore) LoadPolicies(filePath string) error {
 	for _, policy := range config.Policies {
 		newPolicies[policy.ID] = policy
 	}
+	newSchedules := make(map[string]*schedule.Schedule)
+	for name, spec := range config.Schedules {
+		s, err := spec.Compile(config.Calendars)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %s: %w", name, err)
+		}
+		newSchedules[name] = s
+	}
+	newZones := make(map[string][]netip.Prefix)
+	for name, list := range config.Zones {
+		prefixes, err := network.ParsePrefixes(list)
+		if err != nil {
+			return nil, fmt.Errorf("zone %s: %w", name, err)
+		}
+		newZones[name] = prefixes
+	}
+	for i := range config.Remediation {
+		if err := config.Remediation[i].compile(); err != nil {
+			name := config.Remediation[i].ID
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+			return nil, fmt.Errorf("remediation rule %s: %w", name, err)
+		}
+	}
 
+	return &PolicySet{snap: snapshot{roles: newRoles, users: newUsers, policies: newPolicies, schedules: newSchedules, zones: newZones, rules: config.Remediation}}, nil
+}
+
+// LoadPolicySet records a parsed policy set as a new revision described by
+// source and commit.
+func (ps *PolicyStore) LoadPolicySet(set *PolicySet, source, commit string) {
 	ps.mu.Lock()
-	ps.Roles = newRoles
-	ps.Users = newUsers
-	ps.Policies = newPolicies
+	ps.record(set.snap, source, commit)
 	ps.mu.Unlock()
-
-	return nil
 }
 
 // ReplacePolicies swaps the current policies with the provided list. Roles and
@@ -80,7 +147,7 @@ func (ps *PolicyStore) ReplacePolicies(policies []Policy) {
 		newPolicies[p.ID] = p
 	}
 	ps.mu.Lock()
-	ps.Policies = newPolicies
+	ps.record(snapshot{roles: ps.Roles, users: ps.Users, policies: newPolicies, schedules: ps.Schedules, zones: ps.Zones, rules: ps.Remediation}, "db", "")
 	ps.mu.Unlock()
 }
 
@@ -0,0 +1,140 @@
+package policy
+
+import (
+	"net/netip"
+	"strings"
+	"text/template"
+)
+
+// RemediationRule maps the cause of a denial to remediation actions. Every
+// criterion that is set must hold; a rule without criteria applies to every
+// denial.
+type RemediationRule struct {
+	ID string `yaml:"id"`
+	// Policies lists the IDs of the deciding policies the rule applies to.
+	Policies []string `yaml:"policies"`
+	// Conditions lists condition keys, such as time, whose failure the rule
+	// applies to.
+	Conditions []string `yaml:"conditions"`
+	// When lists the `when` expressions whose failure the rule applies to.
+	When []string `yaml:"when"`
+	// If lists `when` expressions over the decision context that must hold.
+	If []string `yaml:"if"`
+	// Obligations and Advice are returned with matching denials. Their params
+	// and messages are text/template templates over TemplateData.
+	Obligations []Obligation `yaml:"obligations"`
+	Advice      []Obligation `yaml:"advice"`
+
+	// templates holds the parsed params and messages of Obligations and
+	// Advice, keyed by their text. It is set by compile.
+	templates map[string]*template.Template
+}
+
+// TemplateData is the data the params and messages of remediation rules are
+// rendered with, e.g. {{.Policy}} or {{index .Context "next_window"}}. Context
+// is the decision context, which includes the conditions the caller supplied.
+type TemplateData struct {
+	Context map[string]string
+	Policy  string
+	Reason  string
+	// Params holds the rendered params of the action, for use in messages.
+	Params map[string]string
+}
+
+// denial records why a policy denied a request.
+type denial struct {
+	policy    string
+	condition string
+	when      string
+}
+
+func (r RemediationRule) matches(dec Decision, d denial, zones map[string][]netip.Prefix) bool {
+	if len(r.Policies) > 0 && !containsString(r.Policies, d.policy) {
+		return false
+	}
+	if len(r.Conditions) > 0 && (d.condition == "" || !containsString(r.Conditions, d.condition)) {
+		return false
+	}
+	if len(r.When) > 0 {
+		found := false
+		for _, w := range r.When {
+			if d.when != "" && normalizeExpression(w) == normalizeExpression(d.when) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	ok, _, _ := evaluateWhen(r.If, dec.Context, zones)
+	return ok
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeExpression collapses whitespace so that expressions match
+// regardless of spacing.
+func normalizeExpression(expr string) string {
+	return strings.Join(strings.Fields(expr), " ")
+}
+
+// compile parses the params and messages of the rule's obligations and
+// advice, so that denials render them without parsing.
+func (r *RemediationRule) compile() error {
+	r.templates = make(map[string]*template.Template)
+	for _, o := range append(append([]Obligation{}, r.Obligations...), r.Advice...) {
+		for _, m := range []map[string]string{o.Params, o.Messages} {
+			for _, text := range m {
+				if !strings.Contains(text, "{{") || r.templates[text] != nil {
+					continue
+				}
+				t, err := template.New("").Option("missingkey=zero").Parse(text)
+				if err != nil {
+					return err
+				}
+				r.templates[text] = t
+			}
+		}
+	}
+	return nil
+}
+
+// render returns o, one of the rule's actions, with its params and messages
+// rendered with data. Templates that fail to execute are returned as written.
+func (r RemediationRule) render(o Obligation, data TemplateData) Obligation {
+	out := Obligation{Code: o.Code}
+	if len(o.Params) > 0 {
+		out.Params = make(map[string]string, len(o.Params))
+		for k, v := range o.Params {
+			out.Params[k] = r.renderTemplate(v, data)
+		}
+	}
+	data.Params = out.Params
+	if len(o.Messages) > 0 {
+		out.Messages = make(map[string]string, len(o.Messages))
+		for k, v := range o.Messages {
+			out.Messages[k] = r.renderTemplate(v, data)
+		}
+	}
+	return out
+}
+
+func (r RemediationRule) renderTemplate(text string, data TemplateData) string {
+	t, ok := r.templates[text]
+	if !ok {
+		return text
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return text
+	}
+	return b.String()
+}
@@ -0,0 +1,198 @@
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/bradtumy/authorization-service/pkg/schedule"
+)
+
+// maxRevisions bounds how many revisions are retained per store.
+const maxRevisions = 50
+
+// ErrRevisionNotFound is returned when a requested revision is not retained.
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// Revision describes a policy set that was successfully loaded into a store.
+type Revision struct {
+	Number   int       `json:"revision"`
+	Source   string    `json:"source"`
+	Commit   string    `json:"commit,omitempty"`
+	Digest   string    `json:"digest"`
+	LoadedAt time.Time `json:"loadedAt"`
+	Active   bool      `json:"active"`
+	Pinned   bool      `json:"pinned"`
+}
+
+type snapshot struct {
+	rev       Revision
+	roles     map[string]Role
+	users     map[string]User
+	policies  map[string]Policy
+	schedules map[string]*schedule.Schedule
+	zones     map[string][]netip.Prefix
+	rules     []RemediationRule
+}
+
+func (s snapshot) digest() string {
+	data, _ := json.Marshal(struct {
+		Roles     map[string]Role
+		Users     map[string]User
+		Policies  map[string]Policy
+		Schedules map[string]*schedule.Schedule
+		Zones     map[string][]netip.Prefix
+		Rules     []RemediationRule `json:",omitempty"`
+	}{s.roles, s.users, s.policies, s.schedules, s.zones, s.rules})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// record appends snap as a new revision and activates it unless the store is
+// pinned. Reloads of content identical to the latest revision are ignored so
+// periodic refreshes do not undo a rollback. Callers must hold ps.mu.
+func (ps *PolicyStore) record(snap snapshot, source, commit string) {
+	snap.rev = Revision{Source: source, Commit: commit, Digest: snap.digest(), LoadedAt: time.Now().UTC()}
+	if n := len(ps.history); n > 0 {
+		last := ps.history[n-1].rev
+		if last.Digest == snap.rev.Digest && last.Commit == commit {
+			return
+		}
+		snap.rev.Number = last.Number + 1
+	} else {
+		snap.rev.Number = 1
+	}
+	ps.history = append(ps.history, snap)
+	if ps.pinned == 0 {
+		ps.activate(snap)
+	}
+	ps.trim()
+}
+
+// trim drops the oldest revisions beyond maxRevisions, keeping the active and
+// pinned ones however old they are. Callers must hold ps.mu.
+func (ps *PolicyStore) trim() {
+	excess := len(ps.history) - maxRevisions
+	if excess <= 0 {
+		return
+	}
+	kept := ps.history[:0]
+	for _, s := range ps.history {
+		if excess > 0 && s.rev.Number != ps.active && s.rev.Number != ps.pinned {
+			excess--
+			continue
+		}
+		kept = append(kept, s)
+	}
+	ps.history = kept
+}
+
+func (ps *PolicyStore) activate(snap snapshot) {
+	ps.Roles = snap.roles
+	ps.Users = snap.users
+	ps.Policies = snap.policies
+	ps.Schedules = snap.schedules
+	ps.Zones = snap.zones
+	ps.Remediation = snap.rules
+	ps.active = snap.rev.Number
+}
+
+// view returns the active policy set and revision. Loads replace the maps
+// rather than modifying them, so the view stays consistent after ps.mu is
+// released.
+func (ps *PolicyStore) view() snapshot {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	snap := snapshot{roles: ps.Roles, users: ps.Users, policies: ps.Policies, schedules: ps.Schedules, zones: ps.Zones, rules: ps.Remediation}
+	if active, err := ps.find(ps.active); err == nil {
+		snap.rev = active.rev
+	}
+	return snap
+}
+
+func (ps *PolicyStore) find(n int) (snapshot, error) {
+	for _, s := range ps.history {
+		if s.rev.Number == n {
+			return s, nil
+		}
+	}
+	return snapshot{}, fmt.Errorf("%w: %d", ErrRevisionNotFound, n)
+}
+
+// History returns the retained revisions, oldest first.
+func (ps *PolicyStore) History() []Revision {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	out := make([]Revision, 0, len(ps.history))
+	for _, s := range ps.history {
+		r := s.rev
+		r.Active = r.Number == ps.active
+		r.Pinned = r.Number == ps.pinned
+		out = append(out, r)
+	}
+	return out
+}
+
+// ActiveRevision returns the revision currently used for evaluation.
+func (ps *PolicyStore) ActiveRevision() (Revision, bool) {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	s, err := ps.find(ps.active)
+	if err != nil {
+		return Revision{}, false
+	}
+	r := s.rev
+	r.Active = true
+	r.Pinned = r.Number == ps.pinned
+	return r, true
+}
+
+// Commit returns the source commit of the active revision, if any.
+func (ps *PolicyStore) Commit() string {
+	r, _ := ps.ActiveRevision()
+	return r.Commit
+}
+
+// Rollback activates a previously loaded revision. It fails while the store is
+// pinned to a different revision.
+func (ps *PolicyStore) Rollback(n int) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.pinned != 0 && ps.pinned != n {
+		return fmt.Errorf("store is pinned to revision %d", ps.pinned)
+	}
+	s, err := ps.find(n)
+	if err != nil {
+		return err
+	}
+	ps.activate(s)
+	return nil
+}
+
+// Pin activates revision n and keeps it active across subsequent loads until
+// Unpin is called. New loads are still recorded in the history.
+func (ps *PolicyStore) Pin(n int) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	s, err := ps.find(n)
+	if err != nil {
+		return err
+	}
+	ps.activate(s)
+	ps.pinned = n
+	return nil
+}
+
+// Unpin releases a pin and activates the latest recorded revision.
+func (ps *PolicyStore) Unpin() {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.pinned = 0
+	if n := len(ps.history); n > 0 {
+		ps.activate(ps.history[n-1])
+	}
+}
@@ -0,0 +1,121 @@
+package policy
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bradtumy/authorization-service/pkg/graph"
+)
+
+const revisionPolicy = `roles:
+  - name: "admin"
+    policies: ["policy1"]
+users:
+  - username: "alice"
+    roles: ["admin"]
+policies:
+  - id: "policy1"
+    subjects:
+      - role: "admin"
+    resource: ["file1"]
+    action: ["read"]
+    effect: "%s"
+`
+
+func TestRevisionRollbackAndPin(t *testing.T) {
+	store := NewPolicyStore()
+	engine := NewPolicyEngine(store, graph.New())
+	if err := store.LoadRevision([]byte(fmt.Sprintf(revisionPolicy, "allow")), "git", "aaa"); err != nil {
+		t.Fatalf("load rev1: %v", err)
+	}
+	if err := store.LoadRevision([]byte(fmt.Sprintf(revisionPolicy, "deny")), "git", "bbb"); err != nil {
+		t.Fatalf("load rev2: %v", err)
+	}
+	// Identical content from the same commit is not recorded again.
+	if err := store.LoadRevision([]byte(fmt.Sprintf(revisionPolicy, "deny")), "git", "bbb"); err != nil {
+		t.Fatalf("reload rev2: %v", err)
+	}
+	if h := store.History(); len(h) != 2 || !h[1].Active {
+		t.Fatalf("expected two revisions with the latest active, got %+v", h)
+	}
+	if dec := engine.Evaluate("alice", "file1", "read", nil); dec.Allow || dec.Commit != "bbb" {
+		t.Fatalf("expected deny from bbb, got %#v", dec)
+	}
+
+	if err := store.Rollback(1); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	if dec := engine.Evaluate("alice", "file1", "read", nil); !dec.Allow || dec.Commit != "aaa" {
+		t.Fatalf("expected allow from aaa after rollback, got %#v", dec)
+	}
+	if err := store.Rollback(7); err == nil {
+		t.Fatalf("expected error for unknown revision")
+	}
+
+	if err := store.Pin(1); err != nil {
+		t.Fatalf("pin: %v", err)
+	}
+	if err := store.LoadRevision([]byte(fmt.Sprintf(revisionPolicy, "deny")), "git", "ccc"); err != nil {
+		t.Fatalf("load rev3: %v", err)
+	}
+	if rev, _ := store.ActiveRevision(); rev.Number != 1 || !rev.Pinned {
+		t.Fatalf("expected pinned revision 1 to stay active, got %+v", rev)
+	}
+	if err := store.Rollback(2); err == nil {
+		t.Fatalf("expected rollback to fail while pinned")
+	}
+	store.Unpin()
+	if rev, _ := store.ActiveRevision(); rev.Number != 3 || rev.Commit != "ccc" {
+		t.Fatalf("expected latest revision after unpin, got %+v", rev)
+	}
+}
+
+func TestRevisionTrimKeepsPinned(t *testing.T) {
+	store := NewPolicyStore()
+	if err := store.LoadRevision([]byte(fmt.Sprintf(revisionPolicy, "allow")), "git", "pinned"); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if err := store.Pin(1); err != nil {
+		t.Fatalf("pin: %v", err)
+	}
+	for i := 0; i < maxRevisions+5; i++ {
+		if err := store.LoadRevision([]byte(fmt.Sprintf(revisionPolicy, "deny")), "git", fmt.Sprintf("c%d", i)); err != nil {
+			t.Fatalf("load: %v", err)
+		}
+	}
+	history := store.History()
+	if len(history) != maxRevisions || history[0].Number != 1 || !history[0].Pinned {
+		t.Fatalf("expected the pinned revision to be retained, got %d revisions starting at %+v", len(history), history[0])
+	}
+	if store.Commit() != "pinned" {
+		t.Fatalf("expected the pinned commit to stay active, got %q", store.Commit())
+	}
+	store.Unpin()
+	if err := store.Rollback(1); err != nil {
+		t.Fatalf("rollback to the formerly pinned revision: %v", err)
+	}
+}
+
+func TestEvaluateDuringReload(t *testing.T) {
+	store := NewPolicyStore()
+	if err := store.LoadRevision([]byte(fmt.Sprintf(revisionPolicy, "allow")), "git", "allow"); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	engine := NewPolicyEngine(store, nil)
+	var loads atomic.Int32
+	go func() {
+		for i := 0; i < 100; i++ {
+			effect := []string{"deny", "allow"}[i%2]
+			store.LoadRevision([]byte(fmt.Sprintf(revisionPolicy, effect)), "git", effect)
+			loads.Add(1)
+		}
+	}()
+	for loads.Load() < 100 {
+		// The decision and its commit come from the same revision.
+		dec := engine.Evaluate("alice", "file1", "read", nil)
+		if want := map[bool]string{true: "allow", false: "deny"}[dec.Allow]; dec.Commit != want {
+			t.Fatalf("decision %v stamped with commit %q", dec.Allow, dec.Commit)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package policy
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/bradtumy/authorization-service/pkg/schedule"
+)
+
+// policyFile is the layout of a policy YAML file.
+type policyFile struct {
+	Roles     []Role                   `yaml:"roles"`
+	Users     []User                   `yaml:"users"`
+	Policies  []Policy                 `yaml:"policies"`
+	Schedules map[string]schedule.Spec `yaml:"schedules"`
+	Calendars map[string][]string      `yaml:"calendars"`
+	Zones     map[string][]string      `yaml:"zones"`
+	// Remediation replaces the built-in remediation heuristics when set.
+	Remediation []RemediationRule `yaml:"remediation"`
+}
+
+// WhenPattern matches the `when` expression syntax understood by
+// ParseExpression.
+const WhenPattern = `^\s*context\.[^\s<>=]+(\s*(==|<|>)\s*\S.*|\s+contains\s+\S.*|\s+in\s+(cidr|zone)\(.+\)\s*)$`
+
+// fieldDoc annotates a model field in the generated schema. Fields are keyed
+// by Go type name and YAML field name.
+type fieldDoc struct {
+	description string
+	required    bool
+	enum        []string
+	pattern     string
+}
+
+var fieldDocs = map[string]fieldDoc{
+	"policyFile.roles":            {description: "Roles and the policies they grant."},
+	"policyFile.users":            {description: "Users and the roles they hold."},
+	"policyFile.policies":         {description: "Authorization policies."},
+	"policyFile.schedules":        {description: "Named time windows referenced by the time condition."},
+	"policyFile.calendars":        {description: "Named lists of holiday dates (YYYY-MM-DD) referenced by schedules."},
+	"policyFile.zones":            {description: "Named network zones: lists of CIDR ranges or addresses referenced by in zone(...)."},
+	"policyFile.remediation":      {description: "Rules mapping denials to remediation actions; they replace the built-in risk, MFA and time window advice."},
+	"RemediationRule.id":          {description: "Rule name used in validation findings."},
+	"RemediationRule.policies":    {description: "IDs of the deciding policies the rule applies to."},
+	"RemediationRule.conditions":  {description: "Condition keys, such as time, whose failure the rule applies to."},
+	"RemediationRule.when":        {description: "Policy when expressions whose failure the rule applies to."},
+	"RemediationRule.if":          {description: "Expressions over the decision context that must hold, in the when syntax.", pattern: WhenPattern},
+	"RemediationRule.obligations": {description: "Obligations returned with matching denials; params and messages are Go templates."},
+	"RemediationRule.advice":      {description: "Advice returned with matching denials; params and messages are Go templates."},
+	"Spec.days":                   {description: "Weekdays such as Mon-Fri or Sat,Sun; every day when omitted."},
+	"Spec.hours":                  {description: "Daily window HH:MM-HH:MM; all day when omitted. An end before the start spans midnight.", pattern: `^\d{2}:\d{2}-\d{2}:\d{2}$`},
+	"Spec.timezone":               {description: "IANA timezone such as America/Chicago; UTC when omitted."},
+	"Spec.holidays":               {description: "Dates (YYYY-MM-DD) or calendar names excluded from the schedule."},
+	"Spec.not_before":             {description: "First date (YYYY-MM-DD) or instant (RFC 3339) the schedule applies."},
+	"Spec.not_after":              {description: "Last date (YYYY-MM-DD, inclusive) or instant (RFC 3339) the schedule applies."},
+	"Role.name":                   {description: "Unique role name.", required: true},
+	"Role.policies":               {description: "IDs of the policies granted to holders of the role, in evaluation order."},
+	"User.username":               {description: "Unique user name.", required: true},
+	"User.roles":                  {description: "Roles held by the user, in evaluation order."},
+	"Subject.role":                {description: "Role the policy is limited to.", required: true},
+	"Policy.id":                   {description: "Unique policy ID referenced from roles.", required: true},
+	"Policy.description":          {description: "Human-readable summary."},
+	"Policy.subjects":             {description: "Roles the policy applies to; when empty it applies to every role that lists it."},
+	"Policy.resource":             {description: "Resources or resource groups matched; * matches any resource.", required: true},
+	"Policy.action":               {description: "Actions matched; * matches any action.", required: true},
+	"Policy.effect":               {description: "Outcome when the policy matches and its conditions hold.", required: true, enum: []string{"allow", "deny"}},
+	"Policy.conditions":           {description: "Context values that must equal the given strings."},
+	"Policy.when":                 {description: "Expressions of the form context.<key> ==, <, > or contains value, or context.<key> in cidr(...) or zone(...); all must hold.", pattern: WhenPattern},
+	"Policy.obligations":          {description: "Actions the enforcement point must carry out when the policy decides, such as a step-up authentication."},
+	"Policy.advice":               {description: "Actions the enforcement point may carry out when the policy decides."},
+	"Obligation.code":             {description: "Action code such as step_up.", required: true},
+	"Obligation.params":           {description: "Parameters of the action, such as required_acr or max_age."},
+	"Obligation.messages":         {description: "Human-readable messages keyed by locale, such as en or de."},
+	"Obligation.on":               {description: "Outcome the action applies to; both when omitted.", enum: []string{"allow", "deny"}},
+}
+
+// conditionKeys describes condition keys with special meaning.
+var conditionKeys = map[string]interface{}{
+	"time": map[string]interface{}{
+		"type":        "string",
+		"description": "Name of a schedule, business-hours, or an inline schedule such as \"Mon-Fri 08:00-18:00 America/Chicago\".",
+	},
+}
+
+// Schema returns a JSON Schema (draft-07) describing the policy file format,
+// generated from the Role, User and Policy model.
+func Schema() map[string]interface{} {
+	s := typeSchema(reflect.TypeOf(policyFile{}))
+	s["$schema"] = "http://json-schema.org/draft-07/schema#"
+	s["title"] = "Authorization service policy file"
+	return s
+}
+
+// SchemaJSON returns Schema encoded as indented JSON.
+func SchemaJSON() ([]byte, error) {
+	return json.MarshalIndent(Schema(), "", "  ")
+}
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		props := map[string]interface{}{}
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			fs := typeSchema(f.Type)
+			doc := fieldDocs[t.Name()+"."+name]
+			if doc.description != "" {
+				fs["description"] = doc.description
+			}
+			if doc.required {
+				required = append(required, name)
+			}
+			if doc.enum != nil {
+				fs["enum"] = doc.enum
+			}
+			if doc.pattern != "" {
+				// Patterns on lists constrain each item.
+				if items, ok := fs["items"].(map[string]interface{}); ok {
+					items["pattern"] = doc.pattern
+				} else {
+					fs["pattern"] = doc.pattern
+				}
+			}
+			if t == reflect.TypeOf(Policy{}) && name == "conditions" {
+				fs["properties"] = conditionKeys
+			}
+			props[name] = fs
+		}
+		s := map[string]interface{}{"type": "object", "properties": props, "additionalProperties": false}
+		if len(required) > 0 {
+			s["required"] = required
+		}
+		return s
+	}
+	return map[string]interface{}{"type": "string"}
+}
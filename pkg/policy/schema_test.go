@@ -0,0 +1,35 @@
+package policy
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestSchemaFromModel(t *testing.T) {
+	s := Schema()
+	props := s["properties"].(map[string]interface{})
+	policies := props["policies"].(map[string]interface{})["items"].(map[string]interface{})
+	required := policies["required"].([]string)
+	if len(required) != 4 {
+		t.Fatalf("expected id, resource, action and effect to be required, got %v", required)
+	}
+	fields := policies["properties"].(map[string]interface{})
+	if _, ok := fields["conditions"].(map[string]interface{})["properties"].(map[string]interface{})["time"]; !ok {
+		t.Fatalf("expected the time condition key to be described")
+	}
+	when := fields["when"].(map[string]interface{})["items"].(map[string]interface{})
+	re := regexp.MustCompile(when["pattern"].(string))
+	for _, expr := range []string{`context.risk < "high"`, `context.mfa=="true"`} {
+		if !re.MatchString(expr) {
+			t.Errorf("pattern rejects %q", expr)
+		}
+		if _, ok := ParseExpression(expr); !ok {
+			t.Errorf("ParseExpression rejects %q", expr)
+		}
+	}
+	for _, expr := range []string{`risk == "high"`, `context.risk`} {
+		if re.MatchString(expr) {
+			t.Errorf("pattern accepts %q", expr)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+// Package policydiff computes the effective permission changes between two
+// policy sets, per role and per user, using the engine's matching semantics.
+package policydiff
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/bradtumy/authorization-service/pkg/policy"
+)
+
+// Change kinds.
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// Grant is an allow decision together with what it depends on.
+type Grant struct {
+	PolicyID   string            `json:"policy"`
+	Conditions map[string]string `json:"conditions,omitempty"`
+	When       []string          `json:"when,omitempty"`
+}
+
+// Change describes how access to one resource and action moved. A resource or
+// action of "*" stands for any value not named explicitly in either set.
+type Change struct {
+	Resource string `json:"resource"`
+	Action   string `json:"action"`
+	Kind     string `json:"kind"`
+	Old      *Grant `json:"old,omitempty"`
+	New      *Grant `json:"new,omitempty"`
+}
+
+// Delta lists the changes for one role or user.
+type Delta struct {
+	Name    string   `json:"name"`
+	Changes []Change `json:"changes"`
+}
+
+// Result is the permission delta between two policy sets.
+type Result struct {
+	Roles []Delta `json:"roles"`
+	Users []Delta `json:"users"`
+}
+
+// Empty reports whether no effective permission changed.
+func (r Result) Empty() bool {
+	return len(r.Roles) == 0 && len(r.Users) == 0
+}
+
+// Compare computes the delta from old to new. Every resource and action named
+// in either set is evaluated, plus "*" for anything else.
+func Compare(old, new *policy.PolicyStore) Result {
+	oe := policy.NewPolicyEngine(old, nil)
+	ne := policy.NewPolicyEngine(new, nil)
+	resources, actions := universe(old, new)
+	res := Result{Roles: []Delta{}, Users: []Delta{}}
+
+	var oldRoles, newRoles, oldUsers, newUsers []string
+	for name := range old.Roles {
+		oldRoles = append(oldRoles, name)
+	}
+	for name := range new.Roles {
+		newRoles = append(newRoles, name)
+	}
+	for name := range old.Users {
+		oldUsers = append(oldUsers, name)
+	}
+	for name := range new.Users {
+		newUsers = append(newUsers, name)
+	}
+
+	for _, name := range union(oldRoles, newRoles) {
+		roles := []string{name}
+		if d := delta(name, roles, roles, oe, ne, resources, actions); d != nil {
+			res.Roles = append(res.Roles, *d)
+		}
+	}
+	for _, name := range union(oldUsers, newUsers) {
+		if d := delta(name, old.Users[name].Roles, new.Users[name].Roles, oe, ne, resources, actions); d != nil {
+			res.Users = append(res.Users, *d)
+		}
+	}
+	return res
+}
+
+func delta(name string, oldRoles, newRoles []string, oe, ne *policy.PolicyEngine, resources, actions []string) *Delta {
+	type pair struct{ resource, action string }
+	type outcome struct{ old, new *Grant }
+	outcomes := map[pair]outcome{}
+	for _, r := range resources {
+		for _, a := range actions {
+			outcomes[pair{r, a}] = outcome{grant(oe, oldRoles, r, a), grant(ne, newRoles, r, a)}
+		}
+	}
+	var changes []Change
+	for _, r := range resources {
+		for _, a := range actions {
+			o := outcomes[pair{r, a}]
+			kind := classify(o.old, o.new)
+			if kind == "" {
+				continue
+			}
+			// Skip explicit values that changed exactly like the wildcard
+			// covering them; the wildcard entry already reports it.
+			redundant := false
+			for _, g := range []pair{{"*", a}, {r, "*"}, {"*", "*"}} {
+				if g == (pair{r, a}) {
+					continue
+				}
+				if w, ok := outcomes[g]; ok && reflect.DeepEqual(w, o) {
+					redundant = true
+					break
+				}
+			}
+			if !redundant {
+				changes = append(changes, Change{Resource: r, Action: a, Kind: kind, Old: o.old, New: o.new})
+			}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return &Delta{Name: name, Changes: changes}
+}
+
+// grant returns the allow the engine would give holders of roles, or nil when
+// the request would be denied or match no policy.
+func grant(pe *policy.PolicyEngine, roles []string, resource, action string) *Grant {
+	p, ok := pe.Match(roles, resource, action)
+	if !ok || p.Effect != "allow" {
+		return nil
+	}
+	return &Grant{PolicyID: p.ID, Conditions: p.Conditions, When: p.When}
+}
+
+func classify(old, new *Grant) string {
+	switch {
+	case old == nil && new == nil:
+		return ""
+	case old == nil:
+		return Added
+	case new == nil:
+		return Removed
+	case !reflect.DeepEqual(old.Conditions, new.Conditions) || !reflect.DeepEqual(old.When, new.When):
+		return Changed
+	}
+	return ""
+}
+
+// universe collects every explicit resource and action from both sets, sorted,
+// followed by "*".
+func universe(stores ...*policy.PolicyStore) ([]string, []string) {
+	rs, as := map[string]struct{}{}, map[string]struct{}{}
+	for _, st := range stores {
+		for _, p := range st.Policies {
+			for _, r := range p.Resource {
+				rs[r] = struct{}{}
+			}
+			for _, a := range p.Action {
+				as[a] = struct{}{}
+			}
+		}
+	}
+	return withWildcard(rs), withWildcard(as)
+}
+
+func withWildcard(set map[string]struct{}) []string {
+	delete(set, "*")
+	out := make([]string, 0, len(set)+1)
+	for v := range set {
+		out = append(out, v)
+	}
+	sort.Strings(out)
+	return append(out, "*")
+}
+
+func union(a, b []string) []string {
+	set := map[string]struct{}{}
+	for _, k := range append(append([]string{}, a...), b...) {
+		set[k] = struct{}{}
+	}
+	out := make([]string, 0, len(set))
+	for k := range set {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// WriteText prints the delta in a form suitable for a review comment.
+func (r Result) WriteText(w io.Writer) {
+	if r.Empty() {
+		fmt.Fprintln(w, "no effective permission changes")
+		return
+	}
+	writeDeltas(w, "role", r.Roles)
+	writeDeltas(w, "user", r.Users)
+}
+
+func writeDeltas(w io.Writer, kind string, deltas []Delta) {
+	for _, d := range deltas {
+		fmt.Fprintf(w, "%s %s:\n", kind, d.Name)
+		for _, c := range d.Changes {
+			switch c.Kind {
+			case Added:
+				fmt.Fprintf(w, "  + %s %s (policy %s%s)\n", c.Action, c.Resource, c.New.PolicyID, describe(c.New))
+			case Removed:
+				fmt.Fprintf(w, "  - %s %s (was policy %s%s)\n", c.Action, c.Resource, c.Old.PolicyID, describe(c.Old))
+			case Changed:
+				fmt.Fprintf(w, "  ~ %s %s (policy %s%s -> policy %s%s)\n", c.Action, c.Resource,
+					c.Old.PolicyID, describe(c.Old), c.New.PolicyID, describe(c.New))
+			}
+		}
+	}
+}
+
+func describe(g *Grant) string {
+	var parts []string
+	keys := make([]string, 0, len(g.Conditions))
+	for k := range g.Conditions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%s", k, g.Conditions[k]))
+	}
+	parts = append(parts, g.When...)
+	if len(parts) == 0 {
+		return ""
+	}
+	return " if " + strings.Join(parts, " and ")
+}
@@ -0,0 +1,93 @@
+package policydiff
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bradtumy/authorization-service/pkg/policy"
+)
+
+func load(t *testing.T, data string) *policy.PolicyStore {
+	t.Helper()
+	st := policy.NewPolicyStore()
+	if err := st.LoadPolicyData([]byte(data)); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	return st
+}
+
+const oldYAML = `roles:
+  - name: "viewer"
+    policies: ["read-file1", "write-file1"]
+users:
+  - username: "alice"
+    roles: ["viewer"]
+policies:
+  - id: "read-file1"
+    resource: ["file1"]
+    action: ["read"]
+    effect: "allow"
+  - id: "write-file1"
+    resource: ["file1"]
+    action: ["write"]
+    effect: "allow"
+    when:
+      - context.risk < "high"
+`
+
+const newYAML = `roles:
+  - name: "viewer"
+    policies: ["read-any", "write-file1"]
+users:
+  - username: "alice"
+    roles: ["viewer"]
+  - username: "bob"
+    roles: ["missing"]
+policies:
+  - id: "read-any"
+    resource: ["*"]
+    action: ["read"]
+    effect: "allow"
+  - id: "write-file1"
+    resource: ["file1"]
+    action: ["write"]
+    effect: "allow"
+    when:
+      - context.risk == "low"
+`
+
+func TestCompare(t *testing.T) {
+	res := Compare(load(t, oldYAML), load(t, newYAML))
+	if len(res.Roles) != 1 || res.Roles[0].Name != "viewer" {
+		t.Fatalf("expected a delta for viewer, got %+v", res.Roles)
+	}
+	changes := map[string]Change{}
+	for _, c := range res.Roles[0].Changes {
+		changes[c.Kind+" "+c.Action+" "+c.Resource] = c
+	}
+	if _, ok := changes["added read *"]; !ok {
+		t.Fatalf("expected wildcard read to be added, got %+v", res.Roles[0].Changes)
+	}
+	if _, ok := changes["changed write file1"]; !ok {
+		t.Fatalf("expected write condition change, got %+v", res.Roles[0].Changes)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("read file1 kept the same grant and should not be listed: %+v", res.Roles[0].Changes)
+	}
+	if len(res.Users) != 1 || res.Users[0].Name != "alice" {
+		t.Fatalf("bob has no effective access in either set, got %+v", res.Users)
+	}
+
+	var buf bytes.Buffer
+	res.WriteText(&buf)
+	if !strings.Contains(buf.String(), `~ write file1 (policy write-file1 if context.risk < "high" -> policy write-file1 if context.risk == "low")`) {
+		t.Fatalf("unexpected text output:\n%s", buf.String())
+	}
+}
+
+func TestCompareIdentical(t *testing.T) {
+	if res := Compare(load(t, oldYAML), load(t, oldYAML)); !res.Empty() {
+		t.Fatalf("expected no changes, got %+v", res)
+	}
+}
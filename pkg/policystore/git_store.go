@@ -1,60 +1,104 @@
 package policystore
 
 import (
-    "fmt"
-    "os/exec"
-    "strings"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
 )
 
+// TenantPolicyFile is the file name loaded from each tenant directory.
+const TenantPolicyFile = "policies.yaml"
+
 // GitStore clones and tracks a policy repository.
+//
+// Policies are laid out one directory per tenant beneath an optional base
+// directory, e.g. `<dir>/acme/policies.yaml`.
 type GitStore struct {
-    repoURL   string
-    branch    string
-    path      string
-    commitSHA string
+	repoURL   string
+	branch    string
+	path      string
+	commitSHA string
+	mu        sync.Mutex
 }
 
 // CloneRepo clones the given repository branch to the local path and returns a store.
 func CloneRepo(url, branch, path string) (*GitStore, error) {
-    if branch == "" {
-        branch = "main"
-    }
-    cmd := exec.Command("git", "clone", "--depth", "1", "--branch", branch, url, path)
-    if out, err := cmd.CombinedOutput(); err != nil {
-        return nil, fmt.Errorf("git clone: %v: %s", err, string(out))
-    }
-    gs := &GitStore{repoURL: url, branch: branch, path: path}
-    if err := gs.updateCommit(); err != nil {
-        return nil, err
-    }
-    return gs, nil
+	if branch == "" {
+		branch = "main"
+	}
+	cmd := exec.Command("git", "clone", "--depth", "1", "--branch", branch, url, path)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("git clone: %v: %s", err, string(out))
+	}
+	gs := &GitStore{repoURL: url, branch: branch, path: path}
+	if err := gs.updateCommit(); err != nil {
+		return nil, err
+	}
+	return gs, nil
 }
 
-// PullLatest fetches and resets to the latest commit on the tracked branch.
-func (g *GitStore) PullLatest() error {
-    fetch := exec.Command("git", "-C", g.path, "fetch", "origin", g.branch)
-    if out, err := fetch.CombinedOutput(); err != nil {
-        return fmt.Errorf("git fetch: %v: %s", err, string(out))
-    }
-    reset := exec.Command("git", "-C", g.path, "reset", "--hard", "origin/"+g.branch)
-    if out, err := reset.CombinedOutput(); err != nil {
-        return fmt.Errorf("git reset: %v: %s", err, string(out))
-    }
-    return g.updateCommit()
+// PullLatest fetches and resets to the latest commit on the tracked branch. It
+// reports whether the revision changed.
+func (g *GitStore) PullLatest() (bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	prev := g.commitSHA
+	fetch := exec.Command("git", "-C", g.path, "fetch", "--depth", "1", "origin", g.branch)
+	if out, err := fetch.CombinedOutput(); err != nil {
+		return false, fmt.Errorf("git fetch: %v: %s", err, string(out))
+	}
+	reset := exec.Command("git", "-C", g.path, "reset", "--hard", "FETCH_HEAD")
+	if out, err := reset.CombinedOutput(); err != nil {
+		return false, fmt.Errorf("git reset: %v: %s", err, string(out))
+	}
+	if err := g.updateCommit(); err != nil {
+		return false, err
+	}
+	return g.commitSHA != prev, nil
 }
 
 // CommitSHA returns the current repository revision.
 func (g *GitStore) CommitSHA() string {
-    return g.commitSHA
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.commitSHA
 }
 
-func (g *GitStore) updateCommit() error {
-    rev := exec.Command("git", "-C", g.path, "rev-parse", "HEAD")
-    out, err := rev.Output()
-    if err != nil {
-        return fmt.Errorf("git rev-parse: %w", err)
-    }
-    g.commitSHA = strings.TrimSpace(string(out))
-    return nil
+// Path returns the local checkout directory.
+func (g *GitStore) Path() string {
+	return g.path
+}
+
+// TenantFiles lists the tenant policy files found beneath dir in the checkout.
+// The returned map is keyed by tenant ID, taken from the directory name.
+func (g *GitStore) TenantFiles(dir string) (map[string]string, error) {
+	base := filepath.Join(g.path, dir)
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]string)
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		file := filepath.Join(base, e.Name(), TenantPolicyFile)
+		if _, err := os.Stat(file); err == nil {
+			files[e.Name()] = file
+		}
+	}
+	return files, nil
 }
 
+func (g *GitStore) updateCommit() error {
+	rev := exec.Command("git", "-C", g.path, "rev-parse", "HEAD")
+	out, err := rev.Output()
+	if err != nil {
+		return fmt.Errorf("git rev-parse: %w", err)
+	}
+	g.commitSHA = strings.TrimSpace(string(out))
+	return nil
+}
@@ -0,0 +1,80 @@
+package policystore
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func gitCmd(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	args = append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+	if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v: %s", args, err, out)
+	}
+}
+
+func commitFile(t *testing.T, work, rel, content string) {
+	t.Helper()
+	path := filepath.Join(work, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	gitCmd(t, work, "add", "-A")
+	gitCmd(t, work, "commit", "-m", "update "+rel)
+	gitCmd(t, work, "push", "origin", "HEAD:main")
+}
+
+func TestGitStoreCloneAndPull(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	tmp := t.TempDir()
+	bare := filepath.Join(tmp, "policies.git")
+	work := filepath.Join(tmp, "work")
+	if out, err := exec.Command("git", "init", "--bare", "-b", "main", bare).CombinedOutput(); err != nil {
+		t.Fatalf("init bare: %v: %s", err, out)
+	}
+	if out, err := exec.Command("git", "clone", bare, work).CombinedOutput(); err != nil {
+		t.Fatalf("clone work: %v: %s", err, out)
+	}
+	commitFile(t, work, "tenants/acme/policies.yaml", "policies: []\n")
+
+	gs, err := CloneRepo("file://"+bare, "main", filepath.Join(tmp, "checkout"))
+	if err != nil {
+		t.Fatalf("CloneRepo: %v", err)
+	}
+	first := gs.CommitSHA()
+	if first == "" {
+		t.Fatalf("expected commit sha after clone")
+	}
+	files, err := gs.TenantFiles("tenants")
+	if err != nil {
+		t.Fatalf("TenantFiles: %v", err)
+	}
+	if len(files) != 1 || files["acme"] == "" {
+		t.Fatalf("expected acme tenant file, got %v", files)
+	}
+
+	changed, err := gs.PullLatest()
+	if err != nil || changed {
+		t.Fatalf("expected no change, got changed=%v err=%v", changed, err)
+	}
+
+	commitFile(t, work, "tenants/globex/policies.yaml", "policies: []\n")
+	changed, err = gs.PullLatest()
+	if err != nil || !changed {
+		t.Fatalf("expected change after push, got changed=%v err=%v", changed, err)
+	}
+	if gs.CommitSHA() == first {
+		t.Fatalf("expected commit sha to advance")
+	}
+	files, _ = gs.TenantFiles("tenants")
+	if len(files) != 2 {
+		t.Fatalf("expected two tenants after pull, got %v", files)
+	}
+}
@@ -0,0 +1,291 @@
+package policytest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/bradtumy/authorization-service/pkg/graph"
+	"github.com/bradtumy/authorization-service/pkg/policy"
+)
+
+// FileSuffix identifies policy test files. A test file `rbac_test.yaml` runs
+// against `rbac.yaml` in the same directory unless it names another file.
+const FileSuffix = "_test.yaml"
+
+// Case declares a single access request and its expected outcome.
+type Case struct {
+	Name     string            `yaml:"name"`
+	Subject  string            `yaml:"subject"`
+	Resource string            `yaml:"resource"`
+	Action   string            `yaml:"action"`
+	Context  map[string]string `yaml:"context"`
+	Expect   string            `yaml:"expect"`
+	PolicyID string            `yaml:"policy"`
+	Reason   string            `yaml:"reason"`
+}
+
+// Suite is the content of a policy test file.
+type Suite struct {
+	Policies string `yaml:"policies"`
+	Tests    []Case `yaml:"tests"`
+}
+
+// CaseResult is the outcome of running a Case.
+type CaseResult struct {
+	Name     string        `json:"name"`
+	Passed   bool          `json:"passed"`
+	Failure  string        `json:"failure,omitempty"`
+	Got      string        `json:"got"`
+	PolicyID string        `json:"policy_id,omitempty"`
+	Reason   string        `json:"reason"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// SuiteResult is the outcome of running a test file.
+type SuiteResult struct {
+	File     string       `json:"file"`
+	Policies string       `json:"policies"`
+	Error    string       `json:"error,omitempty"`
+	Cases    []CaseResult `json:"cases"`
+}
+
+// Result aggregates suite results and rule coverage per policy file.
+type Result struct {
+	Suites   []SuiteResult                    `json:"suites"`
+	Coverage map[string]policy.CoverageReport `json:"coverage"`
+}
+
+// Failed returns the number of failed cases plus suites that could not run.
+func (r Result) Failed() int {
+	n := 0
+	for _, s := range r.Suites {
+		if s.Error != "" {
+			n++
+		}
+		for _, c := range s.Cases {
+			if !c.Passed {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// Discover returns the test files beneath root, or root itself if it is a file.
+func Discover(root string) ([]string, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{root}, nil
+	}
+	var files []string
+	err = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(d.Name(), FileSuffix) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+type target struct {
+	store    *policy.PolicyStore
+	engine   *policy.PolicyEngine
+	coverage *policy.Coverage
+}
+
+// Run discovers and executes every test file beneath root. Policy files shared
+// by several test files are loaded once so their coverage accumulates.
+func Run(root string) (Result, error) {
+	files, err := Discover(root)
+	if err != nil {
+		return Result{}, err
+	}
+	res := Result{Suites: []SuiteResult{}, Coverage: map[string]policy.CoverageReport{}}
+	targets := map[string]*target{}
+	for _, file := range files {
+		sr := SuiteResult{File: file, Cases: []CaseResult{}}
+		suite, err := loadSuite(file)
+		if err != nil {
+			sr.Error = err.Error()
+			res.Suites = append(res.Suites, sr)
+			continue
+		}
+		sr.Policies = suite.Policies
+		t, ok := targets[suite.Policies]
+		if !ok {
+			st := policy.NewPolicyStore()
+			if err := st.LoadPolicies(suite.Policies); err != nil {
+				sr.Error = "load policies: " + err.Error()
+				res.Suites = append(res.Suites, sr)
+				continue
+			}
+			t = &target{store: st, engine: policy.NewPolicyEngine(st, graph.New()), coverage: policy.NewCoverage()}
+			t.engine.SetCoverage(t.coverage)
+			targets[suite.Policies] = t
+		}
+		for i, c := range suite.Tests {
+			sr.Cases = append(sr.Cases, runCase(t.engine, c, i))
+		}
+		res.Suites = append(res.Suites, sr)
+	}
+	for path, t := range targets {
+		res.Coverage[path] = t.coverage.Report(t.store)
+	}
+	return res, nil
+}
+
+func loadSuite(file string) (Suite, error) {
+	var s Suite
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return s, err
+	}
+	if err := yaml.UnmarshalStrict(data, &s); err != nil {
+		return s, err
+	}
+	if s.Policies == "" {
+		s.Policies = strings.TrimSuffix(filepath.Base(file), FileSuffix) + ".yaml"
+	}
+	if !filepath.IsAbs(s.Policies) {
+		s.Policies = filepath.Join(filepath.Dir(file), s.Policies)
+	}
+	for i, c := range s.Tests {
+		if c.Expect != "allow" && c.Expect != "deny" {
+			return s, fmt.Errorf("test %d (%s): expect must be allow or deny", i+1, c.Name)
+		}
+	}
+	return s, nil
+}
+
+func runCase(engine *policy.PolicyEngine, c Case, idx int) CaseResult {
+	name := c.Name
+	if name == "" {
+		name = fmt.Sprintf("%s %s %s #%d", c.Subject, c.Action, c.Resource, idx+1)
+	}
+	start := time.Now()
+	dec := engine.Evaluate(c.Subject, c.Resource, c.Action, c.Context)
+	cr := CaseResult{Name: name, Got: "deny", PolicyID: dec.PolicyID, Reason: dec.Reason, Duration: time.Since(start)}
+	if dec.Allow {
+		cr.Got = "allow"
+	}
+	var failures []string
+	if cr.Got != c.Expect {
+		failures = append(failures, fmt.Sprintf("expected %s, got %s", c.Expect, cr.Got))
+	}
+	if c.PolicyID != "" && c.PolicyID != dec.PolicyID {
+		failures = append(failures, fmt.Sprintf("expected policy %q, got %q", c.PolicyID, dec.PolicyID))
+	}
+	if c.Reason != "" && c.Reason != dec.Reason {
+		failures = append(failures, fmt.Sprintf("expected reason %q, got %q", c.Reason, dec.Reason))
+	}
+	cr.Passed = len(failures) == 0
+	cr.Failure = strings.Join(failures, "; ")
+	return cr
+}
+
+// WriteText prints results and coverage in a compact human-readable form.
+func (r Result) WriteText(w io.Writer) {
+	total := 0
+	for _, s := range r.Suites {
+		if s.Error != "" {
+			fmt.Fprintf(w, "ERROR %s: %s\n", s.File, s.Error)
+			continue
+		}
+		for _, c := range s.Cases {
+			total++
+			if c.Passed {
+				fmt.Fprintf(w, "ok    %s: %s\n", s.File, c.Name)
+			} else {
+				fmt.Fprintf(w, "FAIL  %s: %s: %s\n", s.File, c.Name, c.Failure)
+			}
+		}
+	}
+	paths := make([]string, 0, len(r.Coverage))
+	for p := range r.Coverage {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		cov := r.Coverage[p]
+		fmt.Fprintf(w, "coverage %s: %d/%d policies\n", p, cov.Covered, cov.Policies)
+		for _, id := range cov.UncoveredPolicy {
+			fmt.Fprintf(w, "  policy %s never exercised\n", id)
+		}
+		for _, u := range cov.UncoveredWhen {
+			fmt.Fprintf(w, "  policy %s when[%d] %q never evaluated\n", u.PolicyID, u.Index, u.Expression)
+		}
+	}
+	fmt.Fprintf(w, "%d tests, %d failed\n", total, r.Failed())
+}
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+// WriteJUnit writes the results as a JUnit XML report.
+func (r Result) WriteJUnit(w io.Writer) error {
+	out := junitSuites{}
+	for _, s := range r.Suites {
+		js := junitSuite{Name: s.File}
+		if s.Error != "" {
+			js.Errors = 1
+			js.Cases = append(js.Cases, junitCase{Name: "load", Classname: s.File, Time: "0", Error: &junitFailure{Message: s.Error}})
+		}
+		for _, c := range s.Cases {
+			jc := junitCase{Name: c.Name, Classname: s.File, Time: fmt.Sprintf("%.6f", c.Duration.Seconds())}
+			if !c.Passed {
+				js.Failures++
+				jc.Failure = &junitFailure{Message: c.Failure}
+			}
+			js.Tests++
+			js.Cases = append(js.Cases, jc)
+		}
+		out.Suites = append(out.Suites, js)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,80 @@
+package policytest
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunReportsFailuresAndCoverage(t *testing.T) {
+	dir := t.TempDir()
+	policies := `roles:
+  - name: "partner"
+    policies: ["dashboard", "reports"]
+users:
+  - username: "bob"
+    roles: ["partner"]
+policies:
+  - id: "dashboard"
+    subjects:
+      - role: "partner"
+    resource: ["dashboard"]
+    action: ["view"]
+    effect: "allow"
+    when:
+      - context.risk < "medium"
+      - context.time == "business-hours"
+  - id: "reports"
+    subjects:
+      - role: "partner"
+    resource: ["reports"]
+    action: ["view"]
+    effect: "allow"
+`
+	tests := `tests:
+  - name: high risk is denied
+    subject: bob
+    resource: dashboard
+    action: view
+    context: {risk: high}
+    expect: deny
+    policy: dashboard
+  - name: wrong expectation
+    subject: bob
+    resource: dashboard
+    action: view
+    context: {risk: high}
+    expect: allow
+`
+	if err := os.WriteFile(filepath.Join(dir, "partner.yaml"), []byte(policies), 0644); err != nil {
+		t.Fatalf("write policies: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "partner_test.yaml"), []byte(tests), 0644); err != nil {
+		t.Fatalf("write tests: %v", err)
+	}
+
+	res, err := Run(dir)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if res.Failed() != 1 {
+		t.Fatalf("expected one failure, got %d: %+v", res.Failed(), res.Suites)
+	}
+	cov := res.Coverage[filepath.Join(dir, "partner.yaml")]
+	if len(cov.UncoveredPolicy) != 1 || cov.UncoveredPolicy[0] != "reports" {
+		t.Fatalf("expected reports to be uncovered, got %+v", cov)
+	}
+	if len(cov.UncoveredWhen) != 1 || cov.UncoveredWhen[0].Index != 1 {
+		t.Fatalf("expected second when term to be uncovered, got %+v", cov.UncoveredWhen)
+	}
+
+	var buf bytes.Buffer
+	if err := res.WriteJUnit(&buf); err != nil {
+		t.Fatalf("WriteJUnit: %v", err)
+	}
+	if !strings.Contains(buf.String(), `failures="1"`) {
+		t.Fatalf("expected junit failure count, got %s", buf.String())
+	}
+}
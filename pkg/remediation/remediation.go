@@ -1,24 +1,89 @@
 package remediation
 
 import (
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
-// Suggest returns remediation steps based on context values such as risk and time.
-func Suggest(ctx map[string]string) []string {
-	var actions []string
+// MethodsKey is the context key holding the caller's authentication methods,
+// the token's amr claim when it is mapped.
+const MethodsKey = "auth.methods"
+
+// Codes of the actions returned by Advise.
+const (
+	// StepUp asks the caller to re-authenticate; the required_acr parameter
+	// names the authentication it must reach.
+	StepUp = "step_up"
+	// RetryAfter asks the caller to retry no earlier than the not_before
+	// parameter, an RFC 3339 instant.
+	RetryAfter = "retry_after"
+)
+
+// DefaultLocale is the locale of the messages in the remediation strings of a
+// decision.
+const DefaultLocale = "en"
+
+// Action is a structured remediation step: a code gateways act on, its
+// parameters and optional messages keyed by locale.
+type Action struct {
+	Code     string            `json:"code"`
+	Params   map[string]string `json:"params,omitempty"`
+	Messages map[string]string `json:"messages,omitempty"`
+}
 
-	if riskTooHigh(ctx) {
-		actions = append(actions, "Require MFA step-up")
+// Message returns the message of the action in locale, falling back to
+// DefaultLocale, then to any message and finally to the code.
+func (a Action) Message(locale string) string {
+	if m, ok := a.Messages[locale]; ok {
+		return m
 	}
-	if outsideBusinessHours(ctx) {
-		actions = append(actions, "Try again during working hours")
+	if m, ok := a.Messages[DefaultLocale]; ok {
+		return m
+	}
+	locales := make([]string, 0, len(a.Messages))
+	for l := range a.Messages {
+		locales = append(locales, l)
+	}
+	if len(locales) > 0 {
+		sort.Strings(locales)
+		return a.Messages[locales[0]]
+	}
+	return a.Code
+}
+
+// Advise returns remediation actions based on context values such as risk,
+// authentication methods and time.
+func Advise(ctx map[string]string) []Action {
+	var actions []Action
+
+	if riskTooHigh(ctx) || mfaMissing(ctx) {
+		actions = append(actions, Action{
+			Code:     StepUp,
+			Params:   map[string]string{"required_acr": "mfa"},
+			Messages: map[string]string{DefaultLocale: "Require MFA step-up"},
+		})
+	}
+	if next, ok := nextWindow(ctx); ok {
+		actions = append(actions, Action{
+			Code:     RetryAfter,
+			Params:   map[string]string{"not_before": next.Format(time.RFC3339)},
+			Messages: map[string]string{DefaultLocale: "Try again after " + next.Format("2006-01-02 15:04 MST")},
+		})
 	}
 	return actions
 }
 
+// Suggest returns the messages of the actions Advise returns.
+func Suggest(ctx map[string]string) []string {
+	var msgs []string
+	for _, a := range Advise(ctx) {
+		msgs = append(msgs, a.Message(DefaultLocale))
+	}
+	return msgs
+}
+
 func riskTooHigh(ctx map[string]string) bool {
 	r := ""
 	if v, ok := ctx["risk"]; ok {
@@ -41,15 +106,28 @@ func riskTooHigh(ctx map[string]string) bool {
 	return false
 }
 
-func outsideBusinessHours(ctx map[string]string) bool {
-	tStr, ok := ctx["time"]
-	if !ok || tStr == "" {
+// mfaMissing reports whether the caller's authentication methods are known
+// and do not include mfa.
+func mfaMissing(ctx map[string]string) bool {
+	methods, ok := ctx[MethodsKey]
+	if !ok {
 		return false
 	}
-	t, err := time.Parse("15:04", tStr)
-	if err != nil {
-		return false
+	for _, m := range strings.Split(methods, ",") {
+		if strings.TrimSpace(m) == "mfa" {
+			return false
+		}
+	}
+	return true
+}
+
+// nextWindow reads the opening of the next allowed time window, which the
+// policy engine records when a time condition fails.
+func nextWindow(ctx map[string]string) (time.Time, bool) {
+	v, ok := ctx["next_window"]
+	if !ok || v == "" {
+		return time.Time{}, false
 	}
-	h := t.Hour()
-	return h < 9 || h >= 17
+	t, err := time.Parse(time.RFC3339, v)
+	return t, err == nil
 }
@@ -10,11 +10,24 @@ func TestSuggestRisk(t *testing.T) {
 	}
 }
 
-func TestSuggestBusinessHours(t *testing.T) {
-	ctx := map[string]string{"time": "20:00"}
+func TestSuggestMissingMFA(t *testing.T) {
+	res := Suggest(map[string]string{"auth.methods": "pwd"})
+	if len(res) != 1 || res[0] != "Require MFA step-up" {
+		t.Fatalf("expected MFA remediation, got %v", res)
+	}
+	if res := Suggest(map[string]string{"auth.methods": "pwd,mfa", "risk": "high"}); len(res) != 1 {
+		t.Fatalf("expected a single MFA remediation, got %v", res)
+	}
+	if res := Suggest(map[string]string{"auth.methods": "pwd,mfa"}); len(res) != 0 {
+		t.Fatalf("expected no remediation after MFA, got %v", res)
+	}
+}
+
+func TestSuggestNextWindow(t *testing.T) {
+	ctx := map[string]string{"time": "20:00", "next_window": "2025-01-07T09:00:00Z"}
 	res := Suggest(ctx)
-	if len(res) != 1 || res[0] != "Try again during working hours" {
-		t.Fatalf("expected working hours remediation, got %v", res)
+	if len(res) != 1 || res[0] != "Try again after 2025-01-07 09:00 UTC" {
+		t.Fatalf("expected next window remediation, got %v", res)
 	}
 }
 
@@ -25,3 +38,26 @@ func TestSuggestNone(t *testing.T) {
 		t.Fatalf("expected no remediation, got %v", res)
 	}
 }
+
+func TestAdvise(t *testing.T) {
+	res := Advise(map[string]string{"auth.methods": "pwd", "next_window": "2025-01-07T09:00:00Z"})
+	if len(res) != 2 || res[0].Code != StepUp || res[0].Params["required_acr"] != "mfa" {
+		t.Fatalf("expected a step-up action, got %+v", res)
+	}
+	if res[1].Code != RetryAfter || res[1].Params["not_before"] != "2025-01-07T09:00:00Z" {
+		t.Fatalf("expected a retry action, got %+v", res[1])
+	}
+}
+
+func TestActionMessage(t *testing.T) {
+	a := Action{Code: StepUp, Messages: map[string]string{"en": "Sign in with MFA", "de": "Mit MFA anmelden"}}
+	if m := a.Message("de"); m != "Mit MFA anmelden" {
+		t.Fatalf("expected the German message, got %q", m)
+	}
+	if m := a.Message("fr"); m != "Sign in with MFA" {
+		t.Fatalf("expected the default locale, got %q", m)
+	}
+	if m := (Action{Code: StepUp}).Message("en"); m != StepUp {
+		t.Fatalf("expected the code without messages, got %q", m)
+	}
+}
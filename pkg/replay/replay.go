@@ -0,0 +1,236 @@
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/bradtumy/authorization-service/pkg/policy"
+)
+
+// Record is a historical access request and, when known, the decision that was
+// returned for it.
+type Record struct {
+	TenantID string
+	Subject  string
+	Resource string
+	Action   string
+	Decision string
+	PolicyID string
+	Context  map[string]string
+}
+
+// line accepts both audit log entries and raw /check-access request bodies.
+type line struct {
+	TenantID   string            `json:"tenant_id"`
+	TenantID2  string            `json:"tenantID"`
+	Subject    string            `json:"subject"`
+	Resource   string            `json:"resource"`
+	Action     string            `json:"action"`
+	Decision   string            `json:"decision"`
+	PolicyID   string            `json:"policy_id"`
+	Context    map[string]string `json:"context"`
+	Conditions map[string]string `json:"conditions"`
+	Shadow     bool              `json:"shadow"`
+}
+
+// ReadLog parses JSON lines into records. Audit entries that are not access
+// decisions (reloads, tenant management, shadow evaluations) are skipped.
+func ReadLog(r io.Reader) ([]Record, error) {
+	var out []Record
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	n := 0
+	for sc.Scan() {
+		n++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		var l line
+		if err := json.Unmarshal([]byte(text), &l); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if l.Shadow || l.Subject == "" || l.Resource == "" || l.Action == "" {
+			continue
+		}
+		if l.Decision != "" && l.Decision != "allow" && l.Decision != "deny" {
+			continue
+		}
+		rec := Record{
+			TenantID: l.TenantID,
+			Subject:  l.Subject,
+			Resource: l.Resource,
+			Action:   l.Action,
+			Decision: l.Decision,
+			PolicyID: l.PolicyID,
+			Context:  l.Context,
+		}
+		if rec.TenantID == "" {
+			rec.TenantID = l.TenantID2
+		}
+		if rec.Context == nil {
+			rec.Context = l.Conditions
+		}
+		out = append(out, rec)
+	}
+	return out, sc.Err()
+}
+
+// Flip describes a request whose outcome changes under the candidate policies.
+type Flip struct {
+	TenantID  string `json:"tenantID,omitempty"`
+	Subject   string `json:"subject"`
+	Resource  string `json:"resource"`
+	Action    string `json:"action"`
+	Before    string `json:"before"`
+	After     string `json:"after"`
+	OldPolicy string `json:"old_policy,omitempty"`
+	NewPolicy string `json:"new_policy,omitempty"`
+	Reason    string `json:"reason"`
+}
+
+// Counts tallies flips in each direction.
+type Counts struct {
+	AllowToDeny int `json:"allow_to_deny"`
+	DenyToAllow int `json:"deny_to_allow"`
+}
+
+// Report summarises the impact of a candidate policy set. Insufficient counts
+// records that were denied on a condition whose key the record's context
+// lacks, so their outcome under the candidate is unknown.
+type Report struct {
+	Total        int               `json:"total"`
+	Skipped      int               `json:"skipped"`
+	Insufficient int               `json:"insufficient_context"`
+	Unchanged    int               `json:"unchanged"`
+	AllowToDeny  []Flip            `json:"allow_to_deny"`
+	DenyToAllow  []Flip            `json:"deny_to_allow"`
+	ByPolicy     map[string]Counts `json:"by_policy"`
+	BySubject    map[string]Counts `json:"by_subject"`
+}
+
+// Run re-evaluates records against candidate. The baseline outcome is the
+// recorded decision; records without one are evaluated against baseline, or
+// skipped when baseline is nil. Records that either evaluation denies for lack
+// of context are counted as insufficient rather than compared. Flips are
+// attributed to the candidate's deciding policy, or the previous one when no
+// candidate policy matched.
+func Run(candidate, baseline *policy.PolicyEngine, records []Record) Report {
+	rep := Report{
+		AllowToDeny: []Flip{},
+		DenyToAllow: []Flip{},
+		ByPolicy:    map[string]Counts{},
+		BySubject:   map[string]Counts{},
+	}
+	for _, rec := range records {
+		rep.Total++
+		env := make(map[string]string, len(rec.Context)+1)
+		for k, v := range rec.Context {
+			env[k] = v
+		}
+		if rec.TenantID != "" {
+			env["tenantID"] = rec.TenantID
+		}
+		before, oldPolicy := rec.Decision, rec.PolicyID
+		if before == "" {
+			if baseline == nil {
+				rep.Skipped++
+				continue
+			}
+			dec := baseline.Evaluate(rec.Subject, rec.Resource, rec.Action, env)
+			if missingContext(dec, env) {
+				rep.Insufficient++
+				continue
+			}
+			before, oldPolicy = status(dec.Allow), dec.PolicyID
+		}
+		dec := candidate.Evaluate(rec.Subject, rec.Resource, rec.Action, env)
+		if missingContext(dec, env) {
+			rep.Insufficient++
+			continue
+		}
+		after := status(dec.Allow)
+		if after == before {
+			rep.Unchanged++
+			continue
+		}
+		f := Flip{
+			TenantID:  rec.TenantID,
+			Subject:   rec.Subject,
+			Resource:  rec.Resource,
+			Action:    rec.Action,
+			Before:    before,
+			After:     after,
+			OldPolicy: oldPolicy,
+			NewPolicy: dec.PolicyID,
+			Reason:    dec.Reason,
+		}
+		key := f.NewPolicy
+		if key == "" {
+			key = f.OldPolicy
+		}
+		if key == "" {
+			key = "none"
+		}
+		pc, sc := rep.ByPolicy[key], rep.BySubject[f.Subject]
+		if before == "allow" {
+			rep.AllowToDeny = append(rep.AllowToDeny, f)
+			pc.AllowToDeny++
+			sc.AllowToDeny++
+		} else {
+			rep.DenyToAllow = append(rep.DenyToAllow, f)
+			pc.DenyToAllow++
+			sc.DenyToAllow++
+		}
+		rep.ByPolicy[key], rep.BySubject[f.Subject] = pc, sc
+	}
+	return rep
+}
+
+// missingContext reports whether dec is a denial on a condition whose key env
+// lacks. The engine names the failed condition's key as the reason.
+func missingContext(dec policy.Decision, env map[string]string) bool {
+	if dec.Allow || dec.PolicyID == "" || dec.Reason == "denied by policy" {
+		return false
+	}
+	_, ok := env[dec.Reason]
+	return !ok
+}
+
+// WriteText prints a human-readable summary of the report.
+func (r Report) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "replayed %d requests: %d unchanged, %d allow->deny, %d deny->allow, %d skipped, %d insufficient context\n",
+		r.Total, r.Unchanged, len(r.AllowToDeny), len(r.DenyToAllow), r.Skipped, r.Insufficient)
+	writeGroup(w, "by policy", r.ByPolicy)
+	writeGroup(w, "by subject", r.BySubject)
+	for _, f := range append(append([]Flip{}, r.AllowToDeny...), r.DenyToAllow...) {
+		fmt.Fprintf(w, "  %s -> %s  %s %s %s (policy %q -> %q: %s)\n",
+			f.Before, f.After, f.Subject, f.Action, f.Resource, f.OldPolicy, f.NewPolicy, f.Reason)
+	}
+}
+
+func writeGroup(w io.Writer, title string, m map[string]Counts) {
+	if len(m) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(w, "%s:\n", title)
+	for _, k := range keys {
+		fmt.Fprintf(w, "  %-24s allow->deny %d  deny->allow %d\n", k, m[k].AllowToDeny, m[k].DenyToAllow)
+	}
+}
+
+func status(allow bool) string {
+	if allow {
+		return "allow"
+	}
+	return "deny"
+}
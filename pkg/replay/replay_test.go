@@ -0,0 +1,76 @@
+package replay
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bradtumy/authorization-service/pkg/graph"
+	"github.com/bradtumy/authorization-service/pkg/policy"
+)
+
+func TestRunReportsFlips(t *testing.T) {
+	log := strings.Join([]string{
+		`{"level":"info","tenant_id":"default","subject":"alice","action":"read","resource":"file1","decision":"allow","policy_id":"p1"}`,
+		`{"level":"info","tenant_id":"default","subject":"bob","action":"write","resource":"file1","decision":"deny","reason":"no matching policy"}`,
+		`{"level":"info","tenant_id":"default","subject":"alice","action":"read","resource":"file2","decision":"allow","policy_id":"p1"}`,
+		`{"level":"info","tenant_id":"default","action":"reload","resource":"configs/policies.yaml","decision":"success"}`,
+		`{"tenantID":"default","subject":"carol","resource":"file1","action":"read","conditions":{}}`,
+	}, "\n")
+	records, err := ReadLog(strings.NewReader(log))
+	if err != nil {
+		t.Fatalf("ReadLog: %v", err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("expected 4 access records, got %d", len(records))
+	}
+
+	st := policy.NewPolicyStore()
+	st.Roles["reader"] = policy.Role{Name: "reader", Policies: []string{"p1"}}
+	st.Roles["writer"] = policy.Role{Name: "writer", Policies: []string{"p2"}}
+	st.Users["alice"] = policy.User{Username: "alice", Roles: []string{"reader"}}
+	st.Users["bob"] = policy.User{Username: "bob", Roles: []string{"writer"}}
+	st.Policies["p1"] = policy.Policy{ID: "p1", Resource: []string{"file2"}, Action: []string{"read"}, Effect: "allow"}
+	st.Policies["p2"] = policy.Policy{ID: "p2", Resource: []string{"*"}, Action: []string{"write"}, Effect: "allow"}
+	candidate := policy.NewPolicyEngine(st, graph.New())
+
+	rep := Run(candidate, nil, records)
+	if rep.Total != 4 || rep.Skipped != 1 || rep.Unchanged != 1 {
+		t.Fatalf("unexpected totals %+v", rep)
+	}
+	if len(rep.AllowToDeny) != 1 || rep.AllowToDeny[0].Resource != "file1" {
+		t.Fatalf("expected alice/file1 to flip to deny, got %+v", rep.AllowToDeny)
+	}
+	if len(rep.DenyToAllow) != 1 || rep.DenyToAllow[0].NewPolicy != "p2" {
+		t.Fatalf("expected bob to flip to allow via p2, got %+v", rep.DenyToAllow)
+	}
+	if rep.ByPolicy["p1"].AllowToDeny != 1 || rep.BySubject["bob"].DenyToAllow != 1 {
+		t.Fatalf("unexpected grouping %+v %+v", rep.ByPolicy, rep.BySubject)
+	}
+}
+
+func TestRunInsufficientContext(t *testing.T) {
+	log := strings.Join([]string{
+		`{"tenant_id":"default","subject":"alice","action":"read","resource":"file1","decision":"allow","policy_id":"p1"}`,
+		`{"tenant_id":"default","subject":"alice","action":"read","resource":"file1","decision":"allow","policy_id":"p1","context":{"ip":"192.0.2.1"}}`,
+		`{"tenantID":"default","subject":"alice","resource":"file1","action":"read","conditions":{}}`,
+	}, "\n")
+	records, err := ReadLog(strings.NewReader(log))
+	if err != nil {
+		t.Fatalf("ReadLog: %v", err)
+	}
+	st := policy.NewPolicyStore()
+	st.Roles["reader"] = policy.Role{Name: "reader", Policies: []string{"p1"}}
+	st.Users["alice"] = policy.User{Username: "alice", Roles: []string{"reader"}}
+	st.Policies["p1"] = policy.Policy{ID: "p1", Resource: []string{"file1"}, Action: []string{"read"}, Effect: "allow", When: []string{`context.ip in cidr("10.0.0.0/8")`}}
+	engine := policy.NewPolicyEngine(st, graph.New())
+
+	// Without the ip neither the recorded nor the baseline outcome can be
+	// compared; with it, the candidate's denial is a real flip.
+	rep := Run(engine, engine, records)
+	if rep.Total != 3 || rep.Insufficient != 2 || len(rep.AllowToDeny) != 1 {
+		t.Fatalf("unexpected report %+v", rep)
+	}
+	if rep.ByPolicy["p1"].AllowToDeny != 1 {
+		t.Fatalf("expected only the complete record to count, got %+v", rep.ByPolicy)
+	}
+}
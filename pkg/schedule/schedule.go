@@ -0,0 +1,274 @@
+// Package schedule evaluates recurring time windows such as
+// "Mon-Fri 08:00-18:00 America/Chicago", optionally restricted by holiday
+// calendars and a date range.
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// Spec is the declarative form of a schedule as written in policy files.
+type Spec struct {
+	// Days lists weekdays such as "Mon-Fri" or "Sat,Sun"; empty means every day.
+	Days string `yaml:"days,omitempty" json:"days,omitempty"`
+	// Hours is a daily window "HH:MM-HH:MM"; empty means all day. An end
+	// before the start spans midnight.
+	Hours string `yaml:"hours,omitempty" json:"hours,omitempty"`
+	// Timezone is an IANA name such as "America/Chicago"; empty means UTC.
+	Timezone string `yaml:"timezone,omitempty" json:"timezone,omitempty"`
+	// Holidays lists dates (YYYY-MM-DD) or names of calendars whose dates are
+	// excluded.
+	Holidays []string `yaml:"holidays,omitempty" json:"holidays,omitempty"`
+	// NotBefore and NotAfter bound the schedule by date (YYYY-MM-DD, the whole
+	// day inclusive) or instant (RFC 3339).
+	NotBefore string `yaml:"not_before,omitempty" json:"not_before,omitempty"`
+	NotAfter  string `yaml:"not_after,omitempty" json:"not_after,omitempty"`
+}
+
+// Schedule is a compiled Spec.
+type Schedule struct {
+	spec      Spec
+	loc       *time.Location
+	days      [7]bool
+	start     int // minutes after midnight
+	end       int // minutes after midnight, exclusive
+	holidays  map[string]bool
+	notBefore time.Time
+	notAfter  time.Time
+}
+
+// BusinessHours is the default "business-hours" window, 09:00-17:00 every day
+// in the server's local time. Tenants override it by defining a schedule of
+// the same name.
+var BusinessHours = mustParse("09:00-17:00 Local")
+
+var hoursRe = regexp.MustCompile(`^(\d{2}):(\d{2})-(\d{2}):(\d{2})$`)
+
+var dayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Parse compiles an inline schedule made of space-separated days, hours and
+// timezone tokens in any order, e.g. "Mon-Fri 08:00-18:00 America/Chicago".
+func Parse(text string) (*Schedule, error) {
+	var spec Spec
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty schedule")
+	}
+	for _, f := range fields {
+		switch {
+		case hoursRe.MatchString(f):
+			spec.Hours = f
+		case strings.Contains(f, "/") || f == "UTC" || f == "Local":
+			spec.Timezone = f
+		default:
+			if _, err := parseDays(f); err != nil {
+				return nil, fmt.Errorf("schedule %q: unrecognised %q", text, f)
+			}
+			spec.Days = f
+		}
+	}
+	return spec.Compile(nil)
+}
+
+func mustParse(text string) *Schedule {
+	s, err := Parse(text)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Compile validates the spec and resolves holiday calendar names against
+// calendars.
+func (sp Spec) Compile(calendars map[string][]string) (*Schedule, error) {
+	s := &Schedule{spec: sp, loc: time.UTC, end: 24 * 60, holidays: map[string]bool{}}
+	if sp.Timezone != "" {
+		loc, err := time.LoadLocation(sp.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("unknown timezone %q", sp.Timezone)
+		}
+		s.loc = loc
+	}
+	days, err := parseDays(sp.Days)
+	if err != nil {
+		return nil, err
+	}
+	s.days = days
+	if sp.Hours != "" {
+		m := hoursRe.FindStringSubmatch(sp.Hours)
+		if m == nil {
+			return nil, fmt.Errorf("hours %q must be HH:MM-HH:MM", sp.Hours)
+		}
+		if s.start, err = minutes(m[1], m[2]); err != nil {
+			return nil, err
+		}
+		if s.end, err = minutes(m[3], m[4]); err != nil {
+			return nil, err
+		}
+		if s.start == s.end {
+			return nil, fmt.Errorf("hours %q is an empty window", sp.Hours)
+		}
+	}
+	for _, h := range sp.Holidays {
+		dates := []string{h}
+		if cal, ok := calendars[h]; ok {
+			dates = cal
+		}
+		for _, d := range dates {
+			if _, err := time.Parse(dateLayout, d); err != nil {
+				return nil, fmt.Errorf("holiday %q is neither a date nor a known calendar", d)
+			}
+			s.holidays[d] = true
+		}
+	}
+	if sp.NotBefore != "" {
+		if s.notBefore, err = bound(sp.NotBefore, s.loc, false); err != nil {
+			return nil, err
+		}
+	}
+	if sp.NotAfter != "" {
+		if s.notAfter, err = bound(sp.NotAfter, s.loc, true); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func parseDays(text string) ([7]bool, error) {
+	var days [7]bool
+	if text == "" {
+		for i := range days {
+			days[i] = true
+		}
+		return days, nil
+	}
+	for _, part := range strings.Split(strings.ToLower(text), ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		start, ok := dayNames[from]
+		if !ok {
+			return days, fmt.Errorf("unknown day %q", from)
+		}
+		end := start
+		if isRange {
+			if end, ok = dayNames[to]; !ok {
+				return days, fmt.Errorf("unknown day %q", to)
+			}
+		}
+		// Ranges may wrap around the week, e.g. Fri-Mon.
+		for d := start; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == end {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+func minutes(h, m string) (int, error) {
+	hh, _ := strconv.Atoi(h)
+	mm, _ := strconv.Atoi(m)
+	if hh > 24 || mm > 59 || (hh == 24 && mm != 0) {
+		return 0, fmt.Errorf("invalid time %s:%s", h, m)
+	}
+	return hh*60 + mm, nil
+}
+
+// bound parses a date or RFC 3339 instant. Dates used as an upper bound cover
+// the whole day.
+func bound(v string, loc *time.Location, upper bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseInLocation(dateLayout, v, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("date %q must be YYYY-MM-DD or RFC 3339", v)
+	}
+	if upper {
+		d = d.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return d, nil
+}
+
+// Location returns the timezone the schedule is evaluated in.
+func (s *Schedule) Location() *time.Location {
+	return s.loc
+}
+
+// Contains reports whether t falls inside the schedule.
+func (s *Schedule) Contains(t time.Time) bool {
+	if !s.notBefore.IsZero() && t.Before(s.notBefore) {
+		return false
+	}
+	if !s.notAfter.IsZero() && t.After(s.notAfter) {
+		return false
+	}
+	t = t.In(s.loc)
+	if s.holidays[t.Format(dateLayout)] {
+		return false
+	}
+	m := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	if s.start < s.end {
+		return s.days[day] && m >= s.start && m < s.end
+	}
+	// Overnight windows belong to the day they start on.
+	return (s.days[day] && m >= s.start) || (s.days[(day+6)%7] && m < s.end)
+}
+
+// Next returns the earliest instant at or after t inside the schedule. It
+// returns false when the schedule never opens again within a year or has
+// ended.
+func (s *Schedule) Next(t time.Time) (time.Time, bool) {
+	if !s.notBefore.IsZero() && t.Before(s.notBefore) {
+		t = s.notBefore
+	}
+	if s.Contains(t) {
+		return t, true
+	}
+	local := t.In(s.loc)
+	for i := 0; i <= 366; i++ {
+		d := local.AddDate(0, 0, i)
+		c := time.Date(d.Year(), d.Month(), d.Day(), s.start/60, s.start%60, 0, 0, s.loc)
+		if c.Before(t) {
+			continue
+		}
+		if !s.notAfter.IsZero() && c.After(s.notAfter) {
+			return time.Time{}, false
+		}
+		if s.Contains(c) {
+			return c, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// String returns the inline form of the schedule's days, hours and timezone.
+func (s *Schedule) String() string {
+	var parts []string
+	for _, p := range []string{s.spec.Days, s.spec.Hours, s.spec.Timezone} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// MarshalJSON encodes the spec together with its resolved holiday dates so
+// that changes to a referenced calendar alter the encoding.
+func (s *Schedule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Spec
+		Dates map[string]bool `json:"dates,omitempty"`
+	}{s.spec, s.holidays})
+}
@@ -0,0 +1,64 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseContains(t *testing.T) {
+	s, err := Parse("Mon-Fri 08:00-18:00 America/Chicago")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	chicago, _ := time.LoadLocation("America/Chicago")
+	cases := map[time.Time]bool{
+		time.Date(2025, 1, 6, 8, 0, 0, 0, chicago):    true,  // Monday opening
+		time.Date(2025, 1, 6, 18, 0, 0, 0, chicago):   false, // end is exclusive
+		time.Date(2025, 1, 4, 12, 0, 0, 0, chicago):   false, // Saturday
+		time.Date(2025, 1, 6, 15, 30, 0, 0, time.UTC): true,  // 09:30 in Chicago
+	}
+	for at, want := range cases {
+		if got := s.Contains(at); got != want {
+			t.Errorf("Contains(%s) = %v, want %v", at, got, want)
+		}
+	}
+	if _, err := Parse("Mon-Fri 8am"); err == nil {
+		t.Fatalf("expected error for unrecognised token")
+	}
+}
+
+func TestNextSkipsHolidaysAndWeekends(t *testing.T) {
+	spec := Spec{Days: "Mon-Fri", Hours: "09:00-17:00", Holidays: []string{"us"}}
+	s, err := spec.Compile(map[string][]string{"us": {"2025-01-06"}})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	// Friday evening: the weekend and the Monday holiday are skipped.
+	next, ok := s.Next(time.Date(2025, 1, 3, 20, 0, 0, 0, time.UTC))
+	if !ok || !next.Equal(time.Date(2025, 1, 7, 9, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected next window %s %v", next, ok)
+	}
+	if _, err := (Spec{Holidays: []string{"unknown"}}).Compile(nil); err == nil {
+		t.Fatalf("expected error for unknown calendar")
+	}
+}
+
+func TestDateBoundsAndOvernight(t *testing.T) {
+	s, err := Spec{Hours: "22:00-06:00", NotBefore: "2025-03-01", NotAfter: "2025-03-31"}.Compile(nil)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	if !s.Contains(time.Date(2025, 3, 10, 2, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected 02:00 inside the overnight window")
+	}
+	if s.Contains(time.Date(2025, 4, 1, 2, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the schedule to end after not_after")
+	}
+	next, ok := s.Next(time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC))
+	if !ok || !next.Equal(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the schedule to open at not_before, got %s", next)
+	}
+	if _, ok := s.Next(time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)); ok {
+		t.Fatalf("expected no window once the schedule has ended")
+	}
+}
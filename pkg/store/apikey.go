@@ -0,0 +1,53 @@
+package store
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/bradtumy/authorization-service/pkg/apikey"
+)
+
+const apiKeyColumns = `id, tenant_id, name, hash, endpoints, created_at, created_by, expires_at, revoked_at, rotated_from`
+
+// scanAPIKey reads a row of apiKeyColumns. Times are stored as Unix seconds,
+// zero for unset ones.
+func scanAPIKey(row interface{ Scan(...any) error }) (apikey.Key, error) {
+	var k apikey.Key
+	var endpoints string
+	var created, expires, revoked int64
+	if err := row.Scan(&k.ID, &k.TenantID, &k.Name, &k.Hash, &endpoints, &created, &k.CreatedBy, &expires, &revoked, &k.RotatedFrom); err != nil {
+		return apikey.Key{}, err
+	}
+	if err := json.Unmarshal([]byte(endpoints), &k.Endpoints); err != nil {
+		return apikey.Key{}, err
+	}
+	k.CreatedAt = time.Unix(created, 0).UTC()
+	k.ExpiresAt = timeOrZero(expires)
+	k.RevokedAt = timeOrZero(revoked)
+	return k, nil
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func timeOrZero(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0).UTC()
+}
+
+// sortAPIKeys orders keys by creation, oldest first.
+func sortAPIKeys(keys []apikey.Key) {
+	sort.SliceStable(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"sync"
 
+	"github.com/bradtumy/authorization-service/pkg/apikey"
 	"github.com/bradtumy/authorization-service/pkg/policy"
 	"github.com/bradtumy/authorization-service/pkg/tenant"
 )
@@ -15,6 +16,7 @@ type MemoryStore struct {
 	tenants  map[string]tenant.Tenant
 	policies map[string]map[string]policy.Policy       // tenantID -> policyID -> policy
 	edges    map[string]map[string]map[string]struct{} // tenantID -> src -> dst set
+	apiKeys  map[string]apikey.Key                     // keyID -> key
 }
 
 // NewMemory returns a new MemoryStore instance.
@@ -23,6 +25,7 @@ func NewMemory() *MemoryStore {
 		tenants:  make(map[string]tenant.Tenant),
 		policies: make(map[string]map[string]policy.Policy),
 		edges:    make(map[string]map[string]map[string]struct{}),
+		apiKeys:  make(map[string]apikey.Key),
 	}
 }
 
@@ -59,6 +62,11 @@ func (m *MemoryStore) DeleteTenant(ctx context.Context, id string) error {
 	delete(m.tenants, id)
 	delete(m.policies, id)
 	delete(m.edges, id)
+	for kid, k := range m.apiKeys {
+		if k.TenantID == id {
+			delete(m.apiKeys, kid)
+		}
+	}
 	return nil
 }
 
@@ -122,3 +130,34 @@ func (m *MemoryStore) ClearEdges(ctx context.Context, tenantID string) error {
 	delete(m.edges, tenantID)
 	return nil
 }
+
+func (m *MemoryStore) SaveAPIKey(ctx context.Context, k apikey.Key) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k.Endpoints = append([]string{}, k.Endpoints...)
+	m.apiKeys[k.ID] = k
+	return nil
+}
+
+func (m *MemoryStore) LoadAPIKey(ctx context.Context, id string) (apikey.Key, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	k, ok := m.apiKeys[id]
+	if !ok {
+		return apikey.Key{}, ErrAPIKeyNotFound
+	}
+	return k, nil
+}
+
+func (m *MemoryStore) ListAPIKeys(ctx context.Context, tenantID string) ([]apikey.Key, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := []apikey.Key{}
+	for _, k := range m.apiKeys {
+		if k.TenantID == tenantID {
+			out = append(out, k)
+		}
+	}
+	sortAPIKeys(out)
+	return out, nil
+}
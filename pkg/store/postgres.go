@@ -9,6 +9,7 @@ import (
 
 	_ "github.com/lib/pq"
 
+	"github.com/bradtumy/authorization-service/pkg/apikey"
 	"github.com/bradtumy/authorization-service/pkg/policy"
 	"github.com/bradtumy/authorization-service/pkg/tenant"
 )
@@ -75,7 +76,10 @@ func (s *PostgresStore) DeleteTenant(ctx context.Context, id string) error {
 	if _, err := s.db.ExecContext(ctx, `DELETE FROM policies WHERE tenant_id=$1`, id); err != nil {
 		return err
 	}
-	_, err := s.db.ExecContext(ctx, `DELETE FROM edges WHERE tenant_id=$1`, id)
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM edges WHERE tenant_id=$1`, id); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `DELETE FROM api_keys WHERE tenant_id=$1`, id)
 	return err
 }
 
@@ -146,3 +150,45 @@ func (s *PostgresStore) ClearEdges(ctx context.Context, tenantID string) error {
 	_, err := s.db.ExecContext(ctx, `DELETE FROM edges WHERE tenant_id=$1`, tenantID)
 	return err
 }
+
+func (s *PostgresStore) SaveAPIKey(ctx context.Context, k apikey.Key) error {
+	endpoints, err := json.Marshal(k.Endpoints)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO api_keys(id, tenant_id, name, hash, endpoints, created_at, created_by, expires_at, revoked_at, rotated_from)
+         VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
+         ON CONFLICT(id) DO UPDATE SET name=EXCLUDED.name, endpoints=EXCLUDED.endpoints,
+         expires_at=EXCLUDED.expires_at, revoked_at=EXCLUDED.revoked_at`,
+		k.ID, k.TenantID, k.Name, k.Hash, string(endpoints), k.CreatedAt.Unix(), k.CreatedBy,
+		unixOrZero(k.ExpiresAt), unixOrZero(k.RevokedAt), k.RotatedFrom)
+	return err
+}
+
+func (s *PostgresStore) LoadAPIKey(ctx context.Context, id string) (apikey.Key, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id=$1`, id)
+	k, err := scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return apikey.Key{}, ErrAPIKeyNotFound
+	}
+	return k, err
+}
+
+func (s *PostgresStore) ListAPIKeys(ctx context.Context, tenantID string) ([]apikey.Key, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE tenant_id=$1`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []apikey.Key{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, k)
+	}
+	sortAPIKeys(out)
+	return out, rows.Err()
+}
@@ -9,6 +9,7 @@ import (
 
 	_ "github.com/mattn/go-sqlite3"
 
+	"github.com/bradtumy/authorization-service/pkg/apikey"
 	"github.com/bradtumy/authorization-service/pkg/policy"
 	"github.com/bradtumy/authorization-service/pkg/tenant"
 )
@@ -75,6 +76,10 @@ func (s *SQLiteStore) DeleteTenant(ctx context.Context, id string) error {
 		return err
 	}
 	_, err = s.db.ExecContext(ctx, `DELETE FROM edges WHERE tenant_id=?`, id)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `DELETE FROM api_keys WHERE tenant_id=?`, id)
 	return err
 }
 
@@ -139,3 +144,42 @@ func (s *SQLiteStore) ClearEdges(ctx context.Context, tenantID string) error {
 	_, err := s.db.ExecContext(ctx, `DELETE FROM edges WHERE tenant_id=?`, tenantID)
 	return err
 }
+
+func (s *SQLiteStore) SaveAPIKey(ctx context.Context, k apikey.Key) error {
+	endpoints, err := json.Marshal(k.Endpoints)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO api_keys(id, tenant_id, name, hash, endpoints, created_at, created_by, expires_at, revoked_at, rotated_from) VALUES(?,?,?,?,?,?,?,?,?,?)`,
+		k.ID, k.TenantID, k.Name, k.Hash, string(endpoints), k.CreatedAt.Unix(), k.CreatedBy,
+		unixOrZero(k.ExpiresAt), unixOrZero(k.RevokedAt), k.RotatedFrom)
+	return err
+}
+
+func (s *SQLiteStore) LoadAPIKey(ctx context.Context, id string) (apikey.Key, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id=?`, id)
+	k, err := scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return apikey.Key{}, ErrAPIKeyNotFound
+	}
+	return k, err
+}
+
+func (s *SQLiteStore) ListAPIKeys(ctx context.Context, tenantID string) ([]apikey.Key, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE tenant_id=?`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []apikey.Key{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, k)
+	}
+	sortAPIKeys(out)
+	return out, rows.Err()
+}
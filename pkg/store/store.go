@@ -2,7 +2,9 @@ package store
 
 import (
 	"context"
+	"errors"
 
+	"github.com/bradtumy/authorization-service/pkg/apikey"
 	"github.com/bradtumy/authorization-service/pkg/policy"
 	"github.com/bradtumy/authorization-service/pkg/tenant"
 )
@@ -13,7 +15,8 @@ type Edge struct {
 	Dst string
 }
 
-// Store defines operations for persisting tenants, policies and graph edges.
+// Store defines operations for persisting tenants, policies, graph edges and
+// API keys.
 type Store interface {
 	SaveTenant(ctx context.Context, t tenant.Tenant) error
 	LoadTenant(ctx context.Context, id string) (tenant.Tenant, error)
@@ -27,4 +30,12 @@ type Store interface {
 	SaveEdge(ctx context.Context, tenantID, src, dst string) error
 	LoadEdges(ctx context.Context, tenantID string) ([]Edge, error)
 	ClearEdges(ctx context.Context, tenantID string) error
+
+	// SaveAPIKey creates or replaces the key with k's ID.
+	SaveAPIKey(ctx context.Context, k apikey.Key) error
+	LoadAPIKey(ctx context.Context, id string) (apikey.Key, error)
+	ListAPIKeys(ctx context.Context, tenantID string) ([]apikey.Key, error)
 }
+
+// ErrAPIKeyNotFound is returned by LoadAPIKey for unknown keys.
+var ErrAPIKeyNotFound = errors.New("api key not found")
@@ -2,10 +2,12 @@ package store
 
 import (
 	"context"
+	"errors"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/bradtumy/authorization-service/pkg/apikey"
 	"github.com/bradtumy/authorization-service/pkg/policy"
 	"github.com/bradtumy/authorization-service/pkg/tenant"
 )
@@ -39,12 +41,34 @@ func runStoreTests(t *testing.T, s Store) {
 	if err != nil || len(edges) != 1 {
 		t.Fatalf("LoadEdges: %v", err)
 	}
+	_, key, err := apikey.Generate("t1", "svc", nil)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	key.ExpiresAt = time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	if err := s.SaveAPIKey(ctx, key); err != nil {
+		t.Fatalf("SaveAPIKey: %v", err)
+	}
+	key.RevokedAt = time.Now().UTC().Truncate(time.Second)
+	if err := s.SaveAPIKey(ctx, key); err != nil {
+		t.Fatalf("SaveAPIKey revoke: %v", err)
+	}
+	gotKey, err := s.LoadAPIKey(ctx, key.ID)
+	if err != nil || gotKey.Hash != key.Hash || gotKey.TenantID != "t1" || !gotKey.ExpiresAt.Equal(key.ExpiresAt) || !gotKey.RevokedAt.Equal(key.RevokedAt) || len(gotKey.Endpoints) != 1 {
+		t.Fatalf("LoadAPIKey: %+v %v", gotKey, err)
+	}
+	if keys, err := s.ListAPIKeys(ctx, "t1"); err != nil || len(keys) != 1 {
+		t.Fatalf("ListAPIKeys: %v %v", keys, err)
+	}
 	if err := s.DeleteTenant(ctx, "t1"); err != nil {
 		t.Fatalf("DeleteTenant: %v", err)
 	}
 	if _, err := s.LoadTenant(ctx, "t1"); err == nil {
 		t.Fatalf("expected error after delete")
 	}
+	if _, err := s.LoadAPIKey(ctx, key.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Fatalf("expected the tenant's keys to be deleted, got %v", err)
+	}
 }
 
 func TestMemoryStore(t *testing.T) {
@@ -70,5 +94,12 @@ func TestSQLiteStore(t *testing.T) {
 	if err != nil {
 		t.Fatalf("migrate edges: %v", err)
 	}
+	mig, err := os.ReadFile("../../migrations/002_api_keys.sql")
+	if err != nil {
+		t.Fatalf("read migration: %v", err)
+	}
+	if _, err := s.db.Exec(string(mig)); err != nil {
+		t.Fatalf("migrate api keys: %v", err)
+	}
 	runStoreTests(t, s)
 }
@@ -0,0 +1,23 @@
+package validator
+
+import "fmt"
+
+// Severity levels reported with findings.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Finding describes a problem at a position in a policy file.
+type Finding struct {
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Code     string `json:"code"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// String formats the finding in compiler style without a file name.
+func (f Finding) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s [%s]", f.Line, f.Column, f.Severity, f.Message, f.Code)
+}
@@ -3,23 +3,42 @@ package validator
 import (
 	"fmt"
 	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
 
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
+
+	"github.com/bradtumy/authorization-service/pkg/network"
+	"github.com/bradtumy/authorization-service/pkg/schedule"
 )
 
 // Config represents the structure of the policy file.
 type role struct {
 	Name     string   `yaml:"name"`
 	Policies []string `yaml:"policies"`
+	node     *yaml.Node
 }
 
 type subject struct {
 	Role string `yaml:"role"`
+	node *yaml.Node
 }
 
 type user struct {
 	Username string   `yaml:"username"`
 	Roles    []string `yaml:"roles"`
+	node     *yaml.Node
+}
+
+type obligation struct {
+	Code     string            `yaml:"code"`
+	Params   map[string]string `yaml:"params"`
+	Messages map[string]string `yaml:"messages"`
+	On       string            `yaml:"on"`
+	node     *yaml.Node
 }
 
 type policy struct {
@@ -31,54 +50,534 @@ type policy struct {
 	Effect      string            `yaml:"effect"`
 	Conditions  map[string]string `yaml:"conditions"`
 	When        []string          `yaml:"when"`
+	Obligations []obligation      `yaml:"obligations"`
+	Advice      []obligation      `yaml:"advice"`
+	node        *yaml.Node
+}
+
+type remediationRule struct {
+	ID          string       `yaml:"id"`
+	Policies    []string     `yaml:"policies"`
+	Conditions  []string     `yaml:"conditions"`
+	When        []string     `yaml:"when"`
+	If          []string     `yaml:"if"`
+	Obligations []obligation `yaml:"obligations"`
+	Advice      []obligation `yaml:"advice"`
+	node        *yaml.Node
 }
 
 // Config represents the structure of the policy file.
 type Config struct {
-	Roles    []role   `yaml:"roles"`
-	Users    []user   `yaml:"users"`
-	Policies []policy `yaml:"policies"`
+	Roles     []role                   `yaml:"roles"`
+	Users     []user                   `yaml:"users"`
+	Policies  []policy                 `yaml:"policies"`
+	Schedules map[string]schedule.Spec `yaml:"schedules"`
+	Calendars map[string][]string      `yaml:"calendars"`
+	Zones     map[string][]string      `yaml:"zones"`
+	// Remediation holds the remediation rules of the file.
+	Remediation []remediationRule `yaml:"remediation"`
+	// scheduleNodes holds the key node of each named schedule.
+	scheduleNodes map[string]*yaml.Node
+	// zoneNodes holds the sequence node of each named zone.
+	zoneNodes map[string]*yaml.Node
 }
 
-// ValidateConfig performs schema validation on the provided configuration.
-func ValidateConfig(cfg *Config) error {
+// Errors is returned when validation finds one or more errors.
+type Errors []Finding
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, f := range e {
+		if f.Line > 0 {
+			msgs[i] = fmt.Sprintf("line %d: %s", f.Line, f.Message)
+		} else {
+			msgs[i] = f.Message
+		}
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// shape is the expected YAML form of a field.
+type shape int
+
+const (
+	scalar shape = iota
+	scalarList
+	scalarMap
+	entryList
+	entryMap
+	listMap
+)
+
+var (
+	topFields = map[string]shape{
+		"roles":       entryList,
+		"users":       entryList,
+		"policies":    entryList,
+		"schedules":   entryMap,
+		"calendars":   listMap,
+		"zones":       listMap,
+		"remediation": entryList,
+	}
+	scheduleFields = map[string]shape{
+		"days":       scalar,
+		"hours":      scalar,
+		"timezone":   scalar,
+		"holidays":   scalarList,
+		"not_before": scalar,
+		"not_after":  scalar,
+	}
+	roleFields    = map[string]shape{"name": scalar, "policies": scalarList}
+	userFields    = map[string]shape{"username": scalar, "roles": scalarList}
+	subjectFields = map[string]shape{"role": scalar}
+	policyFields  = map[string]shape{
+		"id":          scalar,
+		"description": scalar,
+		"subjects":    entryList,
+		"resource":    scalarList,
+		"action":      scalarList,
+		"effect":      scalar,
+		"conditions":  scalarMap,
+		"when":        scalarList,
+		"obligations": entryList,
+		"advice":      entryList,
+	}
+	obligationFields  = map[string]shape{"code": scalar, "params": scalarMap, "messages": scalarMap, "on": scalar}
+	remediationFields = map[string]shape{
+		"id":          scalar,
+		"policies":    scalarList,
+		"conditions":  scalarList,
+		"when":        scalarList,
+		"if":          scalarList,
+		"obligations": entryList,
+		"advice":      entryList,
+	}
+)
+
+var lineRe = regexp.MustCompile(`^yaml: line (\d+): `)
+
+// Validate checks YAML policy data and returns every problem found, ordered
+// by position. Findings with error severity make the data unloadable.
+func Validate(data []byte) []Finding {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		// The parser reports a line but no column.
+		f := Finding{Line: 1, Column: 1, Code: "syntax", Severity: SeverityError, Message: strings.TrimPrefix(err.Error(), "yaml: ")}
+		if m := lineRe.FindStringSubmatch(err.Error()); m != nil {
+			f.Line, _ = strconv.Atoi(m[1])
+			f.Message = strings.TrimPrefix(err.Error(), m[0])
+		}
+		return []Finding{f}
+	}
+	if len(root.Content) == 0 {
+		return nil
+	}
+	var cfg Config
+	top := resolve(root.Content[0])
+	if top.Kind != yaml.MappingNode {
+		return []Finding{at(top, "type", "policy file must be a mapping of roles, users and policies")}
+	}
+	out := checkMapping(top, topFields, "policy file")
+	for _, n := range items(field(top, "roles")) {
+		out = append(out, checkMapping(n, roleFields, "role")...)
+		var r role
+		n.Decode(&r)
+		r.node = n
+		cfg.Roles = append(cfg.Roles, r)
+	}
+	for _, n := range items(field(top, "users")) {
+		out = append(out, checkMapping(n, userFields, "user")...)
+		var u user
+		n.Decode(&u)
+		u.node = n
+		cfg.Users = append(cfg.Users, u)
+	}
+	for _, n := range items(field(top, "policies")) {
+		out = append(out, checkMapping(n, policyFields, "policy")...)
+		var p policy
+		n.Decode(&p)
+		p.node = n
+		subjects := items(field(n, "subjects"))
+		for i := range p.Subjects {
+			if i < len(subjects) {
+				out = append(out, checkMapping(subjects[i], subjectFields, "subject")...)
+				p.Subjects[i].node = subjects[i]
+			}
+		}
+		out = append(out, bindObligations(n, p.Obligations, p.Advice)...)
+		cfg.Policies = append(cfg.Policies, p)
+	}
+	for _, n := range items(field(top, "remediation")) {
+		out = append(out, checkMapping(n, remediationFields, "remediation rule")...)
+		var r remediationRule
+		n.Decode(&r)
+		r.node = n
+		out = append(out, bindObligations(n, r.Obligations, r.Advice)...)
+		cfg.Remediation = append(cfg.Remediation, r)
+	}
+	if n := field(top, "calendars"); n != nil {
+		n.Decode(&cfg.Calendars)
+	}
+	if n := field(top, "schedules"); n != nil && n.Kind == yaml.MappingNode {
+		cfg.Schedules = map[string]schedule.Spec{}
+		cfg.scheduleNodes = map[string]*yaml.Node{}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, val := n.Content[i], resolve(n.Content[i+1])
+			out = append(out, checkMapping(val, scheduleFields, "schedule")...)
+			var spec schedule.Spec
+			val.Decode(&spec)
+			cfg.Schedules[key.Value] = spec
+			cfg.scheduleNodes[key.Value] = key
+		}
+	}
+	if n := field(top, "zones"); n != nil && n.Kind == yaml.MappingNode {
+		cfg.Zones = map[string][]string{}
+		cfg.zoneNodes = map[string]*yaml.Node{}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, val := n.Content[i], resolve(n.Content[i+1])
+			var list []string
+			val.Decode(&list)
+			cfg.Zones[key.Value] = list
+			cfg.zoneNodes[key.Value] = val
+		}
+	}
+	out = append(out, check(&cfg)...)
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Line != out[j].Line {
+			return out[i].Line < out[j].Line
+		}
+		return out[i].Column < out[j].Column
+	})
+	return out
+}
+
+// bindObligations checks the obligations and advice entries of n and records
+// their nodes.
+func bindObligations(n *yaml.Node, obligations, advice []obligation) []Finding {
+	var out []Finding
+	for _, list := range []struct {
+		name  string
+		items []obligation
+	}{{"obligations", obligations}, {"advice", advice}} {
+		nodes := items(field(n, list.name))
+		for i := range list.items {
+			if i < len(nodes) {
+				out = append(out, checkMapping(nodes[i], obligationFields, "obligation")...)
+				list.items[i].node = nodes[i]
+			}
+		}
+	}
+	return out
+}
+
+// check performs semantic validation. Positions are taken from the nodes the
+// entries were decoded from, when known.
+func check(cfg *Config) []Finding {
+	var out []Finding
+	add := func(n *yaml.Node, code, severity, format string, args ...interface{}) {
+		f := Finding{Code: code, Severity: severity, Message: fmt.Sprintf(format, args...)}
+		if n != nil {
+			f.Line, f.Column = n.Line, n.Column
+		}
+		out = append(out, f)
+	}
+
 	roleSet := make(map[string]struct{})
 	for _, r := range cfg.Roles {
+		if _, dup := roleSet[r.Name]; dup {
+			add(r.node, "duplicate-id", SeverityWarning, "role %s is defined more than once; the last definition wins", r.Name)
+		}
 		roleSet[r.Name] = struct{}{}
 	}
+	userSet := make(map[string]struct{})
+	for _, u := range cfg.Users {
+		if _, dup := userSet[u.Username]; dup {
+			add(u.node, "duplicate-id", SeverityWarning, "user %s is defined more than once; the last definition wins", u.Username)
+		}
+		userSet[u.Username] = struct{}{}
+	}
 
+	for name, spec := range cfg.Schedules {
+		if _, err := spec.Compile(cfg.Calendars); err != nil {
+			add(cfg.scheduleNodes[name], "invalid-schedule", SeverityError, "schedule %s: %v", name, err)
+		}
+	}
+
+	for name, list := range cfg.Zones {
+		entries := items(cfg.zoneNodes[name])
+		for i, s := range list {
+			if _, err := network.ParsePrefix(s); err != nil {
+				n := cfg.zoneNodes[name]
+				if i < len(entries) {
+					n = entries[i]
+				}
+				add(n, "invalid-cidr", SeverityError, "zone %s: %v", name, err)
+			}
+		}
+	}
+
+	policySet := make(map[string]struct{})
 	for _, p := range cfg.Policies {
 		if p.ID == "" {
-			return fmt.Errorf("policy id is required")
+			add(p.node, "missing-id", SeverityError, "policy id is required")
+		} else if _, dup := policySet[p.ID]; dup {
+			add(keyNode(p.node, "id"), "duplicate-id", SeverityWarning, "policy %s is defined more than once; the last definition wins", p.ID)
+		}
+		policySet[p.ID] = struct{}{}
+		// Mistyped fields are already reported by the shape checks.
+		if len(p.Action) == 0 && isList(field(p.node, "action")) {
+			add(keyNode(p.node, "action"), "missing-action", SeverityError, "policy %s must have at least one action", p.ID)
 		}
-		if len(p.Action) == 0 {
-			return fmt.Errorf("policy %s must have at least one action", p.ID)
+		if len(p.Resource) == 0 && isList(field(p.node, "resource")) {
+			add(keyNode(p.node, "resource"), "missing-resource", SeverityError, "policy %s must have at least one resource", p.ID)
 		}
-		if len(p.Resource) == 0 {
-			return fmt.Errorf("policy %s must have at least one resource", p.ID)
+		switch p.Effect {
+		case "":
+			add(keyNode(p.node, "effect"), "missing-effect", SeverityError, "policy %s must have an effect", p.ID)
+		case "allow", "deny":
+		default:
+			add(field(p.node, "effect"), "unknown-effect", SeverityWarning, "policy %s has effect %q; only allow and deny grant or deny access", p.ID, p.Effect)
 		}
-		if p.Effect == "" {
-			return fmt.Errorf("policy %s must have an effect", p.ID)
+		if expr, ok := p.Conditions["time"]; ok {
+			if _, named := cfg.Schedules[expr]; !named && expr != "business-hours" {
+				if _, err := schedule.Parse(expr); err != nil {
+					add(field(field(p.node, "conditions"), "time"), "invalid-schedule", SeverityError,
+						"policy %s: time %q is not a named schedule: %v", p.ID, expr, err)
+				}
+			}
+		}
+		for _, o := range append(append([]obligation{}, p.Obligations...), p.Advice...) {
+			if o.Code == "" {
+				add(keyNode(o.node, "code"), "missing-code", SeverityError, "policy %s has an obligation or advice without code", p.ID)
+			}
+			switch o.On {
+			case "", "allow", "deny":
+			default:
+				add(field(o.node, "on"), "invalid-outcome", SeverityError, "policy %s: obligation %s applies on %q; must be allow or deny", p.ID, o.Code, o.On)
+			}
 		}
 		for _, subj := range p.Subjects {
 			if subj.Role == "" {
-				return fmt.Errorf("policy %s has subject with empty role", p.ID)
+				add(subj.node, "empty-role", SeverityError, "policy %s has subject with empty role", p.ID)
+				continue
 			}
 			if _, ok := roleSet[subj.Role]; !ok {
-				return fmt.Errorf("policy %s references undefined role %s", p.ID, subj.Role)
+				add(field(subj.node, "role"), "undefined-role", SeverityError, "policy %s references undefined role %s", p.ID, subj.Role)
+			}
+		}
+	}
+
+	for i, r := range cfg.Remediation {
+		name := r.ID
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if len(r.Obligations) == 0 && len(r.Advice) == 0 {
+			add(r.node, "empty-rule", SeverityWarning, "remediation rule %s has no obligations or advice", name)
+		}
+		for _, o := range append(append([]obligation{}, r.Obligations...), r.Advice...) {
+			if o.Code == "" {
+				add(keyNode(o.node, "code"), "missing-code", SeverityError, "remediation rule %s has an obligation or advice without code", name)
+			}
+			if o.On != "" {
+				add(keyNode(o.node, "on"), "ignored-outcome", SeverityWarning, "remediation rule %s: on is ignored; remediation rules only apply to denials", name)
+			}
+			for _, text := range templates(o) {
+				if _, err := template.New("").Parse(text); err != nil {
+					add(o.node, "invalid-template", SeverityError, "remediation rule %s: %v", name, err)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// templates returns the params and messages of o.
+func templates(o obligation) []string {
+	var out []string
+	for _, m := range []map[string]string{o.Params, o.Messages} {
+		for _, v := range m {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// checkMapping reports unknown, duplicate and mistyped fields of a mapping.
+func checkMapping(n *yaml.Node, fields map[string]shape, what string) []Finding {
+	n = resolve(n)
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+	var out []Finding
+	seen := map[string]bool{}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, val := n.Content[i], n.Content[i+1]
+		if seen[key.Value] {
+			out = append(out, at(key, "duplicate-key", "field %q is set more than once in %s", key.Value, what))
+			continue
+		}
+		seen[key.Value] = true
+		s, ok := fields[key.Value]
+		if !ok {
+			out = append(out, at(key, "unknown-field", "unknown field %q in %s", key.Value, what))
+			continue
+		}
+		out = append(out, checkShape(val, key.Value, s, what)...)
+	}
+	return out
+}
+
+// checkShape reports a value that does not have the expected form.
+func checkShape(n *yaml.Node, name string, s shape, what string) []Finding {
+	n = resolve(n)
+	if n.Kind == yaml.ScalarNode && n.Tag == "!!null" {
+		return nil
+	}
+	switch s {
+	case scalar:
+		if n.Kind != yaml.ScalarNode {
+			return []Finding{at(n, "type", "field %q in %s must be a string", name, what)}
+		}
+	case scalarList:
+		if n.Kind != yaml.SequenceNode {
+			return []Finding{at(n, "type", "field %q in %s must be a list of strings", name, what)}
+		}
+		var out []Finding
+		for _, item := range n.Content {
+			if resolve(item).Kind != yaml.ScalarNode {
+				out = append(out, at(item, "type", "items of %q in %s must be strings", name, what))
 			}
 		}
+		return out
+	case scalarMap:
+		if n.Kind != yaml.MappingNode {
+			return []Finding{at(n, "type", "field %q in %s must map strings to strings", name, what)}
+		}
+		var out []Finding
+		for _, item := range n.Content {
+			if resolve(item).Kind != yaml.ScalarNode {
+				out = append(out, at(item, "type", "field %q in %s must map strings to strings", name, what))
+			}
+		}
+		return out
+	case entryList:
+		if n.Kind != yaml.SequenceNode {
+			return []Finding{at(n, "type", "field %q in %s must be a list", name, what)}
+		}
+		var out []Finding
+		for _, item := range n.Content {
+			if resolve(item).Kind != yaml.MappingNode {
+				out = append(out, at(item, "type", "items of %q in %s must be mappings", name, what))
+			}
+		}
+		return out
+	case entryMap, listMap:
+		if n.Kind != yaml.MappingNode {
+			return []Finding{at(n, "type", "field %q in %s must be a mapping", name, what)}
+		}
+		var out []Finding
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			item := resolve(n.Content[i+1])
+			if s == entryMap && item.Kind != yaml.MappingNode {
+				out = append(out, at(item, "type", "values of %q in %s must be mappings", name, what))
+			}
+			if s == listMap {
+				out = append(out, checkShape(item, n.Content[i].Value, scalarList, name)...)
+			}
+		}
+		return out
 	}
 	return nil
 }
 
-// ValidatePolicyData validates the given YAML policy data.
+// isList reports whether n is absent, null or a sequence.
+func isList(n *yaml.Node) bool {
+	return n == nil || n.Kind == yaml.SequenceNode || n.Tag == "!!null"
+}
+
+func at(n *yaml.Node, code, format string, args ...interface{}) Finding {
+	return Finding{Line: n.Line, Column: n.Column, Code: code, Severity: SeverityError, Message: fmt.Sprintf(format, args...)}
+}
+
+func resolve(n *yaml.Node) *yaml.Node {
+	for n != nil && n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	return n
+}
+
+// field returns the value stored under key in a mapping node.
+func field(m *yaml.Node, key string) *yaml.Node {
+	m = resolve(m)
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return resolve(m.Content[i+1])
+		}
+	}
+	return nil
+}
+
+// keyNode returns the key node for key in a mapping, or m itself when the key
+// is absent so that findings point at the enclosing entry.
+func keyNode(m *yaml.Node, key string) *yaml.Node {
+	m = resolve(m)
+	if m == nil || m.Kind != yaml.MappingNode {
+		return m
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i]
+		}
+	}
+	return m
+}
+
+func items(n *yaml.Node) []*yaml.Node {
+	n = resolve(n)
+	if n == nil || n.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return n.Content
+}
+
+// ValidateConfig performs schema validation on the provided configuration and
+// returns the errors found.
+func ValidateConfig(cfg *Config) error {
+	return ErrorsOf(check(cfg))
+}
+
+// ValidatePolicyData validates the given YAML policy data. The returned error
+// is of type Errors and lists every error-severity finding.
 func ValidatePolicyData(data []byte) error {
-	var cfg Config
-	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
-		return err
+	return ErrorsOf(Validate(data))
+}
+
+// ErrorsOf returns the error-severity findings as Errors, or nil when there
+// are none.
+func ErrorsOf(findings []Finding) error {
+	var errs Errors
+	for _, f := range findings {
+		if f.Severity == SeverityError {
+			errs = append(errs, f)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// ValidateFile returns the findings for the policy file at path.
+func ValidateFile(path string) ([]Finding, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
 	}
-	return ValidateConfig(&cfg)
+	return Validate(data), nil
 }
 
 // ValidatePolicyFile validates a policy file at the given path.
@@ -1,6 +1,9 @@
 package validator
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestValidatePolicyValid(t *testing.T) {
 	yaml := []byte(`
@@ -55,3 +58,172 @@ policies:
 		t.Fatalf("expected error for empty action")
 	}
 }
+
+func TestValidateCollectsAllFindings(t *testing.T) {
+	yaml := []byte(`roles:
+  - name: "admin"
+    policies: ["p1"]
+policies:
+  - id: "p1"
+    subjects:
+      - role: "unknown"
+    resources: ["*"]
+    action: "read"
+    effect: "allow"
+  - id: "p2"
+    resource: ["*"]
+    action: ["read"]
+`)
+	findings := Validate(yaml)
+	want := []Finding{
+		{Line: 5, Column: 5, Code: "missing-resource", Severity: SeverityError},
+		{Line: 7, Column: 15, Code: "undefined-role", Severity: SeverityError},
+		{Line: 8, Column: 5, Code: "unknown-field", Severity: SeverityError},
+		{Line: 9, Column: 13, Code: "type", Severity: SeverityError},
+		{Line: 11, Column: 5, Code: "missing-effect", Severity: SeverityError},
+	}
+	if len(findings) != len(want) {
+		t.Fatalf("expected %d findings, got %v", len(want), findings)
+	}
+	for i, w := range want {
+		f := findings[i]
+		if f.Line != w.Line || f.Column != w.Column || f.Code != w.Code || f.Severity != w.Severity {
+			t.Errorf("finding %d: got %s, want %d:%d %s", i, f, w.Line, w.Column, w.Code)
+		}
+	}
+	if err := ValidatePolicyData(yaml); err == nil || !strings.Contains(err.Error(), "line 7: policy p1 references undefined role unknown") {
+		t.Fatalf("expected positioned error, got %v", err)
+	}
+}
+
+func TestValidateSyntaxError(t *testing.T) {
+	findings := Validate([]byte("roles:\n  - name: a\n    policies: [p1\n"))
+	if len(findings) != 1 || findings[0].Code != "syntax" || findings[0].Line != 2 {
+		t.Fatalf("expected one syntax finding on line 2, got %v", findings)
+	}
+}
+
+func TestValidateSchedules(t *testing.T) {
+	yaml := []byte(`policies:
+  - id: "p1"
+    resource: ["*"]
+    action: ["read"]
+    effect: "allow"
+    conditions:
+      time: "Mon-Fri 9-5"
+  - id: "p2"
+    resource: ["*"]
+    action: ["read"]
+    effect: "allow"
+    conditions:
+      time: "support"
+schedules:
+  support:
+    days: Mon-Fri
+    timezone: Mars/Olympus
+calendars:
+  us: ["2025-01-01"]
+`)
+	findings := Validate(yaml)
+	if len(findings) != 2 {
+		t.Fatalf("expected two schedule findings, got %v", findings)
+	}
+	if findings[0].Line != 7 || findings[0].Code != "invalid-schedule" {
+		t.Fatalf("expected invalid inline schedule on line 7, got %s", findings[0])
+	}
+	if findings[1].Line != 15 || !strings.Contains(findings[1].Message, "unknown timezone") {
+		t.Fatalf("expected unknown timezone on line 15, got %s", findings[1])
+	}
+}
+
+func TestValidateZones(t *testing.T) {
+	yaml := []byte(`policies:
+  - id: "p1"
+    resource: ["*"]
+    action: ["read"]
+    effect: "allow"
+    when:
+      - context.ip in zone("corp")
+zones:
+  corp:
+    - "10.0.0.0/8"
+    - "10.0.0.0/33"
+    - "2001:db8::/32"
+  vpn: "192.0.2.0/24"
+`)
+	findings := Validate(yaml)
+	if len(findings) != 2 {
+		t.Fatalf("expected two zone findings, got %v", findings)
+	}
+	if findings[0].Line != 11 || findings[0].Code != "invalid-cidr" {
+		t.Fatalf("expected invalid CIDR on line 11, got %s", findings[0])
+	}
+	if findings[1].Line != 13 || findings[1].Code != "type" {
+		t.Fatalf("expected a type error on line 13, got %s", findings[1])
+	}
+}
+
+func TestValidateObligations(t *testing.T) {
+	yaml := []byte(`policies:
+  - id: "p1"
+    resource: ["*"]
+    action: ["read"]
+    effect: "allow"
+    obligations:
+      - code: step_up
+        on: deny
+        params:
+          required_acr: mfa
+          max_age: 300
+        messages:
+          en: Sign in with MFA
+      - on: always
+    advice:
+      - code: notify
+        level: high
+`)
+	findings := Validate(yaml)
+	if len(findings) != 3 {
+		t.Fatalf("expected three obligation findings, got %v", findings)
+	}
+	if findings[0].Line != 14 || findings[0].Code != "missing-code" {
+		t.Fatalf("expected a missing code on line 14, got %s", findings[0])
+	}
+	if findings[1].Line != 14 || findings[1].Code != "invalid-outcome" {
+		t.Fatalf("expected an invalid outcome on line 14, got %s", findings[1])
+	}
+	if findings[2].Line != 17 || findings[2].Code != "unknown-field" {
+		t.Fatalf("expected an unknown field on line 17, got %s", findings[2])
+	}
+}
+
+func TestValidateRemediationRules(t *testing.T) {
+	yaml := []byte(`policies:
+  - id: "p1"
+    resource: ["*"]
+    action: ["read"]
+    effect: "allow"
+remediation:
+  - id: step-up
+    policies: ["p1"]
+    obligations:
+      - code: step_up
+        on: deny
+        messages:
+          en: "Sign in again {{.Context"
+  - id: empty
+    conditions: ["time"]
+    match: all
+`)
+	findings := Validate(yaml)
+	codes := make([]string, len(findings))
+	for i, f := range findings {
+		codes[i] = f.Code
+	}
+	if strings.Join(codes, ",") != "invalid-template,ignored-outcome,empty-rule,unknown-field" {
+		t.Fatalf("unexpected findings %v", findings)
+	}
+	if findings[0].Line != 10 || findings[1].Line != 11 || findings[3].Line != 16 {
+		t.Fatalf("unexpected positions %v", findings)
+	}
+}
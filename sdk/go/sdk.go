@@ -26,10 +26,20 @@ type AccessRequest struct {
 }
 
 type Decision struct {
-	Allow       bool     `json:"allow"`
-	PolicyID    string   `json:"policyID"`
-	Reason      string   `json:"reason"`
-	Remediation []string `json:"remediation"`
+	Allow       bool         `json:"allow"`
+	PolicyID    string       `json:"policyID"`
+	Reason      string       `json:"reason"`
+	Remediation []string     `json:"remediation"`
+	Obligations []Obligation `json:"obligations"`
+	Advice      []Obligation `json:"advice"`
+}
+
+// Obligation is a structured action returned with a decision, such as a
+// step_up with a required_acr parameter.
+type Obligation struct {
+	Code     string            `json:"code"`
+	Params   map[string]string `json:"params"`
+	Messages map[string]string `json:"messages"`
 }
 
 func (c *Client) post(path string, payload any) (*http.Response, error) {
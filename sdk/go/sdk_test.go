@@ -24,7 +24,7 @@ func TestClient(t *testing.T) {
 	})
 	mux.HandleFunc("/validate-policy", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("policy is valid"))
+		w.Write([]byte("[]"))
 	})
 	srv := httptest.NewServer(mux)
 	defer srv.Close()
@@ -20,7 +20,7 @@ class Handler(BaseHTTPRequestHandler):
         elif self.path == '/validate-policy':
             self.send_response(200)
             self.end_headers()
-            self.wfile.write(b'policy is valid')
+            self.wfile.write(b'[]')
         else:
             self.send_response(404)
             self.end_headers()
@@ -6,7 +6,6 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"sync"
 	"testing"
 	"time"
@@ -50,9 +49,9 @@ func TestJWKSRotation(t *testing.T) {
 	}))
 	defer oidc.Close()
 
-	os.Setenv("OIDC_ISSUERS", oidc.URL)
-	os.Setenv("OIDC_AUDIENCES", "test-aud")
-	os.Setenv("OIDC_JWKS_REFRESH_INTERVAL", "500ms")
+	t.Setenv("OIDC_ISSUERS", oidc.URL)
+	t.Setenv("OIDC_AUDIENCES", "test-aud")
+	t.Setenv("OIDC_JWKS_REFRESH_INTERVAL", "500ms")
 	middleware.LoadOIDCConfig()
 
 	router := api.SetupRouter()
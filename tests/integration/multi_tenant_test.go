@@ -10,9 +10,9 @@ import (
 	"testing"
 
 	api "github.com/bradtumy/authorization-service/api"
-	"github.com/bradtumy/authorization-service/internal/middleware"
 	"github.com/bradtumy/authorization-service/pkg/graph"
 	"github.com/bradtumy/authorization-service/pkg/policy"
+	"github.com/bradtumy/authorization-service/pkg/user"
 	jwt "github.com/golang-jwt/jwt/v4"
 )
 
@@ -40,13 +40,15 @@ func token(t *testing.T) string {
 }
 
 func TestMultiTenantIsolation(t *testing.T) {
-	os.Setenv("OIDC_CONFIG_FILE", "/dev/null")
-	middleware.LoadOIDCConfig()
+	useTestIssuer(t)
 	router := api.SetupRouter()
 	srv := httptest.NewServer(router)
 	defer srv.Close()
 
-	tok := token(t)
+	tok := verifiedToken(t, "tester")
+	// Creating and deleting tenants requires the SystemAdmin role.
+	user.Create("system", "tester", []string{"SystemAdmin"})
+	defer user.Delete("system", "tester")
 
 	createTenant := func(id string) {
 		body := fmt.Sprintf(`{"tenantID":"%s","name":"%s"}`, id, id)
@@ -148,7 +150,7 @@ policies:
 		body := fmt.Sprintf(`{"tenantID":"%s","subject":"%s","resource":"file1","action":"read","conditions":{}}`, tenantID, subject)
 		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/check-access", strings.NewReader(body))
 		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Authorization", "Bearer "+tok)
+		req.Header.Set("Authorization", "Bearer "+verifiedToken(t, subject))
 		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
 			t.Fatalf("check %s: %v", tenantID, err)
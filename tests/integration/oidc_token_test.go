@@ -6,7 +6,6 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
 	"time"
 
@@ -43,8 +42,8 @@ func TestOIDCTokenValidation(t *testing.T) {
 	defer oidc.Close()
 
 	// Configure middleware to use the mock issuer
-	os.Setenv("OIDC_ISSUERS", oidc.URL)
-	os.Setenv("OIDC_AUDIENCES", "test-aud")
+	t.Setenv("OIDC_ISSUERS", oidc.URL)
+	t.Setenv("OIDC_AUDIENCES", "test-aud")
 	middleware.LoadOIDCConfig()
 
 	// Start API server
@@ -148,12 +148,14 @@ func startPostgres(t *testing.T) (string, func()) {
 		t.Fatalf("open db: %v", err)
 	}
 	defer db.Close()
-	mig, err := os.ReadFile("migrations/001_init.up.sql")
-	if err != nil {
-		t.Fatalf("read migration: %v", err)
-	}
-	if _, err := db.Exec(string(mig)); err != nil {
-		t.Fatalf("migrate: %v", err)
+	for _, file := range []string{"migrations/001_init.up.sql", "migrations/002_api_keys.up.sql"} {
+		mig, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("read migration: %v", err)
+		}
+		if _, err := db.Exec(string(mig)); err != nil {
+			t.Fatalf("migrate: %v", err)
+		}
 	}
 
 	terminate := func() {
@@ -1,14 +1,63 @@
 package integration
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/bradtumy/authorization-service/internal/middleware"
+	jwt "github.com/golang-jwt/jwt/v4"
+	jose "gopkg.in/go-jose/go-jose.v2"
 )
 
+// testIssuer signs the tokens returned by verifiedToken once useTestIssuer
+// made the service trust it.
+const testIssuer = "https://issuer.test"
+
+var testKey *rsa.PrivateKey
+
 func TestMain(m *testing.M) {
 	os.Setenv("OIDC_CONFIG_FILE", "/dev/null")
 	middleware.LoadOIDCConfig()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	testKey = key
 	os.Exit(m.Run())
 }
+
+// useTestIssuer makes the service verify tokens against testIssuer until the
+// test ends.
+func useTestIssuer(t *testing.T) {
+	t.Helper()
+	jwks := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &testKey.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"}}}
+	data, _ := json.Marshal(jwks)
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		t.Fatalf("write jwks: %v", err)
+	}
+	t.Cleanup(func() { middleware.LoadOIDCConfig() })
+	t.Setenv("OIDC_ISSUERS", testIssuer)
+	t.Setenv("OIDC_AUDIENCES", "")
+	t.Setenv("OIDC_JWKS_FILES", file)
+	if err := middleware.LoadOIDCConfig(); err != nil {
+		t.Fatalf("load oidc config: %v", err)
+	}
+}
+
+// verifiedToken returns a token of testIssuer for sub.
+func verifiedToken(t *testing.T, sub string) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"iss": testIssuer, "sub": sub, "exp": time.Now().Add(time.Hour).Unix()})
+	tok.Header["kid"] = "test"
+	str, err := tok.SignedString(testKey)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return str
+}
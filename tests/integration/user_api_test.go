@@ -4,28 +4,15 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"strings"
 	"testing"
 
 	api "github.com/bradtumy/authorization-service/api"
-	"github.com/bradtumy/authorization-service/internal/middleware"
 	"github.com/bradtumy/authorization-service/pkg/user"
-	jwt "github.com/golang-jwt/jwt/v4"
 )
 
-func tokenFor(t *testing.T, sub string) string {
-	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": sub})
-	str, err := tok.SignedString([]byte("secret"))
-	if err != nil {
-		t.Fatalf("token: %v", err)
-	}
-	return str
-}
-
 func TestUserAPI(t *testing.T) {
-	os.Setenv("OIDC_CONFIG_FILE", "/dev/null")
-	middleware.LoadOIDCConfig()
+	useTestIssuer(t)
 	user.Reset()
 	user.EnablePersistence(false)
 	if _, err := user.Create("default", "admin", []string{"TenantAdmin"}); err != nil {
@@ -35,7 +22,7 @@ func TestUserAPI(t *testing.T) {
 	srv := httptest.NewServer(router)
 	defer srv.Close()
 
-	adminTok := tokenFor(t, "admin")
+	adminTok := verifiedToken(t, "admin")
 
 	// create bob
 	body := `{"tenantID":"default","username":"bob","roles":["viewer"]}`
@@ -92,7 +79,7 @@ func TestUserAPI(t *testing.T) {
 	}
 
 	// unauthorized with bob token
-	bobTok := tokenFor(t, "bob")
+	bobTok := verifiedToken(t, "bob")
 	req, _ = http.NewRequest(http.MethodPost, srv.URL+"/user/delete", strings.NewReader(`{"tenantID":"default","username":"bob"}`))
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+bobTok)